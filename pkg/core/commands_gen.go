@@ -211,6 +211,42 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "IFVERSION",
+        "name": ["version"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "IF",
+        "name": ["condition"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "VERSION",
+        "name": ["version"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WITHVERSION",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "MINMOVE",
+        "name": ["meters"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "MINAGE",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -298,6 +334,155 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "keys"
   },
+  "MSET": {
+    "summary": "Sets the values of many ids in one command",
+    "complexity": "O(N) where N is the number of objects",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "FIELD",
+        "name": ["name", "value"],
+        "type": ["string", "double"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "EX",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true,
+        "multiple": false
+      },
+      {
+        "command": "IFVERSION",
+        "name": ["version"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "IF",
+        "name": ["condition"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "VERSION",
+        "name": ["version"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WITHVERSION",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "MINMOVE",
+        "name": ["meters"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "MINAGE",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "name": "type",
+        "optional": true,
+        "enumargs": [
+          {
+            "name": "NX"
+          },
+          {
+            "name": "XX"
+          }
+        ]
+      },
+      {
+        "name": "value",
+        "enumargs": [
+          {
+            "name": "OBJECT",
+            "arguments": [
+              {
+                "name": "geojson",
+                "type": "geojson"
+              }
+            ]
+          },
+          {
+            "name": "POINT",
+            "arguments": [
+              {
+                "name": "lat",
+                "type": "double"
+              },
+              {
+                "name": "lon",
+                "type": "double"
+              }
+            ]
+          },
+          {
+            "name": "BOUNDS",
+            "arguments": [
+              {
+                "name": "minlat",
+                "type": "double"
+              },
+              {
+                "name": "minlon",
+                "type": "double"
+              },
+              {
+                "name": "maxlat",
+                "type": "double"
+              },
+              {
+                "name": "maxlon",
+                "type": "double"
+              }
+            ]
+          },
+          {
+            "name": "HASH",
+            "arguments": [
+              {
+                "name": "geohash",
+                "type": "geohash"
+              }
+            ]
+          },
+          {
+            "name": "STRING",
+            "arguments": [
+              {
+                "name": "value",
+                "type": "string"
+              }
+            ]
+          }
+        ]
+      },
+      {
+        "name": "id_and_value",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      }
+    ],
+    "group": "keys"
+  },
   "EXPIRE": {
     "summary": "Set a timeout on an id",
     "complexity": "O(1)",
@@ -412,6 +597,25 @@ var commandsJSON = `{
         "type": [],
         "optional": true
       },
+      {
+        "command": "WITHVERSION",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -440,6 +644,54 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "keys"
   },
+  "MGET": {
+    "summary": "Get the objects of many ids",
+    "complexity": "O(N) where N is the number of ids",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string",
+        "multiple": true
+      }
+    ],
+    "group": "keys"
+  },
+  "SETMINMOVE": {
+    "summary": "Sets the default movement threshold of a key",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "meters",
+        "type": "double"
+      },
+      {
+        "command": "MINAGE",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      }
+    ],
+    "group": "keys"
+  },
+  "DELMINMOVE": {
+    "summary": "Removes the default movement threshold of a key",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      }
+    ],
+    "group": "keys"
+  },
   "DEL": {
     "summary": "Delete an id from a key",
     "complexity": "O(1)",
@@ -600,12 +852,44 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "FILTER",
+        "name": "expression",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ORDER BY",
+        "name": ["field", "direction"],
+        "type": ["string", "string"],
+        "optional": true,
+        "variadic": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "PROFILE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -691,12 +975,44 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "FILTER",
+        "name": "expression",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ORDER BY",
+        "name": ["field", "direction"],
+        "type": ["string", "string"],
+        "optional": true,
+        "variadic": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "PROFILE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -794,12 +1110,44 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "FILTER",
+        "name": "expression",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ORDER BY",
+        "name": ["field", "direction"],
+        "type": ["string", "string"],
+        "optional": true,
+        "variadic": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "PROFILE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "FENCE",
         "name": [],
@@ -812,6 +1160,25 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "MIN",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAX",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WHEN",
+        "name": ["field", "op", "value"],
+        "type": ["string", "string", "double"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
@@ -879,6 +1246,55 @@ var commandsJSON = `{
                 "name": "pattern",
                 "type": "pattern"
               },
+              {
+                "name": "meters",
+                "type": "double"
+              },
+              {
+                "command": "SCAN",
+                "name": ["pattern"],
+                "type": ["pattern"],
+                "optional": true
+              },
+              {
+                "command": "SEPARATION",
+                "name": ["meters"],
+                "type": ["double"],
+                "optional": true
+              },
+              {
+                "command": "MINDURATION",
+                "name": ["seconds"],
+                "type": ["double"],
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "ROUTE",
+            "arguments": [
+              {
+                "name": "key",
+                "type": "string"
+              },
+              {
+                "name": "route",
+                "enumargs": [
+                  {
+                    "name": "routeid",
+                    "arguments": []
+                  },
+                  {
+                    "name": "FIELD",
+                    "arguments": [
+                      {
+                        "name": "field",
+                        "type": "string"
+                      }
+                    ]
+                  }
+                ]
+              },
               {
                 "name": "meters",
                 "type": "double"
@@ -949,7 +1365,39 @@ var commandsJSON = `{
         "variadic": true
       },
       {
-        "command": "NOFIELDS",
+        "command": "FILTER",
+        "name": "expression",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ORDER BY",
+        "name": ["field", "direction"],
+        "type": ["string", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOFIELDS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "PROFILE",
         "name": [],
         "type": [],
         "optional": true
@@ -966,6 +1414,25 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "MIN",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAX",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WHEN",
+        "name": ["field", "op", "value"],
+        "type": ["string", "string", "double"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
@@ -1188,6 +1655,19 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "FILTER",
+        "name": "expression",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ORDER BY",
+        "name": ["field", "direction"],
+        "type": ["string", "string"],
+        "optional": true,
+        "variadic": true
+      },
       {
         "command": "CLIP",
         "name": [],
@@ -1200,6 +1680,25 @@ var commandsJSON = `{
         "type": [],
         "optional": true
       },
+      {
+        "command": "FIELDS",
+        "name": ["count", "field"],
+        "type": ["integer", "string"],
+        "optional": true,
+        "variadic": true
+      },
+      {
+        "command": "NOGEOMETRY",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "PROFILE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "FENCE",
         "name": [],
@@ -1212,6 +1711,25 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "MIN",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAX",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WHEN",
+        "name": ["field", "op", "value"],
+        "type": ["string", "string", "double"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
@@ -1407,6 +1925,24 @@ var commandsJSON = `{
     "arguments": [],
     "group": "server"
   },
+  "EXPLAIN": {
+    "summary": "Runs a search and returns its statistics instead of the results",
+    "complexity": "The complexity of the search",
+    "arguments": [
+      {
+        "name": "command",
+        "type": "string",
+        "enum": ["SCAN", "SEARCH", "NEARBY", "WITHIN", "INTERSECTS"]
+      },
+      {
+        "name": "arg",
+        "type": "string",
+        "multiple": true,
+        "optional": true
+      }
+    ],
+    "group": "search"
+  },
   "SERVER": {
     "summary": "Show server stats and details",
     "complexity": "O(1)",
@@ -1414,6 +1950,30 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "server"
   },
+  "SLOWLOG GET": {
+    "summary": "Returns the most recent entries of the slow command log",
+    "complexity": "O(N) where N is the number of entries returned",
+    "arguments": [
+      {
+        "name": "count",
+        "type": "integer",
+        "optional": true
+      }
+    ],
+    "group": "server"
+  },
+  "SLOWLOG LEN": {
+    "summary": "Returns the number of entries in the slow command log",
+    "complexity": "O(1)",
+    "arguments": [],
+    "group": "server"
+  },
+  "SLOWLOG RESET": {
+    "summary": "Clears the slow command log",
+    "complexity": "O(N) where N is the number of entries in the log",
+    "arguments": [],
+    "group": "server"
+  },
   "GC": {
     "summary": "Forces a garbage collection",
     "complexity": "O(1)",
@@ -1568,6 +2128,82 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "TEMPLATE",
+        "name": ["template"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "FORMAT",
+        "name": ["format"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "BATCH",
+        "name": ["size", "maxwait"],
+        "type": ["integer", "double"],
+        "optional": true
+      },
+      {
+        "command": "SIGN",
+        "name": ["secret"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "HEADER",
+        "name": ["name", "value"],
+        "type": ["string", "string"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "CERT",
+        "name": ["certfile", "keyfile"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "CACERT",
+        "name": ["cafile"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "SCHEDULE",
+        "name": ["cron", "timezone"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "EXITONCLOSE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "PAUSED",
+        "name": [
+          "policy"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      },
       {
         "enum": ["NEARBY", "WITHIN", "INTERSECTS"]
       },
@@ -1586,6 +2222,25 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "MIN",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAX",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WHEN",
+        "name": ["field", "op", "value"],
+        "type": ["string", "string", "double"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
@@ -1616,6 +2271,110 @@ var commandsJSON = `{
       {
         "name": "pattern",
         "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      }
+    ],
+    "group": "webhook"
+  },
+  "HOOKPAUSE": {
+    "summary": "Pauses all hooks and channels matching a pattern",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      },
+      {
+        "name": "policy",
+        "optional": true,
+        "enumargs": [
+          {
+            "name": "BUFFER"
+          },
+          {
+            "name": "DROP"
+          }
+        ]
+      }
+    ],
+    "group": "webhook"
+  },
+  "HOOKRESUME": {
+    "summary": "Resumes all hooks and channels matching a pattern",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      }
+    ],
+    "group": "webhook"
+  },
+  "HOOKS EXPORT": {
+    "summary": "Exports the hooks matching a pattern as a JSON document",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      },
+      {
+        "command": "WITHSECRETS",
+        "name": [],
+        "type": [],
+        "optional": true
+      }
+    ],
+    "group": "webhook"
+  },
+  "HOOKS IMPORT": {
+    "summary": "Creates or replaces hooks from an exported JSON document",
+    "arguments": [
+      {
+        "command": "DRYRUN",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "name": "document",
+        "type": "string"
       }
     ],
     "group": "webhook"
@@ -1652,6 +2411,61 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "TEMPLATE",
+        "name": ["template"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "FORMAT",
+        "name": ["format"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "HISTORY",
+        "name": [
+          "count|duration"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      },
+      {
+        "command": "SCHEDULE",
+        "name": ["cron", "timezone"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "EXITONCLOSE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "PAUSED",
+        "name": [
+          "policy"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      },
       {
         "enum": ["NEARBY", "WITHIN", "INTERSECTS"]
       },
@@ -1670,6 +2484,25 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "MIN",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAX",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "WHEN",
+        "name": ["field", "op", "value"],
+        "type": ["string", "string", "double"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
@@ -1700,6 +2533,52 @@ var commandsJSON = `{
       {
         "name": "pattern",
         "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      }
+    ],
+    "group": "pubsub"
+  },
+  "CHANS EXPORT": {
+    "summary": "Exports the channels matching a pattern as a JSON document",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern"
+      },
+      {
+        "command": "TAG",
+        "name": [
+          "tag"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
+      }
+    ],
+    "group": "pubsub"
+  },
+  "CHANS IMPORT": {
+    "summary": "Creates or replaces channels from an exported JSON document",
+    "arguments": [
+      {
+        "command": "DRYRUN",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "name": "document",
+        "type": "string"
       }
     ],
     "group": "pubsub"
@@ -1721,6 +2600,16 @@ var commandsJSON = `{
         "name": "channel",
         "type": "string",
         "variadic": true
+      },
+      {
+        "command": "FROM",
+        "name": [
+          "id|time"
+        ],
+        "type": [
+          "string"
+        ],
+        "optional": true
       }
     ],
     "group": "pubsub"
@@ -22,6 +22,7 @@ package collection
 
 import (
 	"runtime"
+	"time"
 
 	"github.com/bhojpur/space/pkg/tile/deadline"
 	"github.com/bhojpur/space/pkg/utils/btree"
@@ -46,6 +47,8 @@ type itemT struct {
 	obj             geojson.Object
 	expires         int64 // unix nano expiration
 	fieldValuesSlot fieldValuesSlot
+	version         uint64 // changed on each change of the object
+	moved           int64  // unix nano of the last Set of the object, not persisted
 }
 
 func byID(a, b interface{}) bool {
@@ -89,8 +92,9 @@ type Collection struct {
 	fieldValues *fieldValues
 	weight      int
 	points      int
-	objects     int // geometry count
-	nobjects    int // non-geometry count
+	objects     int    // geometry count
+	nobjects    int    // non-geometry count
+	version     uint64 // last version given to an object
 }
 
 // New creates an empty collection
@@ -181,7 +185,8 @@ func (c *Collection) Set(
 ) (
 	oldObject geojson.Object, oldFieldValues []float64, newFieldValues []float64,
 ) {
-	newItem := &itemT{id: id, obj: obj, fieldValuesSlot: nilValuesSlot, expires: ex}
+	newItem := &itemT{id: id, obj: obj, fieldValuesSlot: nilValuesSlot, expires: ex,
+		version: c.nextVersion(), moved: time.Now().UnixNano()}
 
 	// add the new item to main btree and remove the old one if needed
 	oldItem := c.items.Set(newItem)
@@ -245,6 +250,22 @@ func (c *Collection) Set(
 	return oldObject, oldFieldValues, newFieldValues
 }
 
+// SetWithVersion is like Set, but gives the object a version, such as when
+// it is loaded from a rewritten aof, without using the next version of the
+// collection.
+func (c *Collection) SetWithVersion(
+	id string, obj geojson.Object, fields []string, values []float64, ex int64,
+	version uint64,
+) (
+	oldObject geojson.Object, oldFieldValues []float64, newFieldValues []float64,
+) {
+	last := c.version
+	oldObject, oldFieldValues, newFieldValues = c.Set(id, obj, fields, values, ex)
+	c.version = last
+	c.SetVersion(id, version)
+	return oldObject, oldFieldValues, newFieldValues
+}
+
 // Delete removes an object and returns it.
 // If the object does not exist then the 'ok' return value will be false.
 func (c *Collection) Delete(id string) (
@@ -289,6 +310,62 @@ func (c *Collection) Get(id string) (
 	return item.obj, c.fieldValues.get(item.fieldValuesSlot), item.expires, true
 }
 
+// Version returns the version of an object, which changes each time that the
+// object or its fields change. Versions are taken from a counter of the
+// collection, so an object that is deleted and set again does not reuse the
+// versions of the old object.
+// If the object does not exist then the 'ok' return value will be false.
+func (c *Collection) Version(id string) (version uint64, ok bool) {
+	itemV := c.items.Get(&itemT{id: id})
+	if itemV == nil {
+		return 0, false
+	}
+	return itemV.(*itemT).version, true
+}
+
+// SetVersion replaces the version of an object, such as when it is loaded
+// from a rewritten aof.
+func (c *Collection) SetVersion(id string, version uint64) bool {
+	itemV := c.items.Get(&itemT{id: id})
+	if itemV == nil {
+		return false
+	}
+	itemV.(*itemT).version = version
+	c.SetLastVersion(version)
+	return true
+}
+
+func (c *Collection) nextVersion() uint64 {
+	c.version++
+	return c.version
+}
+
+// LastVersion returns the last version given to an object in the collection.
+func (c *Collection) LastVersion() uint64 {
+	return c.version
+}
+
+// SetLastVersion raises the last version given to an object in the
+// collection, such as when the collection replaces one that was removed.
+// Lower versions are ignored.
+func (c *Collection) SetLastVersion(version uint64) {
+	if version > c.version {
+		c.version = version
+	}
+}
+
+// Moved returns the time, in unix nanoseconds, that the object was last set.
+// Changes to the fields or the expiration of the object do not change it.
+// The time is not kept in the aof, so objects that are loaded from it have
+// the time that they were loaded.
+func (c *Collection) Moved(id string) (moved int64, ok bool) {
+	itemV := c.items.Get(&itemT{id: id})
+	if itemV == nil {
+		return 0, false
+	}
+	return itemV.(*itemT).moved, true
+}
+
 func (c *Collection) SetExpires(id string, ex int64) bool {
 	v := c.items.Get(&itemT{id: id})
 	if v == nil {
@@ -317,6 +394,9 @@ func (c *Collection) SetField(id, field string, value float64) (
 	item := itemV.(*itemT)
 	_, updateCount, weightDelta := c.setFieldValues(item, []string{field}, []float64{value})
 	c.weight += weightDelta
+	if updateCount > 0 {
+		item.version = c.nextVersion()
+	}
 	return item.obj, c.fieldValues.get(item.fieldValuesSlot), updateCount > 0, true
 }
 
@@ -331,6 +411,9 @@ func (c *Collection) SetFields(
 	item := itemV.(*itemT)
 	newFieldValues, updateCount, weightDelta := c.setFieldValues(item, inFields, inValues)
 	c.weight += weightDelta
+	if updateCount > 0 {
+		item.version = c.nextVersion()
+	}
 	return item.obj, newFieldValues, updateCount, true
 }
 
@@ -412,9 +495,12 @@ func (c *Collection) Scan(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "key scan")
 	iter := func(item interface{}) bool {
 		count++
+		stats.candidate()
 		if count <= offset {
+			stats.skip()
 			return true
 		}
 		nextStep(count, cursor, deadline)
@@ -445,10 +531,13 @@ func (c *Collection) ScanRange(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "key range scan")
 	iter := func(value interface{}) bool {
 		item := value.(*itemT)
 		count++
+		stats.candidate()
 		if count <= offset {
+			stats.skip()
 			return true
 		}
 		nextStep(count, cursor, deadline)
@@ -488,9 +577,12 @@ func (c *Collection) SearchValues(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "value scan")
 	iter := func(item interface{}) bool {
 		count++
+		stats.candidate()
 		if count <= offset {
+			stats.skip()
 			return true
 		}
 		nextStep(count, cursor, deadline)
@@ -519,9 +611,12 @@ func (c *Collection) SearchValuesRange(start, end string, desc bool,
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "value range scan")
 	iter := func(item interface{}) bool {
 		count++
+		stats.candidate()
 		if count <= offset {
+			stats.skip()
 			return true
 		}
 		nextStep(count, cursor, deadline)
@@ -579,7 +674,7 @@ func (c *Collection) ScanGreaterOrEqual(id string, desc bool,
 }
 
 func (c *Collection) geoSearch(
-	rect geometry.Rect,
+	rect geometry.Rect, stats *Stats,
 	iter func(id string, obj geojson.Object, fields []float64) bool,
 ) bool {
 	alive := true
@@ -587,6 +682,7 @@ func (c *Collection) geoSearch(
 		[2]float64{rect.Min.X, rect.Min.Y},
 		[2]float64{rect.Max.X, rect.Max.Y},
 		func(_, _ [2]float64, itemv interface{}) bool {
+			stats.candidate()
 			item := itemv.(*itemT)
 			alive = iter(item.id, item.obj, c.fieldValues.get(item.fieldValuesSlot))
 			return alive
@@ -596,12 +692,12 @@ func (c *Collection) geoSearch(
 }
 
 func (c *Collection) geoSparse(
-	obj geojson.Object, sparse uint8,
+	obj geojson.Object, sparse uint8, stats *Stats,
 	iter func(id string, obj geojson.Object, fields []float64) (match, ok bool),
 ) bool {
 	matches := make(map[string]bool)
 	alive := true
-	c.geoSparseInner(obj.Rect(), sparse,
+	c.geoSparseInner(obj.Rect(), sparse, stats,
 		func(id string, o geojson.Object, fields []float64) (
 			match, ok bool,
 		) {
@@ -618,7 +714,7 @@ func (c *Collection) geoSparse(
 	return alive
 }
 func (c *Collection) geoSparseInner(
-	rect geometry.Rect, sparse uint8,
+	rect geometry.Rect, sparse uint8, stats *Stats,
 	iter func(id string, obj geojson.Object, fields []float64) (match, ok bool),
 ) bool {
 	if sparse > 0 {
@@ -643,14 +739,15 @@ func (c *Collection) geoSparseInner(
 			},
 		}
 		for _, quad := range quads {
-			if !c.geoSparseInner(quad, sparse-1, iter) {
+			if !c.geoSparseInner(quad, sparse-1, stats, iter) {
 				return false
 			}
 		}
 		return true
 	}
+	stats.sparseArea()
 	alive := true
-	c.geoSearch(rect,
+	c.geoSearch(rect, stats,
 		func(id string, obj geojson.Object, fields []float64) bool {
 			match, ok := iter(id, obj, fields)
 			if !ok {
@@ -678,31 +775,44 @@ func (c *Collection) Within(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "spatial index")
 	if sparse > 0 {
-		return c.geoSparse(obj, sparse,
+		return c.geoSparse(obj, sparse, stats,
 			func(id string, o geojson.Object, fields []float64) (
 				match, ok bool,
 			) {
 				count++
 				if count <= offset {
+					stats.skip()
 					return false, true
 				}
 				nextStep(count, cursor, deadline)
-				if match = o.Within(obj); match {
+				start := stats.start()
+				match = o.Within(obj)
+				stats.tested(start, match)
+				if match {
 					ok = iter(id, o, fields)
 				}
 				return match, ok
 			},
 		)
 	}
-	return c.geoSearch(obj.Rect(),
+	if n := cursorParallelism(cursor); n > 1 {
+		return c.geoSearchParallel(obj.Rect(), n, offset, cursor, deadline, stats,
+			func(o geojson.Object) bool { return o.Within(obj) }, iter)
+	}
+	return c.geoSearch(obj.Rect(), stats,
 		func(id string, o geojson.Object, fields []float64) bool {
 			count++
 			if count <= offset {
+				stats.skip()
 				return true
 			}
 			nextStep(count, cursor, deadline)
-			if o.Within(obj) {
+			start := stats.start()
+			match := o.Within(obj)
+			stats.tested(start, match)
+			if match {
 				return iter(id, o, fields)
 			}
 			return true
@@ -725,31 +835,44 @@ func (c *Collection) Intersects(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "spatial index")
 	if sparse > 0 {
-		return c.geoSparse(obj, sparse,
+		return c.geoSparse(obj, sparse, stats,
 			func(id string, o geojson.Object, fields []float64) (
 				match, ok bool,
 			) {
 				count++
 				if count <= offset {
+					stats.skip()
 					return false, true
 				}
 				nextStep(count, cursor, deadline)
-				if match = o.Intersects(obj); match {
+				start := stats.start()
+				match = o.Intersects(obj)
+				stats.tested(start, match)
+				if match {
 					ok = iter(id, o, fields)
 				}
 				return match, ok
 			},
 		)
 	}
-	return c.geoSearch(obj.Rect(),
+	if n := cursorParallelism(cursor); n > 1 {
+		return c.geoSearchParallel(obj.Rect(), n, offset, cursor, deadline, stats,
+			func(o geojson.Object) bool { return o.Intersects(obj) }, iter)
+	}
+	return c.geoSearch(obj.Rect(), stats,
 		func(id string, o geojson.Object, fields []float64) bool {
 			count++
 			if count <= offset {
+				stats.skip()
 				return true
 			}
 			nextStep(count, cursor, deadline)
-			if o.Intersects(obj) {
+			start := stats.start()
+			match := o.Intersects(obj)
+			stats.tested(start, match)
+			if match {
 				return iter(id, o, fields)
 			}
 			return true
@@ -796,11 +919,14 @@ func (c *Collection) Nearby(
 		offset = cursor.Offset()
 		cursor.Step(offset)
 	}
+	stats := cursorStats(cursor, "nearest neighbors")
 	c.index.Nearby(
 		geodeticDistAlgo([2]float64{center.X, center.Y}),
 		func(_, _ [2]float64, itemv interface{}, dist float64) bool {
 			count++
+			stats.candidate()
 			if count <= offset {
+				stats.skip()
 				return true
 			}
 			nextStep(count, cursor, deadline)
@@ -73,7 +73,7 @@ func TestCollectionNewCollection(t *testing.T) {
 		Min: geometry.Point{X: -180, Y: -90},
 		Max: geometry.Point{X: 180, Y: 90},
 	}
-	c.geoSearch(bbox, func(id string, obj geojson.Object, field []float64) bool {
+	c.geoSearch(bbox, nil, func(id string, obj geojson.Object, field []float64) bool {
 		count++
 		return true
 	})
@@ -613,6 +613,154 @@ func TestCollectionSparse(t *testing.T) {
 
 }
 
+type statsCursor struct {
+	offset uint64
+	stats  Stats
+}
+
+func (cursor *statsCursor) Offset() uint64 { return cursor.offset }
+func (cursor *statsCursor) Step(uint64)    {}
+func (cursor *statsCursor) Stats() *Stats  { return &cursor.stats }
+
+func TestCollectionStats(t *testing.T) {
+	c := New()
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("%d", i), PO(float64(i), float64(9-i)), nil, nil, 0)
+	}
+	// a triangle whose bounding box holds all points, but only half of
+	// them are inside of it
+	tri, err := geojson.Parse(`{"type":"Polygon","coordinates":`+
+		`[[[-1,-1],[10,-1],[10,10],[-1,-1]]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := &statsCursor{offset: 2}
+	var n int
+	c.Intersects(tri, 0, cursor, nil,
+		func(id string, obj geojson.Object, fields []float64) bool {
+			n++
+			return true
+		},
+	)
+	stats := cursor.stats
+	expect(t, stats.Strategy == "spatial index")
+	expect(t, stats.Candidates == 10 && stats.Skipped == 2)
+	expect(t, stats.Rejected == uint64(8-n) && n > 0 && n <= 5)
+
+	cursor = &statsCursor{}
+	c.Scan(false, cursor, nil,
+		func(id string, obj geojson.Object, fields []float64) bool {
+			return true
+		},
+	)
+	expect(t, cursor.stats.Strategy == "key scan")
+	expect(t, cursor.stats.Candidates == 10)
+}
+
+func TestCollectionVersion(t *testing.T) {
+	c := New()
+	_, ok := c.Version("1")
+	expect(t, !ok)
+	c.Set("1", PO(1, 2), nil, nil, 0)
+	v, ok := c.Version("1")
+	expect(t, ok && v == 1)
+	c.Set("1", PO(2, 3), nil, nil, 0)
+	v, _ = c.Version("1")
+	expect(t, v == 2)
+	c.SetFields("1", []string{"speed"}, []float64{10})
+	v, _ = c.Version("1")
+	expect(t, v == 3)
+	// fields that do not change keep the version
+	c.SetField("1", "speed", 10)
+	v, _ = c.Version("1")
+	expect(t, v == 3)
+	expect(t, c.SetVersion("1", 50))
+	c.Set("1", PO(3, 4), nil, nil, 0)
+	v, _ = c.Version("1")
+	expect(t, v == 51)
+	// a deleted object that is set again does not reuse its old versions
+	c.Delete("1")
+	c.Set("1", PO(3, 4), nil, nil, 0)
+	v, _ = c.Version("1")
+	expect(t, v == 52)
+	c.Set("2", PO(3, 4), nil, nil, 0)
+	v, _ = c.Version("2")
+	expect(t, v == 53 && c.LastVersion() == 53)
+	expect(t, !c.SetVersion("3", 1))
+	// a collection that replaces a removed one continues its versions
+	c2 := New()
+	c2.SetLastVersion(c.LastVersion())
+	c2.SetLastVersion(1)
+	c2.Set("1", PO(3, 4), nil, nil, 0)
+	v, _ = c2.Version("1")
+	expect(t, v == 54)
+	// a version that is given does not use the next one of the collection
+	c2.SetWithVersion("2", PO(3, 4), nil, nil, 0, 10)
+	v, _ = c2.Version("2")
+	expect(t, v == 10 && c2.LastVersion() == 54)
+	c2.SetWithVersion("3", PO(3, 4), nil, nil, 0, 60)
+	expect(t, c2.LastVersion() == 60)
+}
+
+func TestCollectionMoved(t *testing.T) {
+	c := New()
+	_, ok := c.Moved("1")
+	expect(t, !ok)
+	c.Set("1", PO(1, 2), nil, nil, 0)
+	moved1, ok := c.Moved("1")
+	expect(t, ok && moved1 > 0)
+	// fields and expiration keep the time
+	c.SetFields("1", []string{"speed"}, []float64{10})
+	c.SetExpires("1", time.Now().Add(time.Hour).UnixNano())
+	moved2, _ := c.Moved("1")
+	expect(t, moved2 == moved1)
+	time.Sleep(time.Millisecond)
+	c.Set("1", PO(1, 2), nil, nil, 0)
+	moved2, _ = c.Moved("1")
+	expect(t, moved2 > moved1)
+}
+
+type parallelCursor struct {
+	offset uint64
+	steps  uint64
+	n      int
+}
+
+func (cursor *parallelCursor) Offset() uint64   { return cursor.offset }
+func (cursor *parallelCursor) Step(n uint64)    { cursor.steps += n }
+func (cursor *parallelCursor) Parallelism() int { return cursor.n }
+
+func TestCollectionParallel(t *testing.T) {
+	c := New()
+	for i := 0; i < 5000; i++ {
+		c.Set(strconv.Itoa(i), PO(rand.Float64()*20, rand.Float64()*20), nil, nil, 0)
+	}
+	tri, err := geojson.Parse(`{"type":"Polygon","coordinates":`+
+		`[[[0,0],[20,0],[20,20],[0,0]]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(n int, offset uint64, limit int) ([]string, uint64) {
+		cursor := &parallelCursor{offset: offset, n: n}
+		var ids []string
+		c.Within(tri, 0, cursor, nil,
+			func(id string, obj geojson.Object, fields []float64) bool {
+				ids = append(ids, id)
+				return len(ids) < limit
+			},
+		)
+		return ids, cursor.steps
+	}
+	for _, offset := range []uint64{0, 100, 4999} {
+		for _, limit := range []int{1, 700, 5000} {
+			ids1, steps1 := search(1, offset, limit)
+			ids2, steps2 := search(4, offset, limit)
+			expect(t, reflect.DeepEqual(ids1, ids2))
+			expect(t, steps1 == steps2)
+		}
+	}
+}
+
 func testCollectionVerifyContents(t *testing.T, c *Collection, objs map[string]geojson.Object) {
 	for id, o2 := range objs {
 		o1, _, _, ok := c.Get(id)
@@ -657,7 +805,7 @@ func TestManyCollections(t *testing.T) {
 		Min: geometry.Point{X: -180, Y: 30},
 		Max: geometry.Point{X: 34, Y: 100},
 	}
-	col.geoSearch(bbox, func(id string, obj geojson.Object, fields []float64) bool {
+	col.geoSearch(bbox, nil, func(id string, obj geojson.Object, fields []float64) bool {
 		//println(id)
 		return true
 	})
@@ -0,0 +1,170 @@
+package collection
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/deadline"
+	"github.com/bhojpur/space/pkg/utils/geojson"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+)
+
+const (
+	parallelBatch    = 1024 // candidates gathered before they are tested
+	minParallelChunk = 64   // fewest candidates tested by each goroutine
+)
+
+// ParallelCursor is a Cursor that allows the geometry tests of a search to
+// run on up to Parallelism goroutines.
+type ParallelCursor interface {
+	Cursor
+	Parallelism() int
+}
+
+// cursorParallelism returns the number of goroutines that a search with
+// cursor may use.
+func cursorParallelism(cursor Cursor) int {
+	if pc, ok := cursor.(ParallelCursor); ok {
+		if n := pc.Parallelism(); n > 1 {
+			return n
+		}
+	}
+	return 1
+}
+
+type candidate struct {
+	id     string
+	obj    geojson.Object
+	fields []float64
+	match  bool
+}
+
+// testCandidates runs test on each candidate, splitting them across up to
+// n goroutines, and returns the total time spent in the tests.
+func testCandidates(cands []candidate, n int, timed bool,
+	test func(o geojson.Object) bool,
+) time.Duration {
+	if max := len(cands) / minParallelChunk; n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+	var total int64
+	var next int64
+	var wg sync.WaitGroup
+	chunk := (len(cands) + n - 1) / n
+	worker := func() {
+		defer wg.Done()
+		for {
+			i := int(atomic.AddInt64(&next, 1)-1) * chunk
+			if i >= len(cands) {
+				break
+			}
+			end := i + chunk
+			if end > len(cands) {
+				end = len(cands)
+			}
+			var start time.Time
+			if timed {
+				start = time.Now()
+			}
+			for j := i; j < end; j++ {
+				cands[j].match = test(cands[j].obj)
+			}
+			if timed {
+				atomic.AddInt64(&total, int64(time.Since(start)))
+			}
+		}
+	}
+	wg.Add(n)
+	for i := 1; i < n; i++ {
+		go worker()
+	}
+	worker()
+	wg.Wait()
+	return time.Duration(total)
+}
+
+// geoSearchParallel searches the index like geoSearch and tests the
+// candidates after the cursor offset in batches on up to n goroutines. The
+// matches are passed to iter in index order, so the results are the same as
+// those of a search on a single goroutine.
+func (c *Collection) geoSearchParallel(
+	rect geometry.Rect, n int, offset uint64, cursor Cursor,
+	deadline *deadline.Deadline, stats *Stats,
+	test func(o geojson.Object) bool,
+	iter func(id string, obj geojson.Object, fields []float64) bool,
+) bool {
+	if stats != nil {
+		stats.Strategy = "parallel spatial index"
+	}
+	var count uint64
+	step := offset
+	alive := true
+	cands := make([]candidate, 0, parallelBatch)
+	flush := func() {
+		deadline.Check()
+		stats.addGeometryTime(testCandidates(cands, n, stats != nil, test))
+		for _, cand := range cands {
+			step++
+			nextStep(step, cursor, deadline)
+			if !cand.match {
+				stats.reject()
+				continue
+			}
+			if !iter(cand.id, cand.obj, cand.fields) {
+				alive = false
+				break
+			}
+		}
+		cands = cands[:0]
+	}
+	c.index.Search(
+		[2]float64{rect.Min.X, rect.Min.Y},
+		[2]float64{rect.Max.X, rect.Max.Y},
+		func(_, _ [2]float64, itemv interface{}) bool {
+			stats.candidate()
+			count++
+			if count <= offset {
+				stats.skip()
+				return true
+			}
+			item := itemv.(*itemT)
+			cands = append(cands, candidate{
+				id:     item.id,
+				obj:    item.obj,
+				fields: c.fieldValues.get(item.fieldValuesSlot),
+			})
+			if len(cands) == parallelBatch {
+				flush()
+			}
+			return alive
+		},
+	)
+	if alive && len(cands) > 0 {
+		flush()
+	}
+	return alive
+}
@@ -0,0 +1,101 @@
+package collection
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "time"
+
+// Stats counts the work of a search. A search keeps stats when its cursor
+// is a StatsCursor that returns them.
+type Stats struct {
+	Strategy     string        // how the objects were found
+	Candidates   uint64        // objects found by the index or the scan
+	Skipped      uint64        // candidates before the cursor
+	Rejected     uint64        // candidates that failed the geometry test
+	SparseAreas  uint64        // areas searched for SPARSE
+	GeometryTime time.Duration // time spent in geometry tests
+}
+
+// StatsCursor is a Cursor that keeps the stats of the searches that it is
+// used for, or returns nil for no stats.
+type StatsCursor interface {
+	Cursor
+	Stats() *Stats
+}
+
+// cursorStats returns the stats of a cursor, with the strategy of the
+// search, or nil.
+func cursorStats(cursor Cursor, strategy string) *Stats {
+	if sc, ok := cursor.(StatsCursor); ok {
+		if stats := sc.Stats(); stats != nil {
+			stats.Strategy = strategy
+			return stats
+		}
+	}
+	return nil
+}
+
+func (stats *Stats) candidate() {
+	if stats != nil {
+		stats.Candidates++
+	}
+}
+
+func (stats *Stats) skip() {
+	if stats != nil {
+		stats.Skipped++
+	}
+}
+
+func (stats *Stats) sparseArea() {
+	if stats != nil {
+		stats.SparseAreas++
+	}
+}
+
+// start returns the start time of a geometry test.
+func (stats *Stats) start() time.Time {
+	if stats != nil {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+// tested records a geometry test that started at start.
+func (stats *Stats) tested(start time.Time, match bool) {
+	if stats != nil {
+		stats.GeometryTime += time.Since(start)
+		if !match {
+			stats.Rejected++
+		}
+	}
+}
+
+func (stats *Stats) reject() {
+	if stats != nil {
+		stats.Rejected++
+	}
+}
+
+func (stats *Stats) addGeometryTime(d time.Duration) {
+	if stats != nil {
+		stats.GeometryTime += d
+	}
+}
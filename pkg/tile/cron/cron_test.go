@@ -0,0 +1,82 @@
+package cron
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *", "*/15 8-17 * * mon-fri", "0,30 22-23,0-5 1 jan-mar 7",
+		"5/10 * * * *", "0 12 * * 0-6/2",
+	} {
+		if _, err := Parse(expr); err != nil {
+			t.Fatalf("%q: %v", expr, err)
+		}
+	}
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *",
+		"* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *",
+		"* * * * funday",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	for _, tc := range []struct {
+		expr  string
+		time  string
+		match bool
+	}{
+		// 2026-10-19 is a Monday
+		{"* 7-8 * * mon-fri", "2026-10-19 07:30", true},
+		{"* 7-8 * * mon-fri", "2026-10-19 09:00", false},
+		{"* 7-8 * * mon-fri", "2026-10-18 07:30", false},
+		{"* 22-23,0-5 * * *", "2026-10-19 03:10", true},
+		{"*/15 * * * *", "2026-10-19 03:45", true},
+		{"*/15 * * * *", "2026-10-19 03:46", false},
+		{"* * * * 7", "2026-10-18 12:00", true},
+		{"* * 19 * sat", "2026-10-19 12:00", true},
+		{"* * 20 * mon", "2026-10-19 12:00", true},
+		{"* * 20 * tue", "2026-10-19 12:00", false},
+		{"* * 19 nov *", "2026-10-19 12:00", false},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match := s.Match(at(tc.time)); match != tc.match {
+			t.Fatalf("%q at %s: expected %v", tc.expr, tc.time, tc.match)
+		}
+	}
+}
@@ -23,6 +23,7 @@ package endpoint
 import (
 	"errors"
 	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -61,6 +62,10 @@ const (
 	NATS = Protocol("nats")
 	// EventHub protocol
 	EventHub = Protocol("sb")
+	// File protocol
+	File = Protocol("file")
+	// Unix socket protocol
+	Unix = Protocol("unix")
 )
 
 // Endpoint represents an endpoint.
@@ -83,6 +88,8 @@ type Endpoint struct {
 		Host    string
 		Port    int
 		Channel string
+		XAdd    bool
+		MaxLen  int
 	}
 	Kafka struct {
 		Host       string
@@ -145,6 +152,7 @@ type Endpoint struct {
 		TLS     bool
 		TLSCert string
 		TLSKey  string
+		JS      bool
 	}
 	EventHub struct {
 		ConnectionString string
@@ -152,6 +160,15 @@ type Endpoint struct {
 	Local struct {
 		Channel string
 	}
+	File struct {
+		Path    string
+		MaxSize int64
+		MaxAge  time.Duration
+		Gzip    bool
+	}
+	Unix struct {
+		Path string
+	}
 }
 
 // Conn is an endpoint connection
@@ -160,11 +177,28 @@ type Conn interface {
 	Send(val string) error
 }
 
+// MessageConn is an endpoint connection that encodes messages itself,
+// such as HTTP which sets headers according to the message format.
+type MessageConn interface {
+	Conn
+	SendMessage(msg *Message) error
+}
+
+// BatchConn is an endpoint connection that can deliver many messages in
+// one request. A non-nil error means that none of the messages were sent,
+// otherwise the indexes of messages that failed are returned.
+type BatchConn interface {
+	Conn
+	SendBatch(msgs []*Message) (failed []int, err error)
+}
+
 // Manager manages all endpoints
 type Manager struct {
 	mu        sync.RWMutex
 	conns     map[string]Conn
 	publisher LocalPublisher
+	fileDir   string // base directory of file endpoints, empty for none
+	unix      bool   // unix endpoints are allowed
 }
 
 // NewManager returns a new manager
@@ -193,55 +227,98 @@ func (epc *Manager) Run() {
 	}
 }
 
+// AllowFiles lets file endpoints write below dir. File endpoints are
+// refused when dir is empty, which is the default.
+func (epc *Manager) AllowFiles(dir string) error {
+	if dir != "" {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return err
+		}
+	}
+	epc.mu.Lock()
+	epc.fileDir = dir
+	epc.mu.Unlock()
+	return nil
+}
+
+// AllowUnix lets unix endpoints connect to local sockets. They are refused
+// by default.
+func (epc *Manager) AllowUnix(allow bool) {
+	epc.mu.Lock()
+	epc.unix = allow
+	epc.mu.Unlock()
+}
+
 // Validate an endpoint url
 func (epc *Manager) Validate(url string) error {
-	_, err := parseEndpoint(url)
-	return err
+	ep, err := parseEndpoint(url)
+	if err != nil {
+		return err
+	}
+	epc.mu.RLock()
+	defer epc.mu.RUnlock()
+	return epc.checkLocal(&ep)
+}
+
+// checkLocal refuses file and unix endpoints that are not allowed, and
+// resolves the path of a file endpoint below the file directory.
+func (epc *Manager) checkLocal(ep *Endpoint) error {
+	switch ep.Protocol {
+	case File:
+		if epc.fileDir == "" {
+			return errors.New("file endpoints are not enabled")
+		}
+		path, err := resolveFilePath(epc.fileDir, ep.File.Path)
+		if err != nil {
+			return err
+		}
+		ep.File.Path = path
+	case Unix:
+		if !epc.unix {
+			return errors.New("unix endpoints are not enabled")
+		}
+	}
+	return nil
+}
+
+// resolveFilePath returns the path of a file below dir. A relative path is
+// joined to dir, and an absolute path must already be below dir.
+func resolveFilePath(dir, path string) (string, error) {
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem == ".." {
+			return "", errors.New("invalid path")
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("path is outside of the file endpoint directory")
+	}
+	return path, nil
 }
 
 // Send send a message to an endpoint
 func (epc *Manager) Send(endpoint, msg string) error {
+	return epc.SendMessage(endpoint, &Message{Event: msg, Value: msg})
+}
+
+// SendMessage sends a formatted message to an endpoint
+func (epc *Manager) SendMessage(endpoint string, msg *Message) error {
 	for {
-		epc.mu.Lock()
-		conn, exists := epc.conns[endpoint]
-		if !exists || conn.Expired() {
-			ep, err := parseEndpoint(endpoint)
-			if err != nil {
-				epc.mu.Unlock()
-				return err
-			}
-			switch ep.Protocol {
-			default:
-				return errors.New("invalid protocol")
-			case HTTP:
-				conn = newHTTPConn(ep)
-			case Disque:
-				conn = newDisqueConn(ep)
-			case GRPC:
-				conn = newGRPCConn(ep)
-			case Redis:
-				conn = newRedisConn(ep)
-			case Kafka:
-				conn = newKafkaConn(ep)
-			case MQTT:
-				conn = newMQTTConn(ep)
-			case AMQP:
-				conn = newAMQPConn(ep)
-			case PubSub:
-				conn = newPubSubConn(ep)
-			case SQS:
-				conn = newSQSConn(ep)
-			case NATS:
-				conn = newNATSConn(ep)
-			case Local:
-				conn = newLocalConn(ep, epc.publisher)
-			case EventHub:
-				conn = newEventHubConn(ep)
-			}
-			epc.conns[endpoint] = conn
-		}
-		epc.mu.Unlock()
-		err := conn.Send(msg)
+		conn, err := epc.conn(endpoint)
+		if err != nil {
+			return err
+		}
+		if mconn, ok := conn.(MessageConn); ok {
+			err = mconn.SendMessage(msg)
+		} else {
+			err = conn.Send(msg.Encode())
+		}
 		if err != nil {
 			if err == errExpired {
 				// it's possible that the connection has expired in-between
@@ -255,6 +332,91 @@ func (epc *Manager) Send(endpoint, msg string) error {
 	}
 }
 
+// SendBatch sends a batch of messages to an endpoint. Endpoints that cannot
+// send batches are sent the messages one at a time, stopping at the first
+// failure. The indexes of the messages that were not delivered are returned.
+func (epc *Manager) SendBatch(endpoint string, msgs []*Message) (
+	failed []int, err error,
+) {
+	for {
+		conn, err := epc.conn(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		bconn, ok := conn.(BatchConn)
+		if !ok {
+			break
+		}
+		failed, err = bconn.SendBatch(msgs)
+		if err == errExpired {
+			continue
+		}
+		return failed, err
+	}
+	for i, msg := range msgs {
+		if err := epc.SendMessage(endpoint, msg); err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			for ; i < len(msgs); i++ {
+				failed = append(failed, i)
+			}
+			break
+		}
+	}
+	return failed, nil
+}
+
+// conn returns the connection for an endpoint, opening a new one if needed
+func (epc *Manager) conn(endpoint string) (Conn, error) {
+	epc.mu.Lock()
+	defer epc.mu.Unlock()
+	conn, exists := epc.conns[endpoint]
+	if !exists || conn.Expired() {
+		ep, err := parseEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if err := epc.checkLocal(&ep); err != nil {
+			return nil, err
+		}
+		switch ep.Protocol {
+		default:
+			return nil, errors.New("invalid protocol")
+		case HTTP:
+			conn = newHTTPConn(ep)
+		case Disque:
+			conn = newDisqueConn(ep)
+		case GRPC:
+			conn = newGRPCConn(ep)
+		case Redis:
+			conn = newRedisConn(ep)
+		case Kafka:
+			conn = newKafkaConn(ep)
+		case MQTT:
+			conn = newMQTTConn(ep)
+		case AMQP:
+			conn = newAMQPConn(ep)
+		case PubSub:
+			conn = newPubSubConn(ep)
+		case SQS:
+			conn = newSQSConn(ep)
+		case NATS:
+			conn = newNATSConn(ep)
+		case Local:
+			conn = newLocalConn(ep, epc.publisher)
+		case EventHub:
+			conn = newEventHubConn(ep)
+		case File:
+			conn = newFileConn(ep)
+		case Unix:
+			conn = newUnixConn(ep)
+		}
+		epc.conns[endpoint] = conn
+	}
+	return conn, nil
+}
+
 func parseEndpoint(s string) (Endpoint, error) {
 	var endpoint Endpoint
 	endpoint.Original = s
@@ -294,6 +456,10 @@ func parseEndpoint(s string) (Endpoint, error) {
 		endpoint.Protocol = NATS
 	case strings.HasPrefix(s, "Endpoint="):
 		endpoint.Protocol = EventHub
+	case strings.HasPrefix(s, "file:"):
+		endpoint.Protocol = File
+	case strings.HasPrefix(s, "unix:"):
+		endpoint.Protocol = Unix
 	}
 
 	s = s[strings.Index(s, ":")+1:]
@@ -302,6 +468,55 @@ func parseEndpoint(s string) (Endpoint, error) {
 	}
 
 	sqp := strings.Split(s[2:], "?")
+
+	// Newline delimited JSON file, where a relative path is below the file
+	// endpoint directory
+	// file:///<path>?maxsize=<size>&maxage=<duration>&gzip=1
+	// file://<relative path>?maxsize=<size>&maxage=<duration>&gzip=1
+	//
+	// Unix domain socket
+	// unix:///<path>
+	if endpoint.Protocol == File || endpoint.Protocol == Unix {
+		path, err := url.PathUnescape(sqp[0])
+		if err != nil || path == "" || path == "/" {
+			return endpoint, errors.New("invalid path")
+		}
+		if endpoint.Protocol == Unix {
+			if !strings.HasPrefix(path, "/") {
+				return endpoint, errors.New("invalid path")
+			}
+			endpoint.Unix.Path = path
+			return endpoint, nil
+		}
+		endpoint.File.Path = path
+		if len(sqp) > 1 {
+			m, err := url.ParseQuery(sqp[1])
+			if err != nil {
+				return endpoint, errors.New("invalid file url")
+			}
+			for key, val := range m {
+				if len(val) == 0 {
+					continue
+				}
+				switch key {
+				case "maxsize":
+					endpoint.File.MaxSize, err = parseByteSize(val[0])
+					if err != nil {
+						return endpoint, errors.New("invalid file maxsize")
+					}
+				case "maxage":
+					endpoint.File.MaxAge, err = time.ParseDuration(val[0])
+					if err != nil || endpoint.File.MaxAge < 0 {
+						return endpoint, errors.New("invalid file maxage")
+					}
+				case "gzip":
+					endpoint.File.Gzip = queryBool(val[0])
+				}
+			}
+		}
+		return endpoint, nil
+	}
+
 	sp := strings.Split(sqp[0], "/")
 	s = sp[0]
 	if s == "" {
@@ -358,6 +573,29 @@ func parseEndpoint(s string) (Endpoint, error) {
 				return endpoint, errors.New("invalid redis channel name")
 			}
 		}
+
+		// Redis Streams
+		// redis://<host>:<port>/<stream>?xadd=1&maxlen=<n>
+		if len(sqp) > 1 {
+			m, err := url.ParseQuery(sqp[1])
+			if err != nil {
+				return endpoint, errors.New("invalid redis url")
+			}
+			for key, val := range m {
+				if len(val) == 0 {
+					continue
+				}
+				switch key {
+				case "xadd":
+					endpoint.Redis.XAdd = queryBool(val[0])
+				case "maxlen":
+					endpoint.Redis.MaxLen = queryInt(val[0])
+				}
+			}
+		}
+		if endpoint.Redis.XAdd && endpoint.Redis.Channel == "" {
+			return endpoint, errors.New("missing redis stream name")
+		}
 	}
 
 	if endpoint.Protocol == Disque {
@@ -729,6 +967,7 @@ func parseEndpoint(s string) (Endpoint, error) {
 	//
 	// user - username
 	// pass - password
+	// js   - publish to JetStream and wait for the ack
 	// when user or pass is not set then login without password is used
 	if endpoint.Protocol == NATS {
 		// Parsing connection from URL string
@@ -778,6 +1017,8 @@ func parseEndpoint(s string) (Endpoint, error) {
 					endpoint.NATS.TLSCert = val[0]
 				case "tlskey":
 					endpoint.NATS.TLSKey = val[0]
+				case "js":
+					endpoint.NATS.JS = queryBool(val[0])
 				}
 			}
 		}
@@ -810,6 +1051,27 @@ func parseEndpoint(s string) (Endpoint, error) {
 	return endpoint, nil
 }
 
+// parseByteSize parses a size such as "1024", "512KB", "100MB" or "1GB"
+func parseByteSize(s string) (int64, error) {
+	mult := int64(1)
+	us := strings.ToUpper(s)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(us, unit.suffix) {
+			mult = unit.mult
+			us = us[:len(us)-len(unit.suffix)]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(us), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size")
+	}
+	return n * mult, nil
+}
+
 func queryInt(s string) int {
 	x, _ := strconv.ParseInt(s, 10, 64)
 	return int(x)
@@ -0,0 +1,190 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/log"
+)
+
+const fileExpiresAfter = time.Second * 30
+
+// FileConn is an endpoint connection that appends newline delimited JSON
+// to a file. The file is rotated when it grows larger than MaxSize or older
+// than MaxAge, and rotated files may be compressed with gzip. The age is
+// taken from the file itself, so that it carries over reopening the file
+// and restarting the server.
+type FileConn struct {
+	mu      sync.Mutex
+	ep      Endpoint
+	ex      bool
+	t       time.Time
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+func newFileConn(ep Endpoint) *FileConn {
+	return &FileConn{
+		ep: ep,
+		t:  time.Now(),
+	}
+}
+
+// Expired returns true if the connection has expired
+func (conn *FileConn) Expired() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.ex {
+		if time.Since(conn.t) > fileExpiresAfter {
+			conn.close()
+			conn.ex = true
+		}
+	}
+	return conn.ex
+}
+
+func (conn *FileConn) close() {
+	if conn.f != nil {
+		conn.f.Close()
+		conn.f = nil
+	}
+}
+
+// Send sends a message
+func (conn *FileConn) Send(msg string) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.ex {
+		return errExpired
+	}
+	conn.t = time.Now()
+	if conn.f == nil {
+		if err := conn.open(); err != nil {
+			return err
+		}
+	}
+	if conn.needsRotate(len(msg) + 1) {
+		if err := conn.rotate(); err != nil {
+			return err
+		}
+		if err := conn.open(); err != nil {
+			return err
+		}
+	}
+	n, err := conn.f.WriteString(msg + "\n")
+	conn.size += int64(n)
+	if err != nil {
+		conn.close()
+		return err
+	}
+	return nil
+}
+
+func (conn *FileConn) open() error {
+	path := conn.ep.File.Path
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	conn.f = f
+	conn.size = fi.Size()
+	conn.created = fileCreated(path, fi)
+	return nil
+}
+
+func (conn *FileConn) needsRotate(n int) bool {
+	if conn.size == 0 {
+		return false
+	}
+	if conn.ep.File.MaxSize > 0 && conn.size+int64(n) > conn.ep.File.MaxSize {
+		return true
+	}
+	if conn.ep.File.MaxAge > 0 && time.Since(conn.created) > conn.ep.File.MaxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file and renames it using the current time,
+// such as "events-20180101T000000.000.ndjson".
+func (conn *FileConn) rotate() error {
+	conn.close()
+	path := conn.ep.File.Path
+	ext := filepath.Ext(path)
+	rotated := strings.TrimSuffix(path, ext) + "-" +
+		time.Now().UTC().Format("20060102T150405.000") + ext
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	if conn.ep.File.Gzip {
+		go func() {
+			if err := gzipFile(rotated); err != nil {
+				log.Errorf("file endpoint: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// gzipFile compresses a file to path+".gz" and removes the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,190 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileConn(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	epc := NewManager(nil)
+	ep := "file://" + path + "?maxsize=32B&gzip=1"
+	if err := epc.Send(ep, `{"id":"0"}`); err == nil {
+		t.Fatal("expected file endpoints to be refused by default")
+	}
+	if err := epc.AllowFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{`{"id":"1"}`, `{"id":"2"}`, `{"id":"3"}`} {
+		if err := epc.Send(ep, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id":"3"}`+"\n" {
+		t.Fatalf("unexpected file contents %q", data)
+	}
+	// wait for the rotated file to be compressed
+	var rotated []string
+	for i := 0; i < 100; i++ {
+		rotated, _ = filepath.Glob(filepath.Join(dir, "events-*.ndjson.gz"))
+		if len(rotated) == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("expected one rotated file, got %v", rotated)
+	}
+	f, err := os.Open(rotated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id":"1"}`+"\n"+`{"id":"2"}`+"\n" {
+		t.Fatalf("unexpected rotated contents %q", data)
+	}
+	for _, bad := range []string{
+		"file://", "file:///", "file://" + path + "?maxsize=big",
+		"file:///etc/passwd", "file://../events.ndjson",
+		"file://" + dir + "/../events.ndjson", "file://" + dir,
+	} {
+		if err := epc.Validate(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+	// relative paths are below the directory
+	if err := epc.Send("file://sub/events.ndjson", `{"id":"4"}`); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "sub", "events.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		t.Fatalf("unexpected file mode %v", fi.Mode())
+	}
+}
+
+func TestUnixConn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "space.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 2)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rd := bufio.NewReader(c)
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+	epc := NewManager(nil)
+	if err := epc.Validate("unix://" + path); err == nil {
+		t.Fatal("expected unix endpoints to be refused by default")
+	}
+	epc.AllowUnix(true)
+	for _, msg := range []string{`{"id":"1"}`, `{"id":"2"}`} {
+		if err := epc.Send("unix://"+path, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expect := range []string{`{"id":"1"}`, `{"id":"2"}`} {
+		select {
+		case line := <-lines:
+			if line != expect {
+				t.Fatalf("expected %s, got %s", expect, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestFileConnMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	ep := "file://" + path + "?maxage=50ms"
+	send := func(msg string) {
+		t.Helper()
+		// a new manager opens the file again, like after a restart
+		epc := NewManager(nil)
+		if err := epc.AllowFiles(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := epc.Send(ep, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(`{"id":"1"}`)
+	send(`{"id":"2"}`)
+	rotated, _ := filepath.Glob(filepath.Join(dir, "events-*.ndjson"))
+	if len(rotated) != 0 {
+		t.Fatalf("expected no rotated files, got %v", rotated)
+	}
+	time.Sleep(time.Millisecond * 100)
+	send(`{"id":"3"}`)
+	rotated, _ = filepath.Glob(filepath.Join(dir, "events-*.ndjson"))
+	if len(rotated) != 1 {
+		t.Fatalf("expected one rotated file, got %v", rotated)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id":"3"}`+"\n" {
+		t.Fatalf("unexpected file contents %q", data)
+	}
+	if FormatProtobuf.Supports(ep) || !FormatJSON.Supports(ep) {
+		t.Fatal("expected protobuf to be refused for file endpoints")
+	}
+}
@@ -0,0 +1,230 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/hservice"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Format is the encoding of an outgoing message
+type Format int
+
+const (
+	// FormatJSON is the plain JSON message
+	FormatJSON Format = iota
+	// FormatCloudEvents is a CloudEvents 1.0 envelope in structured mode
+	FormatCloudEvents
+	// FormatCloudEventsBinary is a CloudEvents 1.0 message in binary mode.
+	// The attributes are sent as HTTP headers. Other protocols fall back to
+	// structured mode.
+	FormatCloudEventsBinary
+	// FormatProtobuf is an Event as defined in hservice/event.proto
+	FormatProtobuf
+)
+
+// EventSchemaVersion is the version of the protobuf Event schema
+const EventSchemaVersion = 1
+
+const cloudEventsTypePrefix = "net.bhojpur.space.geofence."
+
+// ParseFormat returns the Format for a FORMAT argument
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return FormatJSON, nil
+	case "cloudevents":
+		return FormatCloudEvents, nil
+	case "cloudevents-binary":
+		return FormatCloudEventsBinary, nil
+	case "protobuf":
+		return FormatProtobuf, nil
+	}
+	return FormatJSON, errors.New("invalid format")
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatCloudEvents:
+		return "cloudevents"
+	case FormatCloudEventsBinary:
+		return "cloudevents-binary"
+	case FormatProtobuf:
+		return "protobuf"
+	}
+	return "json"
+}
+
+// Supports returns false when an endpoint cannot carry messages in the
+// format, such as protobuf frames in newline delimited files and sockets.
+func (f Format) Supports(url string) bool {
+	if f == FormatProtobuf {
+		return !strings.HasPrefix(url, "file:") &&
+			!strings.HasPrefix(url, "unix:")
+	}
+	return true
+}
+
+// Message is an outgoing hook message
+type Message struct {
+	// Format is the encoding of the message
+	Format Format
+	// Event is the fence notification that the message was made from
+	Event string
+	// Value is the JSON payload, which may be different from Event when the
+	// hook has a TEMPLATE.
+	Value string
+	// HTTP holds the request settings for HTTP endpoints, if any
+	HTTP *HTTPOptions
+}
+
+// Encode returns the message in its format, for protocols that only carry
+// a message body.
+func (msg *Message) Encode() string {
+	switch msg.Format {
+	case FormatCloudEvents, FormatCloudEventsBinary:
+		return msg.CloudEvent()
+	case FormatProtobuf:
+		return string(msg.Protobuf())
+	}
+	return msg.Value
+}
+
+// ID returns an identifier for the message. Messages that are made from
+// the same fence notification have the same ID, so it can be used to find
+// duplicates of retried messages.
+func (msg *Message) ID() string {
+	sum := sha1.Sum([]byte(msg.Event))
+	return hex.EncodeToString(sum[:])
+}
+
+// CloudEventAttrs returns the CloudEvents context attributes of the message
+func (msg *Message) CloudEventAttrs() [][2]string {
+	res := gjson.GetMany(msg.Event, "detect", "command", "hook", "key", "id",
+		"time")
+	typ := res[0].String()
+	if typ == "" {
+		typ = res[1].String()
+	}
+	attrs := [][2]string{
+		{"specversion", "1.0"},
+		{"id", msg.ID()},
+		{"source", "/hooks/" + res[2].String()},
+		{"type", cloudEventsTypePrefix + typ},
+	}
+	if res[3].String() != "" {
+		attrs = append(attrs, [2]string{"subject",
+			res[3].String() + "/" + res[4].String()})
+	}
+	if res[5].String() != "" {
+		attrs = append(attrs, [2]string{"time", res[5].String()})
+	}
+	return attrs
+}
+
+// CloudEvent returns the message as a CloudEvents structured mode envelope
+func (msg *Message) CloudEvent() string {
+	var buf []byte
+	buf = append(buf, '{')
+	for _, attr := range msg.CloudEventAttrs() {
+		buf = appendJSONString(buf, attr[0])
+		buf = append(buf, ':')
+		buf = appendJSONString(buf, attr[1])
+		buf = append(buf, ',')
+	}
+	buf = append(buf, `"datacontenttype":"application/json","data":`...)
+	if gjson.Valid(msg.Value) {
+		buf = append(buf, msg.Value...)
+	} else {
+		buf = appendJSONString(buf, msg.Value)
+	}
+	buf = append(buf, '}')
+	return string(buf)
+}
+
+// ProtoEvent returns the message as an Event of the EventService. Strings
+// that are not valid UTF-8, which proto3 does not allow, have the invalid
+// bytes replaced.
+func (msg *Message) ProtoEvent() *hservice.Event {
+	res := gjson.GetMany(msg.Event, "command", "group", "detect", "hook",
+		"key", "id", "time", "object", "fields", "meta")
+	str := func(s string) string {
+		return strings.ToValidUTF8(s, "\uFFFD")
+	}
+	event := &hservice.Event{
+		Version: EventSchemaVersion,
+		Command: str(res[0].String()),
+		Group:   str(res[1].String()),
+		Detect:  str(res[2].String()),
+		Hook:    str(res[3].String()),
+		Key:     str(res[4].String()),
+		Id:      str(res[5].String()),
+		Json:    str(msg.Value),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, res[6].String()); err == nil {
+		event.Time = t.UnixNano()
+	}
+	if res[7].Exists() {
+		event.Object = str(res[7].Raw)
+	}
+	res[8].ForEach(func(key, val gjson.Result) bool {
+		if event.Fields == nil {
+			event.Fields = make(map[string]float64)
+		}
+		event.Fields[str(key.String())] = val.Float()
+		return true
+	})
+	res[9].ForEach(func(key, val gjson.Result) bool {
+		if event.Meta == nil {
+			event.Meta = make(map[string]string)
+		}
+		event.Meta[str(key.String())] = str(val.String())
+		return true
+	})
+	return event
+}
+
+// Protobuf returns the message as a protobuf encoded Event
+func (msg *Message) Protobuf() []byte {
+	b, _ := proto.Marshal(msg.ProtoEvent())
+	return b
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] == '\\' || s[i] == '"' || s[i] > 126 {
+			d, _ := json.Marshal(s)
+			return append(b, string(d)...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	b = append(b, '"')
+	return b
+}
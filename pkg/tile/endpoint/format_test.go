@@ -0,0 +1,64 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/space/pkg/tile/hservice"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageProtobuf(t *testing.T) {
+	event := `{"command":"set","group":"g1","detect":"enter","hook":"h1",` +
+		`"key":"fleet","time":"2021-01-02T03:04:05.000000006Z","id":"truck1",` +
+		`"object":{"type":"Point","coordinates":[1,2]},` +
+		`"fields":{"speed":55},"meta":{"owner":"me"}}`
+	msg := &Message{Format: FormatProtobuf, Event: event, Value: event}
+	var e hservice.Event
+	if err := proto.Unmarshal(msg.Protobuf(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != EventSchemaVersion || e.Command != "set" ||
+		e.Group != "g1" || e.Detect != "enter" || e.Hook != "h1" ||
+		e.Key != "fleet" || e.Id != "truck1" || e.Json != event {
+		t.Fatalf("unexpected event %v", &e)
+	}
+	if e.Time != 1609556645000000006 {
+		t.Fatalf("expected time 1609556645000000006, got %d", e.Time)
+	}
+	if e.Object != `{"type":"Point","coordinates":[1,2]}` {
+		t.Fatalf("unexpected object %q", e.Object)
+	}
+	if e.Fields["speed"] != 55 || e.Meta["owner"] != "me" {
+		t.Fatalf("unexpected fields %v or meta %v", e.Fields, e.Meta)
+	}
+
+	// invalid UTF-8 must not prevent the event from being encoded
+	msg = &Message{Event: `{"id":"a` + "\xff" + `"}`, Value: "\xff"}
+	e.Reset()
+	if err := proto.Unmarshal(msg.Protobuf(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Id != "a�" || e.Json != "�" {
+		t.Fatalf("unexpected id %q or json %q", e.Id, e.Json)
+	}
+}
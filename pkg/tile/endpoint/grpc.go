@@ -41,6 +41,7 @@ type GRPCConn struct {
 	t     time.Time
 	conn  *grpc.ClientConn
 	sconn hservice.HookServiceClient
+	econn hservice.EventServiceClient
 }
 
 func newGRPCConn(ep Endpoint) *GRPCConn {
@@ -73,6 +74,12 @@ func (conn *GRPCConn) close() {
 
 // Send sends a message
 func (conn *GRPCConn) Send(msg string) error {
+	return conn.SendMessage(&Message{Event: msg, Value: msg})
+}
+
+// SendMessage sends a formatted message. Protobuf messages are sent to the
+// EventService, all others to the HookService.
+func (conn *GRPCConn) SendMessage(msg *Message) error {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 	if conn.ex {
@@ -88,13 +95,26 @@ func (conn *GRPCConn) Send(msg string) error {
 			return err
 		}
 		conn.sconn = hservice.NewHookServiceClient(conn.conn)
+		conn.econn = hservice.NewEventServiceClient(conn.conn)
 	}
-	r, err := conn.sconn.Send(context.Background(), &hservice.MessageRequest{Value: msg})
-	if err != nil {
-		conn.close()
-		return err
+	var ok bool
+	if msg.Format == FormatProtobuf {
+		r, err := conn.econn.Send(context.Background(), msg.ProtoEvent())
+		if err != nil {
+			conn.close()
+			return err
+		}
+		ok = r.Ok
+	} else {
+		r, err := conn.sconn.Send(context.Background(),
+			&hservice.MessageRequest{Value: msg.Encode()})
+		if err != nil {
+			conn.close()
+			return err
+		}
+		ok = r.Ok
 	}
-	if !r.Ok {
+	if !ok {
 		conn.close()
 		return errors.New("invalid grpc reply")
 	}
@@ -22,11 +22,16 @@ package endpoint
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/bhojpur/space/pkg/tile/webhook"
 )
 
 const (
@@ -35,23 +40,106 @@ const (
 	httpMaxIdleConnections = 20
 )
 
+// HTTPOptions are the per hook settings for HTTP requests
+type HTTPOptions struct {
+	// Secret signs the request body with HMAC-SHA256, when not empty
+	Secret string
+	// Headers are static headers that are added to each request
+	Headers [][2]string
+	// CertFile and KeyFile are the client certificate for mutual TLS
+	CertFile string
+	KeyFile  string
+	// CACertFile is used to verify the server certificate
+	CACertFile string
+}
+
+type httpTLSKey struct {
+	certFile, keyFile, caCertFile string
+}
+
+// modTimes returns the modification times of the files, which change when
+// a certificate is rotated.
+func (key httpTLSKey) modTimes() (mtimes [3]time.Time) {
+	for i, file := range []string{key.certFile, key.keyFile, key.caCertFile} {
+		if file == "" {
+			continue
+		}
+		if fi, err := os.Stat(file); err == nil {
+			mtimes[i] = fi.ModTime()
+		}
+	}
+	return mtimes
+}
+
+type httpTLSClient struct {
+	client *http.Client
+	mtimes [3]time.Time // of the files the client was loaded from
+}
+
 // HTTPConn is an endpoint connection
 type HTTPConn struct {
-	ep     Endpoint
-	client *http.Client
+	mu      sync.Mutex
+	ep      Endpoint
+	client  *http.Client
+	clients map[httpTLSKey]httpTLSClient // clients with TLS settings
 }
 
 func newHTTPConn(ep Endpoint) *HTTPConn {
 	return &HTTPConn{
-		ep: ep,
-		client: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: httpMaxIdleConnections,
-				IdleConnTimeout:     httpExpiresAfter,
-			},
-			Timeout: httpRequestTimeout,
+		ep:     ep,
+		client: newHTTPClient(nil),
+	}
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: httpMaxIdleConnections,
+			IdleConnTimeout:     httpExpiresAfter,
+			TLSClientConfig:     tlsConfig,
 		},
+		Timeout: httpRequestTimeout,
+	}
+}
+
+// clientFor returns the client for the TLS settings in opts. The client is
+// reloaded when any of its files have been modified.
+func (conn *HTTPConn) clientFor(opts *HTTPOptions) (*http.Client, error) {
+	if opts == nil || (opts.CertFile == "" && opts.CACertFile == "") {
+		return conn.client, nil
+	}
+	key := httpTLSKey{opts.CertFile, opts.KeyFile, opts.CACertFile}
+	mtimes := key.modTimes()
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	cached, ok := conn.clients[key]
+	if ok && cached.mtimes == mtimes {
+		return cached.client, nil
+	}
+	tlsConfig := &tls.Config{}
+	if opts.CertFile != "" {
+		certificates, err := loadClientTLSCert(opts.KeyFile, opts.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = certificates
 	}
+	if opts.CACertFile != "" {
+		caCertPool, err := loadRootTLSCert(opts.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = &caCertPool
+	}
+	if ok {
+		cached.client.CloseIdleConnections()
+	}
+	if conn.clients == nil {
+		conn.clients = make(map[httpTLSKey]httpTLSClient)
+	}
+	client := newHTTPClient(tlsConfig)
+	conn.clients[key] = httpTLSClient{client, mtimes}
+	return client, nil
 }
 
 // Expired returns true if the connection has expired
@@ -61,13 +149,94 @@ func (conn *HTTPConn) Expired() bool {
 
 // Send sends a message
 func (conn *HTTPConn) Send(msg string) error {
-	req, err := http.NewRequest("POST", conn.ep.Original, bytes.NewBufferString(msg))
+	return conn.SendMessage(&Message{Event: msg, Value: msg})
+}
+
+// SendMessage sends a formatted message
+func (conn *HTTPConn) SendMessage(msg *Message) error {
+	body, contentType := msg.Value, "application/json"
+	switch msg.Format {
+	case FormatCloudEvents:
+		body = msg.CloudEvent()
+		contentType = "application/cloudevents+json; charset=utf-8"
+	case FormatProtobuf:
+		body = string(msg.Protobuf())
+		contentType = "application/x-protobuf"
+	}
+	var attrs [][2]string
+	if msg.Format == FormatCloudEventsBinary {
+		attrs = msg.CloudEventAttrs()
+	}
+	return conn.post(body, contentType, attrs, msg.HTTP)
+}
+
+// SendBatch sends the messages as a single JSON array. CloudEvents are sent
+// in batched mode. Protobuf messages cannot be batched over HTTP and are
+// sent one at a time.
+func (conn *HTTPConn) SendBatch(msgs []*Message) (failed []int, err error) {
+	if len(msgs) > 0 && msgs[0].Format == FormatProtobuf {
+		for i, msg := range msgs {
+			if err := conn.SendMessage(msg); err != nil {
+				if i == 0 {
+					return nil, err
+				}
+				for ; i < len(msgs); i++ {
+					failed = append(failed, i)
+				}
+				break
+			}
+		}
+		return failed, nil
+	}
+	contentType := "application/json"
+	var buf []byte
+	buf = append(buf, '[')
+	for i, msg := range msgs {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		switch msg.Format {
+		case FormatCloudEvents, FormatCloudEventsBinary:
+			contentType = "application/cloudevents-batch+json; charset=utf-8"
+			buf = append(buf, msg.CloudEvent()...)
+		default:
+			buf = append(buf, msg.Value...)
+		}
+	}
+	buf = append(buf, ']')
+	var opts *HTTPOptions
+	if len(msgs) > 0 {
+		opts = msgs[0].HTTP
+	}
+	return nil, conn.post(string(buf), contentType, nil, opts)
+}
+
+func (conn *HTTPConn) post(body, contentType string, attrs [][2]string,
+	opts *HTTPOptions,
+) error {
+	client, err := conn.clientFor(opts)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", conn.ep.Original, bytes.NewBufferString(body))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := conn.client.Do(req)
+	if opts != nil {
+		for _, header := range opts.Headers {
+			req.Header.Add(header[0], header[1])
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	for _, attr := range attrs {
+		req.Header.Set("ce-"+attr[0], attr[1])
+	}
+	if opts != nil && opts.Secret != "" {
+		req.Header.Set(webhook.SignatureHeader,
+			webhook.Sign(opts.Secret, time.Now(), []byte(body)))
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
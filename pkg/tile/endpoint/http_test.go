@@ -0,0 +1,63 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPConnTLSReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn := newHTTPConn(Endpoint{})
+	opts := &HTTPOptions{CACertFile: path}
+	c1, err := conn.clientFor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 == conn.client {
+		t.Fatal("expected a TLS client")
+	}
+	if c2, _ := conn.clientFor(opts); c2 != c1 {
+		t.Fatal("expected the cached client")
+	}
+	// a rotated certificate is reloaded
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	c3, err := conn.clientFor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 || len(conn.clients) != 1 {
+		t.Fatalf("expected a single reloaded client, got %d", len(conn.clients))
+	}
+	if c4, _ := conn.clientFor(opts); c4 != c3 {
+		t.Fatal("expected the reloaded client to be cached")
+	}
+}
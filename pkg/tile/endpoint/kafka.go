@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -75,6 +76,11 @@ func (conn *KafkaConn) close() {
 
 // Send sends a message
 func (conn *KafkaConn) Send(msg string) error {
+	return conn.SendMessage(&Message{Event: msg, Value: msg})
+}
+
+// SendMessage sends a formatted message
+func (conn *KafkaConn) SendMessage(msg *Message) error {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 
@@ -82,7 +88,60 @@ func (conn *KafkaConn) Send(msg string) error {
 		return errExpired
 	}
 	conn.t = time.Now()
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	_, offset, err := conn.conn.SendMessage(conn.message(msg))
+	if err != nil {
+		conn.close()
+		return err
+	}
+
+	if offset < 0 {
+		conn.close()
+		return errors.New("invalid kafka reply")
+	}
+
+	return nil
+}
+
+// SendBatch sends many messages in one produce request. The indexes of
+// the messages that were rejected by the broker are returned.
+func (conn *KafkaConn) SendBatch(msgs []*Message) (failed []int, err error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
 
+	if conn.ex {
+		return nil, errExpired
+	}
+	conn.t = time.Now()
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+
+	pmsgs := make([]*sarama.ProducerMessage, len(msgs))
+	for i, msg := range msgs {
+		pmsgs[i] = conn.message(msg)
+		pmsgs[i].Metadata = i
+	}
+	err = conn.conn.SendMessages(pmsgs)
+	if err != nil {
+		perrs, ok := err.(sarama.ProducerErrors)
+		if !ok {
+			conn.close()
+			return nil, err
+		}
+		for _, perr := range perrs {
+			failed = append(failed, perr.Msg.Metadata.(int))
+		}
+		sort.Ints(failed)
+	}
+	return failed, nil
+}
+
+// connect opens the producer, if needed. The caller must hold the lock.
+func (conn *KafkaConn) connect() error {
 	if log.Level > 2 {
 		sarama.Logger = lg.New(log.Output(), "[sarama] ", 0)
 	}
@@ -162,29 +221,20 @@ func (conn *KafkaConn) Send(msg string) error {
 		conn.cfg = cfg
 	}
 
+	return nil
+}
+
+func (conn *KafkaConn) message(msg *Message) *sarama.ProducerMessage {
 	// parse json again to get out info for our kafka key
-	key := gjson.Get(msg, "key")
-	id := gjson.Get(msg, "id")
+	key := gjson.Get(msg.Event, "key")
+	id := gjson.Get(msg.Event, "id")
 	keyValue := fmt.Sprintf("%s-%s", key.String(), id.String())
 
-	message := &sarama.ProducerMessage{
+	return &sarama.ProducerMessage{
 		Topic: conn.ep.Kafka.TopicName,
 		Key:   sarama.StringEncoder(keyValue),
-		Value: sarama.StringEncoder(msg),
+		Value: sarama.StringEncoder(msg.Encode()),
 	}
-
-	_, offset, err := conn.conn.SendMessage(message)
-	if err != nil {
-		conn.close()
-		return err
-	}
-
-	if offset < 0 {
-		conn.close()
-		return errors.New("invalid kafka reply")
-	}
-
-	return nil
 }
 
 func newKafkaConn(ep Endpoint) *KafkaConn {
@@ -37,6 +37,7 @@ type NATSConn struct {
 	ex   bool
 	t    time.Time
 	conn *nats.Conn
+	js   nats.JetStreamContext
 }
 
 func newNATSConn(ep Endpoint) *NATSConn {
@@ -65,11 +66,19 @@ func (conn *NATSConn) close() {
 	if conn.conn != nil {
 		conn.conn.Close()
 		conn.conn = nil
+		conn.js = nil
 	}
 }
 
 // Send sends a message
 func (conn *NATSConn) Send(msg string) error {
+	return conn.SendMessage(&Message{Event: msg, Value: msg})
+}
+
+// SendMessage sends a formatted message. In JetStream mode the message
+// is published with a Nats-Msg-Id header, so that the stream drops
+// duplicates of retried messages, and the send waits for the ack.
+func (conn *NATSConn) SendMessage(msg *Message) error {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 	if conn.ex {
@@ -97,7 +106,20 @@ func (conn *NATSConn) Send(msg string) error {
 			return err
 		}
 	}
-	err := conn.conn.Publish(conn.ep.NATS.Topic, []byte(msg))
+	var err error
+	if conn.ep.NATS.JS {
+		if conn.js == nil {
+			conn.js, err = conn.conn.JetStream()
+			if err != nil {
+				conn.close()
+				return err
+			}
+		}
+		_, err = conn.js.Publish(conn.ep.NATS.Topic, []byte(msg.Encode()),
+			nats.MsgId(msg.ID()))
+	} else {
+		err = conn.conn.Publish(conn.ep.NATS.Topic, []byte(msg.Encode()))
+	}
 	if err != nil {
 		conn.close()
 		return err
@@ -86,7 +86,17 @@ func (conn *RedisConn) Send(msg string) error {
 			return err
 		}
 	}
-	_, err := redis.Int(conn.conn.Do("PUBLISH", conn.ep.Redis.Channel, msg))
+	var err error
+	if conn.ep.Redis.XAdd {
+		args := []interface{}{conn.ep.Redis.Channel}
+		if conn.ep.Redis.MaxLen > 0 {
+			args = append(args, "MAXLEN", "~", conn.ep.Redis.MaxLen)
+		}
+		args = append(args, "*", "message", msg)
+		_, err = redis.String(conn.conn.Do("XADD", args...))
+	} else {
+		_, err = redis.Int(conn.conn.Do("PUBLISH", conn.ep.Redis.Channel, msg))
+	}
 	if err != nil {
 		conn.close()
 		return err
@@ -0,0 +1,103 @@
+package endpoint
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhojpur/space/pkg/utils/redcon"
+)
+
+// fakeRedis is a redcon server that records the commands it receives
+type fakeRedis struct {
+	mu   sync.Mutex
+	cmds [][]string
+	addr string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{addr: ln.Addr().String()}
+	go redcon.Serve(ln, func(conn redcon.Conn, cmd redcon.Command) {
+		args := make([]string, len(cmd.Args))
+		for i, arg := range cmd.Args {
+			args[i] = string(arg)
+		}
+		f.mu.Lock()
+		f.cmds = append(f.cmds, args)
+		f.mu.Unlock()
+		switch strings.ToLower(args[0]) {
+		case "publish":
+			conn.WriteInt(1)
+		case "xadd":
+			conn.WriteBulkString("1-0")
+		default:
+			conn.WriteError("ERR unknown command '" + args[0] + "'")
+		}
+	}, nil, nil)
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cmds []string
+	for _, args := range f.cmds {
+		cmds = append(cmds, strings.Join(args, " "))
+	}
+	return cmds
+}
+
+func TestRedisConn(t *testing.T) {
+	f := newFakeRedis(t)
+	epc := NewManager(nil)
+	err := epc.Send("redis://"+f.addr+"/events", `{"id":"1"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = epc.Send("redis://"+f.addr+"/fleet?xadd=1&maxlen=1000", `{"id":"2"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = epc.Send("redis://"+f.addr+"/fleet?xadd=1", `{"id":"3"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`PUBLISH events {"id":"1"}`,
+		`XADD fleet MAXLEN ~ 1000 * message {"id":"2"}`,
+		`XADD fleet * message {"id":"3"}`,
+	}
+	cmds := f.commands()
+	if strings.Join(cmds, "\n") != strings.Join(expect, "\n") {
+		t.Fatalf("expected %q, got %q", expect, cmds)
+	}
+	if err := epc.Validate("redis://" + f.addr + "?xadd=1"); err == nil {
+		t.Fatal("expected an error for a missing stream name")
+	}
+}
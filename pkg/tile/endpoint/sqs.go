@@ -22,6 +22,8 @@ package endpoint
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -33,7 +35,10 @@ import (
 	"github.com/bhojpur/space/pkg/tile/log"
 )
 
-const sqsExpiresAfter = time.Second * 30
+const (
+	sqsExpiresAfter = time.Second * 30
+	sqsMaxBatchSize = 10
+)
 
 // SQSConn is an endpoint connection
 type SQSConn struct {
@@ -83,6 +88,79 @@ func (conn *SQSConn) Send(msg string) error {
 	}
 	conn.t = time.Now()
 
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	queueURL := conn.generateSQSURL()
+	// Send message
+	sendParams := &sqs.SendMessageInput{
+		MessageBody: aws.String(msg),
+		QueueUrl:    aws.String(queueURL),
+	}
+	_, err := conn.svc.SendMessage(sendParams)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// SendBatch sends messages using SendMessageBatch, ten at a time. The
+// indexes of the messages that SQS did not accept are returned.
+func (conn *SQSConn) SendBatch(msgs []*Message) (failed []int, err error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.ex {
+		return nil, errExpired
+	}
+	conn.t = time.Now()
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+
+	queueURL := conn.generateSQSURL()
+	for i := 0; i < len(msgs); i += sqsMaxBatchSize {
+		end := i + sqsMaxBatchSize
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		var entries []*sqs.SendMessageBatchRequestEntry
+		for j := i; j < end; j++ {
+			entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(j)),
+				MessageBody: aws.String(msgs[j].Encode()),
+			})
+		}
+		out, err := conn.svc.SendMessageBatch(&sqs.SendMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: aws.String(queueURL),
+		})
+		if err != nil {
+			// the remaining messages were not sent
+			for j := i; j < len(msgs); j++ {
+				failed = append(failed, j)
+			}
+			if len(failed) == len(msgs) {
+				return nil, err
+			}
+			return failed, nil
+		}
+		var ffailed []int
+		for _, entry := range out.Failed {
+			j, _ := strconv.Atoi(aws.StringValue(entry.Id))
+			ffailed = append(ffailed, j)
+		}
+		sort.Ints(ffailed)
+		failed = append(failed, ffailed...)
+	}
+	return failed, nil
+}
+
+// connect creates the session, if needed. The caller must hold the lock.
+func (conn *SQSConn) connect() error {
 	if conn.svc == nil && conn.session == nil {
 		var creds *credentials.Credentials
 		credPath := conn.ep.SQS.CredPath
@@ -119,18 +197,6 @@ func (conn *SQSConn) Send(msg string) error {
 		conn.svc = svc
 	}
 
-	queueURL := conn.generateSQSURL()
-	// Send message
-	sendParams := &sqs.SendMessageInput{
-		MessageBody: aws.String(msg),
-		QueueUrl:    aws.String(queueURL),
-	}
-	_, err := conn.svc.SendMessage(sendParams)
-	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-
 	return nil
 }
 
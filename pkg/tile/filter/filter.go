@@ -0,0 +1,150 @@
+package filter
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+
+	"github.com/bhojpur/space/pkg/utils/geojson"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+)
+
+// Env is the object that an expression is evaluated against.
+type Env interface {
+	// ID returns the id of the object.
+	ID() string
+	// Object returns the object.
+	Object() geojson.Object
+	// Field returns the value of a field, or false when the collection does
+	// not have the field.
+	Field(name string) (float64, bool)
+}
+
+// Error is an error in an expression.
+type Error struct {
+	Pos int // byte offset of the error in the expression
+	Msg string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", err.Msg, err.Pos+1)
+}
+
+// Expr is a compiled filter expression.
+type Expr struct {
+	src  string
+	eval func(env Env) value
+}
+
+// Compile parses an expression, such as
+//
+//	speed > 10 && (status == 'idle' || battery < 20) && id =~ 'truck*'
+//
+// Identifiers are the fields of the object, or its GeoJSON properties when
+// there is no such field, and "id" is the object id. Expressions that are
+// not boolean, or that mix types where the types are known, are errors.
+func Compile(src string) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	if n.kind != kindBool && n.kind != kindAny {
+		return nil, &Error{n.pos, "expected a boolean expression"}
+	}
+	return &Expr{src: src, eval: n.eval}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match returns true if the expression is true for the object. Expressions
+// that compare values of different types, or that use missing values, are
+// false.
+func (e *Expr) Match(env Env) bool {
+	v := e.eval(env)
+	return v.kind == kindBool && v.b
+}
+
+// kind is the type of a value. The kind of an expression is kindAny when its
+// type is only known at evaluation.
+type kind byte
+
+const (
+	kindNull kind = iota
+	kindNumber
+	kindString
+	kindBool
+	kindAny
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	case kindBool:
+		return "boolean"
+	case kindAny:
+		return "any"
+	}
+	return "null"
+}
+
+type value struct {
+	kind kind
+	n    float64
+	s    string
+	b    bool
+}
+
+func numberValue(n float64) value { return value{kind: kindNumber, n: n} }
+func stringValue(s string) value  { return value{kind: kindString, s: s} }
+func boolValue(b bool) value      { return value{kind: kindBool, b: b} }
+
+// lookup returns the value of a field, or of a GeoJSON property when the
+// object has no such field.
+func lookup(env Env, name string) value {
+	if n, ok := env.Field(name); ok {
+		return numberValue(n)
+	}
+	if f, ok := env.Object().(*geojson.Feature); ok {
+		res := gjson.Get(f.Members(), "properties."+name)
+		switch res.Type {
+		case gjson.Number:
+			return numberValue(res.Num)
+		case gjson.String:
+			return stringValue(res.Str)
+		case gjson.True, gjson.False:
+			return boolValue(res.Bool())
+		}
+	}
+	return value{}
+}
@@ -0,0 +1,111 @@
+package filter
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/space/pkg/utils/geojson"
+)
+
+type testEnv struct {
+	id     string
+	obj    geojson.Object
+	fields map[string]float64
+}
+
+func (env *testEnv) ID() string             { return env.id }
+func (env *testEnv) Object() geojson.Object { return env.obj }
+func (env *testEnv) Field(name string) (float64, bool) {
+	v, ok := env.fields[name]
+	return v, ok
+}
+
+func TestMatch(t *testing.T) {
+	obj, err := geojson.Parse(`{"type":"Feature","geometry":`+
+		`{"type":"Point","coordinates":[-112.0,33.0]},`+
+		`"properties":{"status":"idle","active":true,"load":7}}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{"truck1", obj, map[string]float64{"speed": 12, "battery": 50}}
+	for _, tc := range []struct {
+		expr  string
+		match bool
+	}{
+		{"speed > 10", true},
+		{"speed > 10 && (status == 'idle' || battery < 20) && id =~ 'truck*'", true},
+		{"speed > 10 && (status == 'moving' || battery < 20)", false},
+		{"id !~ 'truck*'", false},
+		{"!(speed <= 10)", true},
+		{"speed * 2 + 1 == 25 && speed % 5 == 2 && -speed < 0", true},
+		{"active && load >= 7", true},
+		{"missing > 0", false},
+		{"missing != 1", false},
+		{"missing == null", false},
+		{"missing == other", false},
+		{"!(missing == 1)", true},
+		{"status > 5", false},
+		{"max(speed, battery) == 50 && abs(-2) == 2 && pow(2, 3) == 8", true},
+		{"round(lat()) == 33 && round(lon()) == -112", true},
+		{"distance(33.0, -112.0) < 1 && distance(33.01, -112.0) > 1000", true},
+		{`"it's" == 'it\'s'`, true},
+		{"1e3 == 1000 && .5 == 0.5", true},
+	} {
+		expr, err := Compile(tc.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.expr, err)
+		}
+		if match := expr.Match(env); match != tc.match {
+			t.Fatalf("%q: expected %v, got %v", tc.expr, tc.match, match)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression at position 1"},
+		{"speed > 10 && (status == 'idle'", "expected ')' at position 32"},
+		{"speed = 10", "unexpected '=', did you mean '==' at position 7"},
+		{"speed > 'abc", "unterminated string at position 9"},
+		{"speed + 1", "expected a boolean expression at position 1"},
+		{"1 == 'a'", "cannot compare a number and a string at position 3"},
+		{"id > 5", "cannot compare a string and a number at position 4"},
+		{"id + 1 > 0", "expected a number, got a string at position 1"},
+		{"speed > 10 && 5", "expected a boolean, got a number at position 15"},
+		{"foo(1) > 0", "unknown function 'foo' at position 1"},
+		{"abs(1, 2) > 0", "function 'abs' takes 1 arguments, got 2 at position 1"},
+		{"speed > 10 )", "unexpected ')' at position 12"},
+		{"speed # 10", "unexpected '#' at position 7"},
+	} {
+		_, err := Compile(tc.expr)
+		if err == nil {
+			t.Fatalf("%q: expected error", tc.expr)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%q: expected %q, got %q", tc.expr, tc.err, err)
+		}
+	}
+}
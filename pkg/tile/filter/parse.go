@@ -0,0 +1,617 @@
+package filter
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bhojpur/space/pkg/tile/glob"
+	"github.com/bhojpur/space/pkg/utils/geojson/geo"
+)
+
+type tokenKind byte
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // operator, identifier, or unquoted string
+	num  float64
+	pos  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+// operators, longest first
+var operators = []string{
+	"||", "&&", "==", "!=", "<=", ">=", "=~", "!~",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ",",
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n", l.src[l.pos]) != -1 {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case isIdentStart(c):
+		for l.pos < len(l.src) &&
+			(isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) &&
+		isDigit(l.src[l.pos+1])):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+			l.pos++
+			if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+				l.pos++
+			}
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		}
+		n, err := strconv.ParseFloat(l.src[start:l.pos], 64)
+		if err != nil {
+			return token{}, &Error{start, fmt.Sprintf("invalid number '%s'",
+				l.src[start:l.pos])}
+		}
+		return token{kind: tokNumber, num: n, pos: start}, nil
+	case c == '\'' || c == '"':
+		var sb strings.Builder
+		l.pos++
+		for l.pos < len(l.src) {
+			ch := l.src[l.pos]
+			if ch == c {
+				l.pos++
+				return token{kind: tokString, text: sb.String(), pos: start}, nil
+			}
+			if ch == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+				ch = l.src[l.pos]
+			}
+			sb.WriteByte(ch)
+			l.pos++
+		}
+		return token{}, &Error{start, "unterminated string"}
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	if c == '=' {
+		return token{}, &Error{start, "unexpected '=', did you mean '=='"}
+	}
+	return token{}, &Error{start, fmt.Sprintf("unexpected '%c'", c)}
+}
+
+// node is a compiled expression and its type, which is kindAny when it is
+// only known at evaluation.
+type node struct {
+	kind kind
+	pos  int
+	eval func(env Env) value
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) unexpected() error {
+	switch p.tok.kind {
+	case tokEOF:
+		return &Error{p.tok.pos, "unexpected end of expression"}
+	case tokNumber:
+		return &Error{p.tok.pos, "unexpected number"}
+	case tokString:
+		return &Error{p.tok.pos, "unexpected string"}
+	}
+	return &Error{p.tok.pos, fmt.Sprintf("unexpected '%s'", p.tok.text)}
+}
+
+func (p *parser) expect(op string) error {
+	if !p.is(op) {
+		return &Error{p.tok.pos, fmt.Sprintf("expected '%s'", op)}
+	}
+	return p.next()
+}
+
+// check returns an error if the type of the node is known and is not k.
+func check(n *node, k kind) error {
+	if n.kind != k && n.kind != kindAny {
+		return &Error{n.pos, fmt.Sprintf("expected a %s, got a %s", k, n.kind)}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := check(left, kindBool); err != nil {
+			return nil, err
+		}
+		if err := check(right, kindBool); err != nil {
+			return nil, err
+		}
+		a, b := left.eval, right.eval
+		left = &node{kindBool, left.pos, func(env Env) value {
+			if v := a(env); v.kind == kindBool && v.b {
+				return v
+			}
+			v := b(env)
+			return boolValue(v.kind == kindBool && v.b)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := check(left, kindBool); err != nil {
+			return nil, err
+		}
+		if err := check(right, kindBool); err != nil {
+			return nil, err
+		}
+		a, b := left.eval, right.eval
+		left = &node{kindBool, left.pos, func(env Env) value {
+			if v := a(env); v.kind != kindBool || !v.b {
+				return boolValue(false)
+			}
+			v := b(env)
+			return boolValue(v.kind == kindBool && v.b)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (*node, error) {
+	if !p.is("!") {
+		return p.parseCompare()
+	}
+	pos := p.tok.pos
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if err := check(n, kindBool); err != nil {
+		return nil, err
+	}
+	eval := n.eval
+	return &node{kindBool, pos, func(env Env) value {
+		v := eval(env)
+		return boolValue(v.kind == kindBool && !v.b)
+	}}, nil
+}
+
+func (p *parser) parseCompare() (*node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return left, nil
+	}
+	op, pos := p.tok.text, p.tok.pos
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return left, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	a, b := left.eval, right.eval
+	switch op {
+	case "=~", "!~":
+		if err := check(left, kindString); err != nil {
+			return nil, err
+		}
+		if err := check(right, kindString); err != nil {
+			return nil, err
+		}
+		want := op == "=~"
+		return &node{kindBool, left.pos, func(env Env) value {
+			va, vb := a(env), b(env)
+			if va.kind != kindString || vb.kind != kindString {
+				return boolValue(false)
+			}
+			ok, _ := glob.Match(vb.s, va.s)
+			return boolValue(ok == want)
+		}}, nil
+	}
+	if left.kind != kindAny && right.kind != kindAny && left.kind != right.kind {
+		return nil, &Error{pos, fmt.Sprintf("cannot compare a %s and a %s",
+			left.kind, right.kind)}
+	}
+	if op == "==" || op == "!=" {
+		want := op == "=="
+		return &node{kindBool, left.pos, func(env Env) value {
+			va, vb := a(env), b(env)
+			if va.kind == kindNull || vb.kind == kindNull {
+				// missing values are neither equal nor unequal
+				return boolValue(false)
+			}
+			return boolValue(equal(va, vb) == want)
+		}}, nil
+	}
+	if left.kind == kindBool || right.kind == kindBool {
+		return nil, &Error{pos, fmt.Sprintf("cannot use '%s' with a boolean", op)}
+	}
+	return &node{kindBool, left.pos, func(env Env) value {
+		c, ok := compare(a(env), b(env))
+		if !ok {
+			return boolValue(false)
+		}
+		switch op {
+		case "<":
+			return boolValue(c < 0)
+		case "<=":
+			return boolValue(c <= 0)
+		case ">":
+			return boolValue(c > 0)
+		}
+		return boolValue(c >= 0)
+	}}, nil
+}
+
+func equal(a, b value) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case kindNumber:
+		return a.n == b.n
+	case kindString:
+		return a.s == b.s
+	case kindBool:
+		return a.b == b.b
+	}
+	return false
+}
+
+// compare returns the order of two numbers or two strings, or false when
+// the values cannot be ordered.
+func compare(a, b value) (int, bool) {
+	if a.kind != b.kind {
+		return 0, false
+	}
+	switch a.kind {
+	case kindNumber:
+		switch {
+		case a.n < b.n:
+			return -1, true
+		case a.n > b.n:
+			return 1, true
+		case a.n == b.n:
+			return 0, true
+		}
+	case kindString:
+		return strings.Compare(a.s, b.s), true
+	}
+	return 0, false
+}
+
+func (p *parser) parseSum() (*node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		if left, err = p.parseArith(left, p.parseProduct); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseProduct() (*node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		if left, err = p.parseArith(left, p.parseUnary); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+// parseArith parses the operator and the right operand of an arithmetic
+// operation. Arithmetic with a value that is not a number is null.
+func (p *parser) parseArith(left *node, operand func() (*node, error),
+) (*node, error) {
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	right, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	if err := check(left, kindNumber); err != nil {
+		return nil, err
+	}
+	if err := check(right, kindNumber); err != nil {
+		return nil, err
+	}
+	a, b := left.eval, right.eval
+	return &node{kindNumber, left.pos, func(env Env) value {
+		va, vb := a(env), b(env)
+		if va.kind != kindNumber || vb.kind != kindNumber {
+			return value{}
+		}
+		switch op {
+		case "+":
+			return numberValue(va.n + vb.n)
+		case "-":
+			return numberValue(va.n - vb.n)
+		case "*":
+			return numberValue(va.n * vb.n)
+		case "/":
+			return numberValue(va.n / vb.n)
+		}
+		return numberValue(math.Mod(va.n, vb.n))
+	}}, nil
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	if !p.is("-") {
+		return p.parsePrimary()
+	}
+	pos := p.tok.pos
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if err := check(n, kindNumber); err != nil {
+		return nil, err
+	}
+	eval := n.eval
+	return &node{kindNumber, pos, func(env Env) value {
+		v := eval(env)
+		if v.kind != kindNumber {
+			return value{}
+		}
+		return numberValue(-v.n)
+	}}, nil
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		v := numberValue(tok.num)
+		return &node{kindNumber, tok.pos, func(Env) value { return v }}, p.next()
+	case tokString:
+		v := stringValue(tok.text)
+		return &node{kindString, tok.pos, func(Env) value { return v }}, p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.is("(") {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true", "false":
+			v := boolValue(tok.text == "true")
+			return &node{kindBool, tok.pos, func(Env) value { return v }}, nil
+		case "null":
+			return &node{kindNull, tok.pos, func(Env) value { return value{} }}, nil
+		case "id":
+			return &node{kindString, tok.pos, func(env Env) value {
+				return stringValue(env.ID())
+			}}, nil
+		}
+		name := tok.text
+		return &node{kindAny, tok.pos, func(env Env) value {
+			return lookup(env, name)
+		}}, nil
+	case tokOp:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			n.pos = tok.pos
+			return n, p.expect(")")
+		}
+	}
+	return nil, p.unexpected()
+}
+
+// funcs are the functions, which all take and return numbers.
+var funcs = map[string]struct {
+	nargs int
+	fn    func(env Env, args []float64) (float64, bool)
+}{
+	"abs":   {1, math1(math.Abs)},
+	"ceil":  {1, math1(math.Ceil)},
+	"floor": {1, math1(math.Floor)},
+	"round": {1, math1(math.Round)},
+	"sqrt":  {1, math1(math.Sqrt)},
+	"min":   {2, math2(math.Min)},
+	"max":   {2, math2(math.Max)},
+	"pow":   {2, math2(math.Pow)},
+	// distance(lat, lon) is the distance in meters from the center of the
+	// object to a point.
+	"distance": {2, func(env Env, args []float64) (float64, bool) {
+		obj := env.Object()
+		if obj == nil {
+			return 0, false
+		}
+		center := obj.Center()
+		return geo.DistanceTo(center.Y, center.X, args[0], args[1]), true
+	}},
+	"lat": {0, func(env Env, args []float64) (float64, bool) {
+		if obj := env.Object(); obj != nil {
+			return obj.Center().Y, true
+		}
+		return 0, false
+	}},
+	"lon": {0, func(env Env, args []float64) (float64, bool) {
+		if obj := env.Object(); obj != nil {
+			return obj.Center().X, true
+		}
+		return 0, false
+	}},
+}
+
+func math1(fn func(float64) float64) func(Env, []float64) (float64, bool) {
+	return func(_ Env, args []float64) (float64, bool) {
+		return fn(args[0]), true
+	}
+}
+
+func math2(fn func(float64, float64) float64) func(Env, []float64) (float64, bool) {
+	return func(_ Env, args []float64) (float64, bool) {
+		return fn(args[0], args[1]), true
+	}
+}
+
+func (p *parser) parseCall(name token) (*node, error) {
+	f, ok := funcs[name.text]
+	if !ok {
+		return nil, &Error{name.pos, fmt.Sprintf("unknown function '%s'",
+			name.text)}
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []func(env Env) value
+	for !p.is(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := check(n, kindNumber); err != nil {
+			return nil, err
+		}
+		args = append(args, n.eval)
+	}
+	if len(args) != f.nargs {
+		return nil, &Error{name.pos, fmt.Sprintf(
+			"function '%s' takes %d arguments, got %d",
+			name.text, f.nargs, len(args))}
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return &node{kindNumber, name.pos, func(env Env) value {
+		nums := make([]float64, len(args))
+		for i, arg := range args {
+			v := arg(env)
+			if v.kind != kindNumber {
+				return value{}
+			}
+			nums[i] = v.n
+		}
+		n, ok := f.fn(env, nums)
+		if !ok {
+			return value{}
+		}
+		return numberValue(n)
+	}}, nil
+}
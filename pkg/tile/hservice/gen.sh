@@ -1,4 +1,9 @@
 #!/bin/bash
 
+# event.proto is generated with protoc-gen-go v1.26.0 and protoc-gen-go-grpc v1.1.0:
+#   go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.26.0
+#   go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.1.0
+
 cd $(dirname "${BASH_SOURCE[0]}")
-protoc --go_out=plugins=grpc,import_path=hservice:. *.proto
\ No newline at end of file
+protoc --go_out=plugins=grpc,import_path=hservice:. hservice.proto
+protoc --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. event.proto
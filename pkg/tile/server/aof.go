@@ -183,20 +183,28 @@ func (s *Server) writeAOF(args []string, d *commandDetails) error {
 		return nil
 	}
 
-	if s.shrinking {
-		nargs := make([]string, len(args))
-		copy(nargs, args)
-		s.shrinklog = append(s.shrinklog, nargs)
-	}
-
-	if s.aof != nil {
-		atomic.StoreInt32(&s.aofdirty, 1) // prewrite optimization flag
-		n := len(s.aofbuf)
-		s.aofbuf = redcon.AppendArray(s.aofbuf, len(args))
-		for _, arg := range args {
-			s.aofbuf = redcon.AppendBulkString(s.aofbuf, arg)
+	cmds := [][]string{args}
+	if d != nil && d.aof != nil {
+		// the command changed less than it was asked to, such as a SET
+		// that was held back by MINMOVE
+		cmds = d.aof
+	}
+	for _, args := range cmds {
+		if s.shrinking {
+			nargs := make([]string, len(args))
+			copy(nargs, args)
+			s.shrinklog = append(s.shrinklog, nargs)
+		}
+
+		if s.aof != nil {
+			atomic.StoreInt32(&s.aofdirty, 1) // prewrite optimization flag
+			n := len(s.aofbuf)
+			s.aofbuf = redcon.AppendArray(s.aofbuf, len(args))
+			for _, arg := range args {
+				s.aofbuf = redcon.AppendBulkString(s.aofbuf, arg)
+			}
+			s.aofsz += len(s.aofbuf) - n
 		}
-		s.aofsz += len(s.aofbuf) - n
 	}
 
 	// notify aof live connections that we have new data
@@ -206,6 +214,9 @@ func (s *Server) writeAOF(args []string, d *commandDetails) error {
 
 	// process geofences
 	if d != nil {
+		// remove the cached searches that may be changed by the write
+		s.qcache.invalidate(d)
+
 		// webhook geofences
 		if s.config.followHost() == "" {
 			// for leader only
@@ -311,28 +322,54 @@ func (s *Server) getQueueCandidates(d *commandDetails) []*Hook {
 }
 
 func (s *Server) queueHooks(d *commandDetails) error {
-	// Create the slices that will store all messages and hooks
-	var cmsgs, wmsgs []string
-	var whooks []*Hook
+	var hooks []*Hook
+	var msgs [][]string
 
 	// Compile a slice of potential hook recipients
 	candidates := s.getQueueCandidates(d)
 	for _, hook := range candidates {
-		// Calculate all matching fence messages for all candidates and append
-		// them to the appropriate message slice
-		msgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, hook.Metas, d)
-		if len(msgs) > 0 {
-			if hook.channel {
-				cmsgs = append(cmsgs, msgs...)
-			} else {
-				wmsgs = append(wmsgs, msgs...)
-				whooks = append(whooks, hook)
+		// Hooks with a schedule only see the updates that happen within
+		// their activation windows, but a density fence keeps counting
+		if hook.schedule != nil && !hook.schedule.activeAt(d.timestamp) {
+			if hook.Fence.density != nil {
+				FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, hook.Metas, d)
 			}
+			continue
+		}
+		// Calculate all matching fence messages for all candidates
+		hmsgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, hook.Metas, d)
+		if len(hmsgs) > 0 {
+			hooks = append(hooks, hook)
+			msgs = append(msgs, hmsgs)
+		}
+	}
+	return s.queueHookMsgs(hooks, msgs)
+}
+
+// queueHookMsgs publishes or queues the messages for each hook, where
+// msgs[i] belongs to hooks[i].
+func (s *Server) queueHookMsgs(hooks []*Hook, msgs [][]string) error {
+	// Create the slices that will store all messages and hooks
+	var cmsgs, wmsgs, pmsgs []string
+	var whooks []*Hook
+
+	// Append the messages to the appropriate message slice
+	for i, hook := range hooks {
+		switch {
+		case hook.paused == hookPauseDrop:
+			// paused and not buffering
+		case hook.paused == hookPauseBuffer:
+			pmsgs = append(pmsgs, msgs[i]...)
+		case hook.channel:
+			cmsgs = append(cmsgs, msgs[i]...)
+		default:
+			wmsgs = append(wmsgs, msgs[i]...)
+			whooks = append(whooks, hook)
 		}
 	}
 
 	// Return nil if there are no messages to be sent
-	if len(cmsgs)+len(wmsgs) == 0 {
+	if len(cmsgs)+len(wmsgs)+len(pmsgs) == 0 {
 		return nil
 	}
 
@@ -345,14 +382,39 @@ func (s *Server) queueHooks(d *commandDetails) error {
 	}
 
 	// Publish all channel messages if any exist
+	var hmsgs []string
+	var hids []int64
+	var hhooks []*Hook
 	if len(cmsgs) > 0 {
 		for _, m := range cmsgs {
-			s.Publish(gjson.Get(m, "hook").String(), m)
+			name := gjson.Get(m, "hook").String()
+			if hook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook); hook != nil {
+				emsg, err := hook.render(m)
+				if err != nil {
+					log.Errorf("channel %s: %v", name, err)
+					continue
+				}
+				m = emsg.Encode()
+				if hook.history != nil {
+					m, id := s.publishChanHistory(hook, m)
+					hmsgs = append(hmsgs, m)
+					hids = append(hids, id)
+					hhooks = append(hhooks, hook)
+					continue
+				}
+			}
+			s.Publish(name, m)
 		}
 	}
 
-	// Queue the webhook messages in the Key/Value database
+	// Queue the webhook messages and the channel history in the Key/Value
+	// database
 	err := s.qdb.Update(func(tx *kvdb.Tx) error {
+		for i, msg := range hmsgs {
+			if err := s.appendChanHistory(tx, hhooks[i], msg, hids[i]); err != nil {
+				return err
+			}
+		}
 		for _, msg := range wmsgs {
 			s.qidx++ // increment the log id
 			key := hookLogPrefix + uint64ToString(s.qidx)
@@ -362,6 +424,15 @@ func (s *Server) queueHooks(d *commandDetails) error {
 			}
 			log.Debugf("queued hook: %d", s.qidx)
 		}
+		// paused hooks keep their messages until they are resumed
+		for _, msg := range pmsgs {
+			s.qidx++ // increment the log id
+			key := hookLogPrefix + uint64ToString(s.qidx)
+			_, _, err := tx.Set(key, msg, hookPausedSetDefaults)
+			if err != nil {
+				return err
+			}
+		}
 		_, _, err := tx.Set("hook:idx", uint64ToString(s.qidx), nil)
 		if err != nil {
 			return err
@@ -369,6 +440,8 @@ func (s *Server) queueHooks(d *commandDetails) error {
 		return nil
 	})
 	if err != nil {
+		// the channel history lengths are counted again
+		s.chlens = make(map[string]int)
 		return err
 	}
 	// all the messages have been queued.
@@ -147,6 +147,10 @@ func (s *Server) aofshrink() {
 								values = append(values, "ex")
 								values = append(values, strconv.FormatFloat(ttl, 'f', -1, 64))
 							}
+							// keep the version for IFVERSION
+							version, _ := col.Version(id)
+							values = append(values, "version")
+							values = append(values, strconv.FormatUint(version, 10))
 							if objIsSpatial(obj) {
 								values = append(values, "object")
 								values = append(values, string(obj.AppendJSON(nil)))
@@ -172,6 +176,23 @@ func (s *Server) aofshrink() {
 							return true
 						},
 					)
+					if idsdone {
+						// keep the versions of the deleted objects from
+						// being used again
+						values = append(values[:0], "setlastversion", keys[0],
+							strconv.FormatUint(col.LastVersion(), 10))
+						// append the values to the aof buffer
+						aofbuf = append(aofbuf, '*')
+						aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
+						aofbuf = append(aofbuf, '\r', '\n')
+						for _, value := range values {
+							aofbuf = append(aofbuf, '$')
+							aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
+							aofbuf = append(aofbuf, '\r', '\n')
+							aofbuf = append(aofbuf, value...)
+							aofbuf = append(aofbuf, '\r', '\n')
+						}
+					}
 
 				}()
 				if len(aofbuf) > maxchunk {
@@ -223,6 +244,9 @@ func (s *Server) aofshrink() {
 					values = append(values, "ex",
 						strconv.FormatFloat(ex, 'f', 1, 64))
 				}
+				for _, opt := range hook.options() {
+					values = append(values, opt...)
+				}
 				values = append(values, hook.Message.Args...)
 				// append the values to the aof buffer
 				aofbuf = append(aofbuf, '*')
@@ -237,6 +261,42 @@ func (s *Server) aofshrink() {
 				}
 			}()
 		}
+
+		// load the default movement thresholds and the last version of the
+		// removed collections
+		func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.colver > 0 {
+				values := []string{"setlastversion",
+					strconv.FormatUint(s.colver, 10)}
+				// append the values to the aof buffer
+				aofbuf = append(aofbuf, '*')
+				aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
+				aofbuf = append(aofbuf, '\r', '\n')
+				for _, value := range values {
+					aofbuf = append(aofbuf, '$')
+					aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
+					aofbuf = append(aofbuf, '\r', '\n')
+					aofbuf = append(aofbuf, value...)
+					aofbuf = append(aofbuf, '\r', '\n')
+				}
+			}
+			for key, mm := range s.minmoves {
+				values := mm.args(key)
+				// append the values to the aof buffer
+				aofbuf = append(aofbuf, '*')
+				aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
+				aofbuf = append(aofbuf, '\r', '\n')
+				for _, value := range values {
+					aofbuf = append(aofbuf, '$')
+					aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
+					aofbuf = append(aofbuf, '\r', '\n')
+					aofbuf = append(aofbuf, value...)
+					aofbuf = append(aofbuf, '\r', '\n')
+				}
+			}
+		}()
 		if len(aofbuf) > 0 {
 			if _, err := f.Write(aofbuf); err != nil {
 				return err
@@ -0,0 +1,106 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhojpur/space/pkg/core"
+)
+
+func TestAOFShrinkVersions(t *testing.T) {
+	defer func(name string) { core.AppendFileName = name }(core.AppendFileName)
+	core.AppendFileName = filepath.Join(t.TempDir(), "appendonly.aof")
+	open := func() *Server {
+		t.Helper()
+		s, _ := newFenceTestServer(t)
+		s.config = &Config{}
+		s.minmoves = make(map[string]minMove)
+		s.fcond = sync.NewCond(&sync.Mutex{})
+		var err error
+		s.aof, err = os.OpenFile(core.AppendFileName, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exec := func(s *Server, args string) {
+		t.Helper()
+		_, _, err := s.command(&Message{Args: strings.Fields(args),
+			OutputType: RESP}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	version := func(s *Server, key, id string) uint64 {
+		t.Helper()
+		col := s.getCol(key)
+		if col == nil {
+			t.Fatalf("missing key %s", key)
+		}
+		v, _ := col.Version(id)
+		return v
+	}
+
+	s := open()
+	for _, args := range []string{
+		"SET fleet a POINT 33 -112", "SET fleet b POINT 33 -112",
+		"SET fleet a POINT 33 -112", "SET fleet a POINT 33 -112",
+		"DEL fleet a",
+	} {
+		exec(s, args)
+	}
+	for i := 0; i < 5; i++ {
+		exec(s, "SET taxis x POINT 33 -112")
+	}
+	exec(s, "DEL taxis x")
+	s.aofshrink()
+	s.aof.Close()
+
+	// the reloaded server does not give out the versions of the deleted
+	// objects again
+	s = open()
+	defer s.aof.Close()
+	if err := s.loadAOF(); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(s, "fleet", "b"); v != 2 {
+		t.Fatalf("expected version 2, got %d", v)
+	}
+	exec(s, "SET fleet a POINT 33 -112")
+	if v := version(s, "fleet", "a"); v != 5 {
+		t.Fatalf("expected version 5, got %d", v)
+	}
+	exec(s, "SET taxis x POINT 33 -112")
+	if v := version(s, "taxis", "x"); v != 6 {
+		t.Fatalf("expected version 6, got %d", v)
+	}
+	// only the aof may set the last version
+	_, _, err := s.command(&Message{Args: []string{"SETLASTVERSION", "100"},
+		OutputType: RESP}, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
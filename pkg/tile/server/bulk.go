@@ -0,0 +1,259 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+// msetObjects splits the arguments of MSET that follow the key into the
+// arguments of each object, in the order that SET takes them. The FIELD
+// options of an object may come before or after its type. A POINT always
+// takes a lat and lon, so that it cannot be confused with the next id.
+func msetObjects(vs []string) ([][]string, error) {
+	var objs [][]string
+	for len(vs) > 0 {
+		obj := []string{vs[0]}
+		vs = vs[1:]
+	options:
+		for len(vs) > 0 {
+			var n int
+			switch strings.ToLower(vs[0]) {
+			case "field":
+				n = 3
+			case "ex", "ifversion", "version", "if", "minmove", "minage":
+				n = 2
+			case "xx", "nx", "withversion":
+				n = 1
+			default:
+				break options
+			}
+			if len(vs) < n {
+				return nil, errInvalidNumberOfArguments
+			}
+			obj = append(obj, vs[:n]...)
+			vs = vs[n:]
+		}
+		if len(vs) == 0 {
+			return nil, errInvalidNumberOfArguments
+		}
+		var n int
+		switch strings.ToLower(vs[0]) {
+		default:
+			return nil, errInvalidArgument(vs[0])
+		case "string", "hash", "object":
+			n = 2
+		case "point":
+			n = 3
+		case "bounds":
+			n = 5
+		}
+		if len(vs) < n {
+			return nil, errInvalidNumberOfArguments
+		}
+		typ := vs[:n]
+		vs = vs[n:]
+		for len(vs) > 0 && strings.ToLower(vs[0]) == "field" {
+			if len(vs) < 3 {
+				return nil, errInvalidNumberOfArguments
+			}
+			obj = append(obj, vs[:3]...)
+			vs = vs[3:]
+		}
+		objs = append(objs, append(obj, typ...))
+	}
+	return objs, nil
+}
+
+// msetObject is a parsed object of MSET.
+type msetObject struct {
+	d      commandDetails
+	fields []string
+	values []float64
+	xx, nx bool
+	opts   setOpts
+	ex     int64
+}
+
+func (s *Server) cmdMset(msg *Message) (res resp.Value, d commandDetails, err error) {
+	if s.config.maxMemory() > 0 && s.outOfMemory.on() {
+		err = errOOM
+		return
+	}
+	start := time.Now()
+	vs := msg.Args[1:]
+	var ok bool
+	if vs, d.key, ok = tokenval(vs); !ok || d.key == "" || len(vs) == 0 {
+		err = errInvalidNumberOfArguments
+		return
+	}
+	objs, err := msetObjects(vs)
+	if err != nil {
+		return
+	}
+	// parse every object before any is set, so that an invalid object
+	// leaves the collection unchanged
+	sets := make([]msetObject, len(objs))
+	for i, args := range objs {
+		m := &sets[i]
+		m.d, m.fields, m.values, m.xx, m.nx, m.opts, m.ex, _, _, err =
+			s.parseSetArgs(append([]string{d.key}, args...))
+		if err != nil {
+			return
+		}
+		if m.opts.setVersion != 0 && !msg.fromAOF() {
+			err = errInvalidArgument("version")
+			return
+		}
+	}
+	now := time.Now()
+	col := s.getCol(d.key)
+	// the conditions of every object are checked against the collection
+	// as it was before the MSET, and nothing is set when one fails
+	for i := range sets {
+		m := &sets[i]
+		if err = m.opts.check(col, m.d.id); err != nil {
+			return
+		}
+		if m.xx || m.nx {
+			var ok bool
+			if col != nil {
+				_, _, _, ok = col.Get(m.d.id)
+			}
+			if m.nx && ok {
+				err = errIDAlreadyExists
+				return
+			}
+			if m.xx && !ok {
+				err = errIDNotFound
+				return
+			}
+		}
+	}
+	if col == nil {
+		col = collection.New()
+		s.setCol(d.key, col)
+	}
+	// the objects that were held back by MINMOVE are left out of the
+	// MSET in the aof, which then only gets their other changes
+	var aof [][]string
+	for i := range sets {
+		m := &sets[i]
+		if mm, ok := s.minMoveOf(msg, d.key, &m.opts); ok &&
+			mm.unmoved(col, m.d.id, m.d.obj, now) {
+			aof = append(aof,
+				setUnmoved(col, &m.d, m.fields, m.values, m.ex, now)...)
+			if m.d.updated {
+				d.children = append(d.children, &m.d)
+			}
+			continue
+		}
+		if n := len(aof); n > 0 && aof[n-1][0] == "mset" {
+			aof[n-1] = append(aof[n-1], objs[i]...)
+		} else {
+			aof = append(aof, append([]string{"mset", d.key}, objs[i]...))
+		}
+		if m.opts.setVersion != 0 {
+			m.d.oldObj, m.d.oldFields, m.d.fields = col.SetWithVersion(m.d.id,
+				m.d.obj, m.fields, m.values, m.ex, m.opts.setVersion)
+		} else {
+			m.d.oldObj, m.d.oldFields, m.d.fields =
+				col.Set(m.d.id, m.d.obj, m.fields, m.values, m.ex)
+		}
+		m.d.command = "set"
+		m.d.updated = true
+		m.d.timestamp = now
+		d.children = append(d.children, &m.d)
+	}
+	if len(d.children) > 0 && (msg.ConnType != Null || msg.OutputType != Null) {
+		// likely loaded from aof at server startup, ignore field remapping.
+		fmap := make(map[string]int)
+		for key, idx := range col.FieldMap() {
+			fmap[key] = idx
+		}
+		for _, dc := range d.children {
+			dc.fmap = fmap
+		}
+	}
+	d.aof = aof
+	d.command = "mset"
+	d.updated = len(d.children) > 0
+	d.timestamp = now
+	d.parent = true
+	switch msg.OutputType {
+	case JSON:
+		res = resp.StringValue(`{"ok":true,"count":` +
+			strconv.Itoa(len(d.children)) +
+			`,"elapsed":"` + time.Since(start).String() + "\"}")
+	case RESP:
+		res = resp.IntegerValue(len(d.children))
+	}
+	return
+}
+
+func (s *Server) cmdMget(msg *Message) (resp.Value, error) {
+	start := time.Now()
+	vs := msg.Args[1:]
+
+	var ok bool
+	var key string
+	if vs, key, ok = tokenval(vs); !ok || key == "" || len(vs) == 0 {
+		return NOMessage, errInvalidNumberOfArguments
+	}
+	col := s.getCol(key)
+	switch msg.OutputType {
+	case JSON:
+		buf := &bytes.Buffer{}
+		buf.WriteString(`{"ok":true,"objects":[`)
+		for i, id := range vs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if col != nil {
+				if o, _, _, ok := col.Get(id); ok {
+					buf.Write(o.AppendJSON(nil))
+					continue
+				}
+			}
+			buf.WriteString("null")
+		}
+		buf.WriteString(`],"elapsed":"` + time.Since(start).String() + "\"}")
+		return resp.StringValue(buf.String()), nil
+	case RESP:
+		vals := make([]resp.Value, len(vs))
+		for i, id := range vs {
+			vals[i] = resp.NullValue()
+			if col != nil {
+				if o, _, _, ok := col.Get(id); ok {
+					vals[i] = resp.StringValue(o.String())
+				}
+			}
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
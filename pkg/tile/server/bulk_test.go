@@ -0,0 +1,101 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsetObjects(t *testing.T) {
+	split := func(s string) []string { return strings.Fields(s) }
+	objs, err := msetObjects(split(
+		"1 POINT 33 -112 FIELD speed 10 " +
+			"2 FIELD speed 5 EX 10 NX BOUNDS 1 2 3 4 " +
+			"3 STRING hello FIELD a 1 FIELD b 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]string{
+		split("1 FIELD speed 10 POINT 33 -112"),
+		split("2 FIELD speed 5 EX 10 NX BOUNDS 1 2 3 4"),
+		split("3 FIELD a 1 FIELD b 2 STRING hello"),
+	}
+	if !reflect.DeepEqual(objs, exp) {
+		t.Fatalf("expected %v, got %v", exp, objs)
+	}
+	for _, args := range []string{
+		"1", "1 FIELD speed", "1 POINT 33", "1 POINT 33 -112 FIELD a",
+		"1 CIRCLE 33 -112 10", "1 EX",
+	} {
+		if _, err := msetObjects(split(args)); err == nil {
+			t.Fatalf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestMsetConditions(t *testing.T) {
+	s, _ := newFenceTestServer(t)
+	s.config = &Config{}
+	mset := func(args string) (commandDetails, error) {
+		t.Helper()
+		_, d, err := s.cmdMset(&Message{
+			Args: strings.Fields("MSET fleet " + args), OutputType: RESP})
+		return d, err
+	}
+	if _, err := mset("truck1 FIELD ts 5 POINT 33 -112 truck2 POINT 34 -111"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args string
+		err  error
+	}{
+		{"truck3 POINT 33 -112 truck1 IFVERSION 5 POINT 33 -112", errVersionMismatch},
+		{"truck3 POINT 33 -112 truck1 IF ts>1 POINT 33 -112", nil},
+		{"truck3 POINT 33 -112 truck1 IF ts>9 POINT 33 -112", errConditionNotMet},
+		{"truck3 POINT 33 -112 truck2 NX POINT 33 -112", errIDAlreadyExists},
+		{"truck3 POINT 33 -112 truck4 XX POINT 33 -112", errIDNotFound},
+	}
+	for i, tt := range tests {
+		if _, err := mset(tt.args); err != tt.err {
+			t.Fatalf("%s: expected %v, got %v", tt.args, tt.err, err)
+		}
+		// a rejected object leaves the others unset
+		_, _, _, ok := s.getCol("fleet").Get("truck3")
+		if ok != (tt.err == nil) {
+			t.Fatalf("%s: expected truck3 set %v", tt.args, tt.err == nil)
+		}
+		if i == 1 {
+			s.getCol("fleet").Delete("truck3")
+		}
+	}
+	// the aof only gets the objects that were set
+	s.minmoves = map[string]minMove{"fleet": {meters: 1000}}
+	d, err := mset("truck1 POINT 33 -112 truck5 POINT 33 -112")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]string{strings.Fields("mset fleet truck5 POINT 33 -112")}
+	if !reflect.DeepEqual(d.aof, exp) {
+		t.Fatalf("expected %v, got %v", exp, d.aof)
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	kvdb "github.com/bhojpur/space/pkg/data/base"
+	"github.com/bhojpur/space/pkg/tile/log"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+	"github.com/bhojpur/space/pkg/utils/sjson"
+)
+
+// chanHistory is the HISTORY option of a channel. It retains either the
+// last count messages or the messages that are younger than age.
+type chanHistory struct {
+	src   string
+	count int
+	age   time.Duration
+}
+
+func parseChanHistory(src string) (*chanHistory, error) {
+	if n, err := strconv.ParseUint(src, 10, 32); err == nil {
+		if n == 0 {
+			return nil, errInvalidArgument(src)
+		}
+		return &chanHistory{src: src, count: int(n)}, nil
+	}
+	age, err := time.ParseDuration(src)
+	if err != nil || age <= 0 {
+		return nil, errInvalidArgument(src)
+	}
+	return &chanHistory{src: src, age: age}, nil
+}
+
+// chanHistoryKey returns the queue key for a channel message. Message ids
+// come from the replay buffer and are the publish time in unix nanoseconds,
+// which keeps the keys ordered and lets a subscriber resume from either an
+// id or a time.
+func chanHistoryKey(name string, id int64) string {
+	return chanLogPrefix + name + ":" + uint64ToString(uint64(id))
+}
+
+// chanHistoryName returns the channel name for a queue key, or false if the
+// key does not belong to a channel history.
+func chanHistoryName(key string) (string, bool) {
+	if !strings.HasPrefix(key, chanLogPrefix) ||
+		len(key) < len(chanLogPrefix)+21 || key[len(key)-21] != ':' {
+		return "", false
+	}
+	return key[len(chanLogPrefix) : len(key)-21], true
+}
+
+// publishChanHistory publishes a message of a channel that has a HISTORY
+// option under a new message id, which JSON messages also carry in their
+// "msg_id" field. It returns the message and id for appendChanHistory.
+func (s *Server) publishChanHistory(hook *Hook, msg string) (string, int64) {
+	id := s.pubsub.replay.nextID()
+	if gjson.Parse(msg).IsObject() {
+		if m, err := sjson.Set(msg, "msg_id", strconv.FormatInt(id, 10)); err == nil {
+			msg = m
+		}
+	}
+	s.publish(hook.Name, []int64{id}, []string{msg})
+	return msg, id
+}
+
+// appendChanHistory stores a published channel message for a channel that
+// has a HISTORY option.
+func (s *Server) appendChanHistory(tx *kvdb.Tx, hook *Hook, msg string,
+	id int64,
+) error {
+	key := chanHistoryKey(hook.Name, id)
+	var opts *kvdb.SetOptions
+	if hook.history.age > 0 {
+		opts = &kvdb.SetOptions{Expires: true, TTL: hook.history.age}
+	}
+	if _, _, err := tx.Set(key, msg, opts); err != nil {
+		return err
+	}
+	if hook.history.count == 0 {
+		return nil
+	}
+	// the length is counted on the first message, then kept up to date
+	n, ok := s.chlens[hook.Name]
+	if ok {
+		n++
+	} else {
+		n = countChanHistory(tx, hook.Name)
+	}
+	for ; n > hook.history.count; n-- {
+		key, ok := oldestChanHistory(tx, hook.Name)
+		if !ok {
+			break
+		}
+		if _, err := tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	s.chlens[hook.Name] = n
+	return nil
+}
+
+// scanChanHistory iterates the stored messages of a channel, oldest first.
+func scanChanHistory(tx *kvdb.Tx, name string, id int64,
+	iter func(key, val string) bool,
+) error {
+	prefix := chanLogPrefix + name + ":"
+	return tx.AscendGreaterOrEqual("", chanHistoryKey(name, id),
+		func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			if n, ok := chanHistoryName(key); ok && n == name {
+				return iter(key, val)
+			}
+			return true
+		})
+}
+
+func countChanHistory(tx *kvdb.Tx, name string) int {
+	var n int
+	scanChanHistory(tx, name, 0, func(_, _ string) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func oldestChanHistory(tx *kvdb.Tx, name string) (oldest string, ok bool) {
+	scanChanHistory(tx, name, 0, func(key, _ string) bool {
+		oldest, ok = key, true
+		return false
+	})
+	return oldest, ok
+}
+
+// parseChanHistoryFrom parses the FROM argument of SUBSCRIBE, which is
+// either a message id or a time, and returns the first message id that
+// should be replayed.
+func parseChanHistoryFrom(from string) (int64, error) {
+	if t, err := time.Parse(time.RFC3339Nano, from); err == nil {
+		if t.UnixNano() < 0 {
+			return 0, nil
+		}
+		return t.UnixNano(), nil
+	}
+	id, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidArgument(from)
+	}
+	return id + 1, nil
+}
+
+// chanHistorySince returns the messages of a channel starting at the
+// message id, in the order that they were published.
+func (s *Server) chanHistorySince(name string, id int64) ([]submsg, error) {
+	var msgs []submsg
+	err := s.qdb.View(func(tx *kvdb.Tx) error {
+		return scanChanHistory(tx, name, id, func(key, val string) bool {
+			id, _ := strconv.ParseInt(key[len(key)-20:], 10, 64)
+			msgs = append(msgs, submsg{
+				kind:     pubsubChannel,
+				channel:  name,
+				message:  val,
+				id:       id,
+				replayed: true,
+			})
+			return true
+		})
+	})
+	return msgs, err
+}
+
+// hasChanHistory returns true when a channel has a HISTORY option.
+func (s *Server) hasChanHistory(channel string) bool {
+	hook, _ := s.hooks.Get(&Hook{Name: channel}).(*Hook)
+	return hook != nil && hook.channel && hook.history != nil
+}
+
+// subscribeFrom registers a channel subscription and queues the stored
+// messages starting at the message id ahead of any live messages.
+func (s *Server) subscribeFrom(channel string, id int64, target *subtarget) error {
+	// Channel messages are published and stored while the server is
+	// locked, so holding the lock keeps the replay and the live messages
+	// from overlapping.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.pubsub.register(pubsubChannel, channel, target)
+	msgs, err := s.chanHistorySince(channel, id)
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+	target.cond.L.Lock()
+	for _, msg := range msgs {
+		msg.target = target
+		target.msgs = append(target.msgs, msg)
+	}
+	target.cond.Broadcast()
+	target.cond.L.Unlock()
+	return nil
+}
+
+// deleteChanHistory removes the stored messages of a channel.
+func (s *Server) deleteChanHistory(name string) {
+	s.purgeChanHistory(func(n string) bool { return n == name })
+}
+
+// sweepChanHistory removes the stored messages of every channel that no
+// longer has a HISTORY option.
+func (s *Server) sweepChanHistory() {
+	s.purgeChanHistory(func(name string) bool {
+		hook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook)
+		return hook == nil || !hook.channel || hook.history == nil
+	})
+}
+
+func (s *Server) purgeChanHistory(drop func(name string) bool) {
+	err := s.qdb.Update(func(tx *kvdb.Tx) error {
+		var dels []string
+		tx.AscendKeys(chanLogPrefix+"*", func(key, _ string) bool {
+			if name, ok := chanHistoryName(key); ok && drop(name) {
+				dels = append(dels, key)
+			}
+			return true
+		})
+		for _, key := range dels {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.chlens = make(map[string]int)
+	if err != nil {
+		log.Errorf("channel history: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	kvdb "github.com/bhojpur/space/pkg/data/base"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+)
+
+func TestChanHistory(t *testing.T) {
+	h, err := parseChanHistory("100")
+	if err != nil || h.count != 100 || h.age != 0 {
+		t.Fatalf("unexpected %+v %v", h, err)
+	}
+	h, err = parseChanHistory("10m")
+	if err != nil || h.count != 0 || h.age != 10*time.Minute {
+		t.Fatalf("unexpected %+v %v", h, err)
+	}
+	for _, src := range []string{"0", "-1s", "abc"} {
+		if _, err := parseChanHistory(src); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+
+	key := chanHistoryKey("bus:stop", 42)
+	if name, ok := chanHistoryName(key); !ok || name != "bus:stop" {
+		t.Fatalf("unexpected %q %v", name, ok)
+	}
+	if _, ok := chanHistoryName(hookLogPrefix + "00000000000000000001"); ok {
+		t.Fatal("expected false")
+	}
+
+	id, err := parseChanHistoryFrom("42")
+	if err != nil || id != 43 {
+		t.Fatalf("unexpected %d %v", id, err)
+	}
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	id, err = parseChanHistoryFrom(tm.Format(time.RFC3339Nano))
+	if err != nil || id != tm.UnixNano() {
+		t.Fatalf("unexpected %d %v", id, err)
+	}
+	if _, err := parseChanHistoryFrom("yesterday"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAppendChanHistory(t *testing.T) {
+	qdb, err := kvdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qdb.Close()
+	s := &Server{qdb: qdb, pubsub: newPubsub(), chlens: make(map[string]int)}
+	s.config = &Config{}
+	hook := &Hook{Name: "bus", channel: true, history: &chanHistory{count: 3}}
+	other := &Hook{Name: "bus:stop", channel: true, history: &chanHistory{count: 3}}
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		msg, id := s.publishChanHistory(hook, `{"n":`+strconv.Itoa(i)+`}`)
+		if gjson.Get(msg, "msg_id").String() != strconv.FormatInt(id, 10) {
+			t.Fatalf("expected msg_id %d in %s", id, msg)
+		}
+		ids = append(ids, id)
+		err := qdb.Update(func(tx *kvdb.Tx) error {
+			if err := s.appendChanHistory(tx, hook, msg, id); err != nil {
+				return err
+			}
+			return s.appendChanHistory(tx, other, msg, id)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.chlens["bus"] != 3 || s.chlens["bus:stop"] != 3 {
+		t.Fatalf("unexpected lengths %v", s.chlens)
+	}
+
+	// the oldest messages were removed and the rest keep their ids
+	msgs, err := s.chanHistorySince("bus", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].id != ids[2] || msgs[2].id != ids[4] ||
+		gjson.Get(msgs[0].message, "n").Int() != 2 {
+		t.Fatalf("unexpected history %v", msgs)
+	}
+
+	// a subscriber resumes after the id of the last message it received
+	from, err := parseChanHistoryFrom(strconv.FormatInt(ids[3], 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ = s.chanHistorySince("bus", from)
+	if len(msgs) != 1 || msgs[0].id != ids[4] {
+		t.Fatalf("unexpected history %v", msgs)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -37,6 +38,13 @@ import (
 const (
 	defaultKeepAlive     = 300 // seconds
 	defaultProtectedMode = "yes"
+	defaultSlowlogSlower = 10000 // microseconds
+	defaultSlowlogMaxLen = 128
+	defaultParallelism   = 1
+	defaultQueryCache    = 0
+	defaultHookUnix      = "no"
+	defaultStreamReplay  = "yes"
+	defaultReplaySize    = 256
 )
 
 // Config keys
@@ -54,9 +62,18 @@ const (
 	AutoGC        = "autogc"
 	KeepAlive     = "keepalive"
 	LogConfig     = "logconfig"
+	SlowlogSlower = "slowlog-log-slower-than"
+	SlowlogMaxLen = "slowlog-max-len"
+	Parallelism   = "max-query-parallelism"
+	QueryCache    = "query-cache-size"
+	HookFileDir   = "hook-file-dir"
+	HookUnix      = "hook-unix-sockets"
+	StreamReplay  = "stream-replay"
+	ReplaySize    = "stream-replay-size"
+	StreamOrigin  = "stream-allow-origin"
 )
 
-var validProperties = []string{RequirePass, LeaderAuth, ProtectedMode, MaxMemory, AutoGC, KeepAlive, LogConfig}
+var validProperties = []string{RequirePass, LeaderAuth, ProtectedMode, MaxMemory, AutoGC, KeepAlive, LogConfig, SlowlogSlower, SlowlogMaxLen, Parallelism, QueryCache, HookFileDir, HookUnix, StreamReplay, ReplaySize, StreamOrigin}
 
 // Config is a Bhojpur Space config
 type Config struct {
@@ -85,6 +102,24 @@ type Config struct {
 	_keepAlive      int64
 	_logConfigP     interface{}
 	_logConfig      string
+	_slowlogSlowerP string
+	_slowlogSlower  int64
+	_slowlogMaxLenP string
+	_slowlogMaxLen  int64
+	_parallelismP   string
+	_parallelism    int64
+	_queryCacheP    string
+	_queryCache     int64
+	_hookFileDirP   string
+	_hookFileDir    string
+	_hookUnixP      string
+	_hookUnix       string
+	_streamReplayP  string
+	_streamReplay   string
+	_replaySizeP    string
+	_replaySize     int64
+	_streamOriginP  string
+	_streamOrigin   string
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -113,6 +148,15 @@ func loadConfig(path string) (*Config, error) {
 		_autoGCP:        gjson.Get(json, AutoGC).String(),
 		_keepAliveP:     gjson.Get(json, KeepAlive).String(),
 		_logConfig:      gjson.Get(json, LogConfig).String(),
+		_slowlogSlowerP: gjson.Get(json, SlowlogSlower).String(),
+		_slowlogMaxLenP: gjson.Get(json, SlowlogMaxLen).String(),
+		_parallelismP:   gjson.Get(json, Parallelism).String(),
+		_queryCacheP:    gjson.Get(json, QueryCache).String(),
+		_hookFileDirP:   gjson.Get(json, HookFileDir).String(),
+		_hookUnixP:      gjson.Get(json, HookUnix).String(),
+		_streamReplayP:  gjson.Get(json, StreamReplay).String(),
+		_replaySizeP:    gjson.Get(json, ReplaySize).String(),
+		_streamOriginP:  gjson.Get(json, StreamOrigin).String(),
 	}
 
 	if config._serverID == "" {
@@ -141,6 +185,33 @@ func loadConfig(path string) (*Config, error) {
 	if err := config.setProperty(LogConfig, config._logConfig, true); err != nil {
 		return nil, err
 	}
+	if err := config.setProperty(SlowlogSlower, config._slowlogSlowerP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(SlowlogMaxLen, config._slowlogMaxLenP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(Parallelism, config._parallelismP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(QueryCache, config._queryCacheP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HookFileDir, config._hookFileDirP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HookUnix, config._hookUnixP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(StreamReplay, config._streamReplayP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(ReplaySize, config._replaySizeP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(StreamOrigin, config._streamOriginP, true); err != nil {
+		return nil, err
+	}
 	config.write(false)
 	return config, nil
 }
@@ -172,6 +243,43 @@ func (config *Config) write(writeProperties bool) {
 		if config._logConfig != "" {
 			config._logConfigP = config._logConfig
 		}
+		if config._slowlogSlower == defaultSlowlogSlower {
+			config._slowlogSlowerP = ""
+		} else {
+			config._slowlogSlowerP = strconv.FormatInt(config._slowlogSlower, 10)
+		}
+		if config._slowlogMaxLen == defaultSlowlogMaxLen {
+			config._slowlogMaxLenP = ""
+		} else {
+			config._slowlogMaxLenP = strconv.FormatInt(config._slowlogMaxLen, 10)
+		}
+		if config._parallelism == defaultParallelism {
+			config._parallelismP = ""
+		} else {
+			config._parallelismP = strconv.FormatInt(config._parallelism, 10)
+		}
+		if config._queryCache == defaultQueryCache {
+			config._queryCacheP = ""
+		} else {
+			config._queryCacheP = strconv.FormatInt(config._queryCache, 10)
+		}
+		config._hookFileDirP = config._hookFileDir
+		if config._hookUnix == defaultHookUnix {
+			config._hookUnixP = ""
+		} else {
+			config._hookUnixP = config._hookUnix
+		}
+		if config._streamReplay == defaultStreamReplay {
+			config._streamReplayP = ""
+		} else {
+			config._streamReplayP = config._streamReplay
+		}
+		if config._replaySize == defaultReplaySize {
+			config._replaySizeP = ""
+		} else {
+			config._replaySizeP = strconv.FormatInt(config._replaySize, 10)
+		}
+		config._streamOriginP = config._streamOrigin
 	}
 
 	m := make(map[string]interface{})
@@ -211,6 +319,33 @@ func (config *Config) write(writeProperties bool) {
 	if config._keepAliveP != "" {
 		m[KeepAlive] = config._keepAliveP
 	}
+	if config._slowlogSlowerP != "" {
+		m[SlowlogSlower] = config._slowlogSlowerP
+	}
+	if config._slowlogMaxLenP != "" {
+		m[SlowlogMaxLen] = config._slowlogMaxLenP
+	}
+	if config._parallelismP != "" {
+		m[Parallelism] = config._parallelismP
+	}
+	if config._queryCacheP != "" {
+		m[QueryCache] = config._queryCacheP
+	}
+	if config._hookFileDirP != "" {
+		m[HookFileDir] = config._hookFileDirP
+	}
+	if config._hookUnixP != "" {
+		m[HookUnix] = config._hookUnixP
+	}
+	if config._streamReplayP != "" {
+		m[StreamReplay] = config._streamReplayP
+	}
+	if config._replaySizeP != "" {
+		m[ReplaySize] = config._replaySizeP
+	}
+	if config._streamOriginP != "" {
+		m[StreamOrigin] = config._streamOriginP
+	}
 	if config._logConfigP != "" {
 		var lcfg map[string]interface{}
 		json.Unmarshal([]byte(config._logConfig), &lcfg)
@@ -332,6 +467,99 @@ func (config *Config) setProperty(name, value string, fromLoad bool) error {
 		} else {
 			config._logConfig = value
 		}
+	case SlowlogSlower:
+		if value == "" {
+			config._slowlogSlower = defaultSlowlogSlower
+		} else {
+			// a negative value turns off the slowlog
+			slower, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._slowlogSlower = slower
+			}
+		}
+	case SlowlogMaxLen:
+		if value == "" {
+			config._slowlogMaxLen = defaultSlowlogMaxLen
+		} else {
+			maxlen, err := strconv.ParseUint(value, 10, 63)
+			if err != nil {
+				invalid = true
+			} else {
+				config._slowlogMaxLen = int64(maxlen)
+			}
+		}
+	case Parallelism:
+		if value == "" {
+			config._parallelism = defaultParallelism
+		} else {
+			// zero uses all available CPUs
+			parallelism, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				invalid = true
+			} else {
+				config._parallelism = int64(parallelism)
+			}
+		}
+	case HookFileDir, HookUnix:
+		// the endpoints that reach the local machine are only changed in
+		// the config file, so that clients cannot turn them on
+		if !fromLoad {
+			return clientErrorf("CONFIG SET '%s' is not allowed, "+
+				"it can only be set in the config file", name)
+		}
+		if name == HookFileDir {
+			config._hookFileDir = value
+			break
+		}
+		switch strings.ToLower(value) {
+		case "":
+			config._hookUnix = defaultHookUnix
+		case "yes", "no":
+			config._hookUnix = strings.ToLower(value)
+		default:
+			invalid = true
+		}
+	case StreamReplay:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._streamReplay = defaultStreamReplay
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._streamReplay = strings.ToLower(value)
+		default:
+			invalid = true
+		}
+	case ReplaySize:
+		if value == "" {
+			config._replaySize = defaultReplaySize
+		} else {
+			size, err := strconv.ParseUint(value, 10, 31)
+			if err != nil || size == 0 {
+				invalid = true
+			} else {
+				config._replaySize = int64(size)
+			}
+		}
+	case StreamOrigin:
+		// a comma separated list of origins, or "*" for any origin
+		config._streamOrigin = strings.TrimSpace(value)
+	case QueryCache:
+		if value == "" {
+			config._queryCache = defaultQueryCache
+		} else {
+			// zero turns off the cache
+			size, err := strconv.ParseUint(value, 10, 63)
+			if err != nil {
+				invalid = true
+			} else {
+				config._queryCache = int64(size)
+			}
+		}
 	}
 
 	if invalid {
@@ -371,6 +599,24 @@ func (config *Config) getProperty(name string) string {
 		return strconv.FormatUint(uint64(config._keepAlive), 10)
 	case LogConfig:
 		return config._logConfig
+	case SlowlogSlower:
+		return strconv.FormatInt(config._slowlogSlower, 10)
+	case SlowlogMaxLen:
+		return strconv.FormatInt(config._slowlogMaxLen, 10)
+	case Parallelism:
+		return strconv.FormatInt(config._parallelism, 10)
+	case QueryCache:
+		return strconv.FormatInt(config._queryCache, 10)
+	case HookFileDir:
+		return config._hookFileDir
+	case HookUnix:
+		return config._hookUnix
+	case StreamReplay:
+		return config._streamReplay
+	case ReplaySize:
+		return strconv.FormatInt(config._replaySize, 10)
+	case StreamOrigin:
+		return config._streamOrigin
 	}
 }
 
@@ -494,6 +740,71 @@ func (config *Config) keepAlive() int64 {
 	config.mu.RUnlock()
 	return v
 }
+func (config *Config) slowlogSlower() int64 {
+	config.mu.RLock()
+	v := config._slowlogSlower
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) slowlogMaxLen() int {
+	config.mu.RLock()
+	v := config._slowlogMaxLen
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) parallelism() int {
+	config.mu.RLock()
+	v := config._parallelism
+	config.mu.RUnlock()
+	if v == 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return int(v)
+}
+func (config *Config) queryCacheSize() int {
+	config.mu.RLock()
+	v := config._queryCache
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) hookFileDir() string {
+	config.mu.RLock()
+	v := config._hookFileDir
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) hookUnix() bool {
+	config.mu.RLock()
+	v := config._hookUnix
+	config.mu.RUnlock()
+	return v == "yes"
+}
+func (config *Config) streamReplaySize() int {
+	config.mu.RLock()
+	defer config.mu.RUnlock()
+	if config._streamReplay != "yes" {
+		return 0
+	}
+	return int(config._replaySize)
+}
+
+// streamOrigin returns the Access-Control-Allow-Origin value for a stream
+// request from the origin, or an empty string when it is not allowed.
+func (config *Config) streamOrigin(origin string) string {
+	config.mu.RLock()
+	v := config._streamOrigin
+	config.mu.RUnlock()
+	for _, allowed := range strings.Split(v, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" {
+			return "*"
+		}
+		if allowed != "" && allowed == origin {
+			return origin
+		}
+	}
+	return ""
+}
 func (config *Config) setFollowHost(v string) {
 	config.mu.Lock()
 	config._followHost = v
@@ -22,11 +22,14 @@ package server
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/tile/filter"
 	"github.com/bhojpur/space/pkg/tile/glob"
 	"github.com/bhojpur/space/pkg/utils/btree"
 	"github.com/bhojpur/space/pkg/utils/geojson"
@@ -57,6 +60,55 @@ func orderFields(fmap map[string]int, farr []string, fields []float64) []fvt {
 	}
 	return fvs
 }
+
+// parseFieldList parses the count and the names that follow FIELDS.
+func parseFieldList(vs []string) (nvs []string, fields []string, err error) {
+	var ok bool
+	var nfieldsStr string
+	if vs, nfieldsStr, ok = tokenval(vs); !ok || nfieldsStr == "" {
+		return nil, nil, errInvalidNumberOfArguments
+	}
+	nfields, err := strconv.ParseUint(nfieldsStr, 10, 64)
+	if err != nil || nfields == 0 {
+		return nil, nil, errInvalidArgument(nfieldsStr)
+	}
+	if nfields > uint64(len(vs)) {
+		return nil, nil, errInvalidNumberOfArguments
+	}
+	fields = make([]string, nfields)
+	for i := range fields {
+		if vs, fields[i], ok = tokenval(vs); !ok || fields[i] == "" {
+			return nil, nil, errInvalidNumberOfArguments
+		}
+	}
+	return vs, fields, nil
+}
+
+// selectFields returns the fields of farr that are in the FIELDS list, in
+// the order of the list.
+func selectFields(farr []string, fields []string) []string {
+	var sel []string
+	for _, field := range fields {
+		var found, dup bool
+		for _, name := range farr {
+			if name == field {
+				found = true
+				break
+			}
+		}
+		for _, name := range sel {
+			if name == field {
+				dup = true
+				break
+			}
+		}
+		if found && !dup {
+			sel = append(sel, field)
+		}
+	}
+	return sel
+}
+
 func (s *Server) cmdBounds(msg *Message) (resp.Value, error) {
 	start := time.Now()
 	vs := msg.Args[1:]
@@ -157,9 +209,33 @@ func (s *Server) cmdGet(msg *Message) (resp.Value, error) {
 	}
 
 	withfields := false
-	if _, peek, ok := tokenval(vs); ok && strings.ToLower(peek) == "withfields" {
-		withfields = true
-		vs = vs[1:]
+	withversion := false
+	nogeometry := false
+	var selected []string
+	for len(vs) > 0 {
+		switch strings.ToLower(vs[0]) {
+		case "withfields":
+			withfields = true
+			vs = vs[1:]
+			continue
+		case "withversion":
+			withversion = true
+			vs = vs[1:]
+			continue
+		case "fields":
+			var err error
+			if vs, selected, err = parseFieldList(vs[1:]); err != nil {
+				return NOMessage, err
+			}
+			withfields = true
+			continue
+		case "nogeometry":
+			nogeometry = true
+			withfields = true
+			vs = vs[1:]
+			continue
+		}
+		break
 	}
 
 	col := s.getCol(key)
@@ -187,9 +263,17 @@ func (s *Server) cmdGet(msg *Message) (resp.Value, error) {
 	if !ok {
 		typ = "object"
 	}
+	if nogeometry {
+		if ok {
+			return NOMessage, errInvalidArgument(typ)
+		}
+		typ = "nogeometry"
+	}
 	switch typ {
 	default:
 		return NOMessage, errInvalidArgument(typ)
+	case "nogeometry":
+		// only the fields are returned
 	case "object":
 		if msg.OutputType == JSON {
 			buf.WriteString(`,"object":`)
@@ -258,7 +342,11 @@ func (s *Server) cmdGet(msg *Message) (resp.Value, error) {
 		return NOMessage, errInvalidNumberOfArguments
 	}
 	if withfields {
-		fvs := orderFields(col.FieldMap(), col.FieldArr(), fields)
+		farr := col.FieldArr()
+		if selected != nil {
+			farr = selectFields(farr, selected)
+		}
+		fvs := orderFields(col.FieldMap(), farr, fields)
 		if len(fvs) > 0 {
 			fvals := make([]resp.Value, 0, len(fvs)*2)
 			if msg.OutputType == JSON {
@@ -282,13 +370,25 @@ func (s *Server) cmdGet(msg *Message) (resp.Value, error) {
 			}
 		}
 	}
+	version, _ := col.Version(id)
 	switch msg.OutputType {
 	case JSON:
+		if withversion {
+			buf.WriteString(`,"version":` + strconv.FormatUint(version, 10))
+		}
 		buf.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
 		return resp.StringValue(buf.String()), nil
 	case RESP:
 		var oval resp.Value
-		if withfields {
+		if withversion {
+			// the version follows the object and fields
+			oval = resp.ArrayValue(append(vals, resp.IntegerValue(int(version))))
+		} else if nogeometry {
+			oval = resp.ArrayValue(nil)
+			if len(vals) > 0 {
+				oval = vals[0]
+			}
+		} else if withfields {
 			oval = resp.ArrayValue(vals)
 		} else {
 			oval = vals[0]
@@ -452,8 +552,12 @@ func (s *Server) cmdDrop(msg *Message) (res resp.Value, d commandDetails, err er
 		return
 	}
 	col := s.getCol(d.key)
-	if col != nil {
-		s.deleteCol(d.key)
+	_, minmove := s.minmoves[d.key]
+	if col != nil || minmove {
+		if col != nil {
+			s.deleteCol(d.key)
+		}
+		delete(s.minmoves, d.key)
 		d.updated = true
 	} else {
 		d.key = "" // ignore the details
@@ -518,6 +622,12 @@ func (s *Server) cmdRename(msg *Message) (res resp.Value, d commandDetails, err
 	if d.updated {
 		s.deleteCol(d.key)
 		s.setCol(d.newKey, col)
+		// the MINMOVE default goes with the collection
+		delete(s.minmoves, d.newKey)
+		if mm, ok := s.minmoves[d.key]; ok {
+			delete(s.minmoves, d.key)
+			s.minmoves[d.newKey] = mm
+		}
 	}
 	d.timestamp = time.Now()
 	switch msg.OutputType {
@@ -544,7 +654,12 @@ func (s *Server) cmdFlushDB(msg *Message) (res resp.Value, d commandDetails, err
 	}
 
 	// clear the entire database
+	s.cols.Ascend(nil, func(v interface{}) bool {
+		s.keepColVersion(v.(*collectionKeyContainer).col)
+		return true
+	})
 	s.cols = btree.NewNonConcurrent(byCollectionKey)
+	s.minmoves = make(map[string]minMove)
 	s.groupHooks = btree.NewNonConcurrent(byGroupHook)
 	s.groupObjects = btree.NewNonConcurrent(byGroupObject)
 	s.hookExpires = btree.NewNonConcurrent(byHookExpires)
@@ -565,9 +680,88 @@ func (s *Server) cmdFlushDB(msg *Message) (res resp.Value, d commandDetails, err
 	return
 }
 
+// SETLASTVERSION [key] version
+//
+// Raises the last object version of a collection, or without a key, of the
+// removed collections. It is only written by AOFSHRINK, which keeps the
+// versions of the deleted objects from being used again after a restart.
+func (s *Server) cmdSetLastVersion(msg *Message) (
+	res resp.Value, d commandDetails, err error,
+) {
+	if !msg.fromAOF() {
+		return NOMessage, d, fmt.Errorf("unknown command '%s'", msg.Args[0])
+	}
+	vs := msg.Args[1:]
+	var key, sversion string
+	switch len(vs) {
+	default:
+		return NOMessage, d, errInvalidNumberOfArguments
+	case 1:
+		sversion = vs[0]
+	case 2:
+		key, sversion = vs[0], vs[1]
+	}
+	version, err := strconv.ParseUint(sversion, 10, 64)
+	if err != nil {
+		return NOMessage, d, errInvalidArgument(sversion)
+	}
+	if key == "" {
+		if version > s.colver {
+			s.colver = version
+		}
+	} else {
+		col := s.getCol(key)
+		if col == nil {
+			return NOMessage, d, errKeyNotFound
+		}
+		col.SetLastVersion(version)
+	}
+	d.command = "setlastversion"
+	d.updated = true
+	d.timestamp = time.Now()
+	return NOMessage, d, nil
+}
+
+// setOpts are the options of SET for object versions and conditional
+// writes.
+type setOpts struct {
+	ifVersion   bool         // IFVERSION was set
+	version     uint64       // the version that IFVERSION expects
+	cond        *filter.Expr // IF condition on the current object
+	setVersion  uint64       // VERSION replaces the version of the object
+	withVersion bool         // WITHVERSION returns the version with RESP
+	minMove     *minMove     // MINMOVE threshold, nil for the default
+}
+
+// check returns an error when the current object does not meet the
+// conditions of the write. An IF condition only applies to an object that
+// exists.
+func (opts *setOpts) check(col *collection.Collection, id string) error {
+	if !opts.ifVersion && opts.cond == nil {
+		return nil
+	}
+	var o geojson.Object
+	var fields []float64
+	var version uint64
+	var ok bool
+	if col != nil {
+		if o, fields, _, ok = col.Get(id); ok {
+			version, _ = col.Version(id)
+		}
+	}
+	if opts.ifVersion && version != opts.version {
+		return errVersionMismatch
+	}
+	if ok && opts.cond != nil &&
+		!opts.cond.Match(&filterEnv{id, o, fields, col.FieldMap()}) {
+		return errConditionNotMet
+	}
+	return nil
+}
+
 func (s *Server) parseSetArgs(vs []string) (
 	d commandDetails, fields []string, values []float64,
-	xx, nx bool,
+	xx, nx bool, opts setOpts,
 	ex int64, etype []byte, evs []string, err error,
 ) {
 	var ok bool
@@ -582,6 +776,8 @@ func (s *Server) parseSetArgs(vs []string) (
 	}
 	var arg []byte
 	var nvs []string
+	var mm minMove
+	var minMoveSet, minAgeSet bool
 	for {
 		if nvs, arg, ok = tokenvalbytes(vs); !ok || len(arg) == 0 {
 			err = errInvalidNumberOfArguments
@@ -651,8 +847,81 @@ func (s *Server) parseSetArgs(vs []string) (
 			nx = true
 			continue
 		}
+		if lcb(arg, "ifversion") || lcb(arg, "version") {
+			vs = nvs
+			var s string
+			var v uint64
+			if vs, s, ok = tokenval(vs); !ok || s == "" {
+				err = errInvalidNumberOfArguments
+				return
+			}
+			v, err = strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				err = errInvalidArgument(s)
+				return
+			}
+			if lcb(arg, "ifversion") {
+				opts.ifVersion = true
+				opts.version = v
+			} else {
+				if v == 0 {
+					err = errInvalidArgument(s)
+					return
+				}
+				opts.setVersion = v
+			}
+			continue
+		}
+		if lcb(arg, "if") {
+			vs = nvs
+			if opts.cond != nil {
+				err = errDuplicateArgument("IF")
+				return
+			}
+			var src string
+			if vs, src, ok = tokenval(vs); !ok || src == "" {
+				err = errInvalidNumberOfArguments
+				return
+			}
+			if opts.cond, err = filter.Compile(src); err != nil {
+				err = fmt.Errorf("invalid IF: %v", err)
+				return
+			}
+			continue
+		}
+		if lcb(arg, "withversion") {
+			vs = nvs
+			opts.withVersion = true
+			continue
+		}
+		if lcb(arg, "minmove") || lcb(arg, "minage") {
+			vs = nvs
+			var s string
+			var v float64
+			if vs, s, ok = tokenval(vs); !ok || s == "" {
+				err = errInvalidNumberOfArguments
+				return
+			}
+			if v, err = parseMinMoveValue(s); err != nil {
+				return
+			}
+			if lcb(arg, "minmove") {
+				minMoveSet = true
+				mm.meters = v
+			} else {
+				minAgeSet = true
+				mm.age = time.Duration(v * float64(time.Second))
+			}
+			continue
+		}
 		break
 	}
+	if minMoveSet {
+		opts.minMove = &mm
+	} else if minAgeSet {
+		err = errors.New("MINAGE requires MINMOVE")
+		return
+	}
 	if vs, typ, ok = tokenvalbytes(vs); !ok || len(typ) == 0 {
 		err = errInvalidNumberOfArguments
 		return
@@ -796,12 +1065,22 @@ func (s *Server) cmdSet(msg *Message) (res resp.Value, d commandDetails, err err
 	var fields []string
 	var values []float64
 	var xx, nx bool
+	var opts setOpts
 	var ex int64
-	d, fields, values, xx, nx, ex, _, _, err = s.parseSetArgs(vs)
+	d, fields, values, xx, nx, opts, ex, _, _, err = s.parseSetArgs(vs)
 	if err != nil {
 		return
 	}
+	if opts.setVersion != 0 && !msg.fromAOF() {
+		// clients may only compare versions, never set them
+		err = errInvalidArgument("version")
+		return
+	}
 	col := s.getCol(d.key)
+	if err = opts.check(col, d.id); err != nil {
+		// rejected writes do not reach the aof or the geofences
+		return
+	}
 	if col == nil {
 		if xx {
 			goto notok
@@ -815,10 +1094,21 @@ func (s *Server) cmdSet(msg *Message) (res resp.Value, d commandDetails, err err
 			goto notok
 		}
 	}
-	d.oldObj, d.oldFields, d.fields = col.Set(d.id, d.obj, fields, values, ex)
-	d.command = "set"
-	d.updated = true // perhaps we should do a diff on the previous object?
-	d.timestamp = time.Now()
+	if mm, ok := s.minMoveOf(msg, d.key, &opts); ok &&
+		mm.unmoved(col, d.id, d.obj, start) {
+		// the geometry is kept, and the aof gets only the other changes
+		d.aof = setUnmoved(col, &d, fields, values, ex, start)
+	} else {
+		if opts.setVersion != 0 {
+			d.oldObj, d.oldFields, d.fields = col.SetWithVersion(d.id, d.obj,
+				fields, values, ex, opts.setVersion)
+		} else {
+			d.oldObj, d.oldFields, d.fields = col.Set(d.id, d.obj, fields, values, ex)
+		}
+		d.command = "set"
+		d.updated = true // perhaps we should do a diff on the previous object?
+		d.timestamp = time.Now()
+	}
 	if msg.ConnType != Null || msg.OutputType != Null {
 		// likely loaded from aof at server startup, ignore field remapping.
 		fmap = col.FieldMap()
@@ -833,9 +1123,20 @@ func (s *Server) cmdSet(msg *Message) (res resp.Value, d commandDetails, err err
 	switch msg.OutputType {
 	default:
 	case JSON:
-		res = resp.StringValue(`{"ok":true,"elapsed":"` + time.Since(start).String() + "\"}")
+		var version string
+		if opts.withVersion {
+			v, _ := col.Version(d.id)
+			version = `,"version":` + strconv.FormatUint(v, 10)
+		}
+		res = resp.StringValue(`{"ok":true` + version +
+			`,"elapsed":"` + time.Since(start).String() + "\"}")
 	case RESP:
-		res = resp.SimpleStringValue("OK")
+		if opts.withVersion {
+			version, _ := col.Version(d.id)
+			res = resp.IntegerValue(int(version))
+		} else {
+			res = resp.SimpleStringValue("OK")
+		}
 	}
 	return
 notok:
@@ -916,6 +1217,10 @@ func (s *Server) cmdFset(msg *Message) (res resp.Value, d commandDetails, err er
 		return
 	}
 	var ok bool
+	if _, oldFields, _, exists := col.Get(d.id); exists {
+		// the field values are updated in place
+		d.oldFields = append([]float64(nil), oldFields...)
+	}
 	d.obj, d.fields, updateCount, ok = col.SetFields(d.id, fields, values)
 	if !(ok || xx) {
 		err = errIDNotFound
@@ -0,0 +1,183 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+)
+
+func TestSetOpts(t *testing.T) {
+	s := &Server{}
+	parse := func(args string) setOpts {
+		t.Helper()
+		_, _, _, _, _, opts, _, _, _, err := s.parseSetArgs(strings.Fields(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opts
+	}
+	col := collection.New()
+	col.Set("truck1", PO(-112, 33), []string{"ts"}, []float64{100}, 0)
+	col.Set("truck1", PO(-112, 33), nil, nil, 0)
+
+	tests := []struct {
+		args string
+		id   string
+		err  error
+	}{
+		{"fleet truck1 IFVERSION 2 POINT 33 -112", "truck1", nil},
+		{"fleet truck1 IFVERSION 1 POINT 33 -112", "truck1", errVersionMismatch},
+		{"fleet truck2 IFVERSION 0 POINT 33 -112", "truck2", nil},
+		{"fleet truck2 IFVERSION 1 POINT 33 -112", "truck2", errVersionMismatch},
+		{"fleet truck1 IF ts<150 POINT 33 -112", "truck1", nil},
+		{"fleet truck1 IF ts<50 POINT 33 -112", "truck1", errConditionNotMet},
+		{"fleet truck2 IF ts<50 POINT 33 -112", "truck2", nil},
+		{"fleet truck1 IFVERSION 2 IF ts<50 POINT 33 -112", "truck1", errConditionNotMet},
+	}
+	for _, tt := range tests {
+		opts := parse(tt.args)
+		if err := opts.check(col, tt.id); err != tt.err {
+			t.Fatalf("%s: expected %v, got %v", tt.args, tt.err, err)
+		}
+	}
+	opts := parse("fleet truck1 POINT 33 -112")
+	if err := opts.check(nil, "truck1"); err != nil {
+		t.Fatal(err)
+	}
+	opts = parse("fleet truck1 VERSION 7 WITHVERSION POINT 33 -112")
+	if opts.setVersion != 7 || !opts.withVersion {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+	opts = parse("fleet truck1 MINAGE 30 MINMOVE 5 POINT 33 -112")
+	if opts.minMove == nil || *opts.minMove != (minMove{5, 30 * time.Second}) {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+	for _, args := range []string{
+		"fleet truck1 IFVERSION -1 POINT 33 -112",
+		"fleet truck1 VERSION 0 POINT 33 -112",
+		"fleet truck1 IF ts< POINT 33 -112",
+		"fleet truck1 IF ts>1 IF ts>2 POINT 33 -112",
+		"fleet truck1 MINMOVE -1 POINT 33 -112",
+		"fleet truck1 MINAGE 0 POINT 33 -112",
+	} {
+		if _, _, _, _, _, _, _, _, _, err := s.parseSetArgs(strings.Fields(args)); err == nil {
+			t.Fatalf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestGetFieldsOutput(t *testing.T) {
+	s, _ := newFenceTestServer(t)
+	col := collection.New()
+	col.Set("truck1", PO(-112, 33), []string{"speed", "age", "rating"},
+		[]float64{55, 3, 0}, 0)
+	col.Set("truck2", PO(-111, 34), []string{"speed"}, []float64{10}, 0)
+	s.setCol("fleet", col)
+	tests := []struct {
+		args       string
+		json, resp string
+	}{
+		{"fleet truck1",
+			`"object":{"type":"Point","coordinates":[-112,33]}`,
+			`{"type":"Point","coordinates":[-112,33]}`},
+		{"fleet truck1 WITHFIELDS",
+			`"object":{"type":"Point","coordinates":[-112,33]},` +
+				`"fields":{"age":3,"speed":55}`,
+			`[{"type":"Point","coordinates":[-112,33]} [age 3 speed 55]]`},
+		{"fleet truck1 NOGEOMETRY",
+			`"fields":{"age":3,"speed":55}`,
+			`[age 3 speed 55]`},
+		{"fleet truck1 FIELDS 1 speed NOGEOMETRY",
+			`"fields":{"speed":55}`,
+			`[speed 55]`},
+		{"fleet truck1 FIELDS 2 rating speed POINT",
+			`"point":{"lat":33,"lon":-112},"fields":{"speed":55}`,
+			`[[33 -112] [speed 55]]`},
+		{"fleet truck2 FIELDS 1 age NOGEOMETRY", ``, `[]`},
+		{"fleet truck2 FIELDS 1 age NOGEOMETRY WITHVERSION", `"version":2`, `[2]`},
+		{"fleet truck1 NOGEOMETRY WITHVERSION",
+			`"fields":{"age":3,"speed":55},"version":1`,
+			`[[age 3 speed 55] 1]`},
+	}
+	for _, tt := range tests {
+		args := append([]string{"GET"}, strings.Fields(tt.args)...)
+		res, err := s.cmdGet(&Message{Args: args, OutputType: JSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"ok":true,` + tt.json + `,"elapsed"`
+		if tt.json == "" {
+			exp = `{"ok":true,"elapsed"`
+		}
+		if out := res.String(); !strings.HasPrefix(out, exp) {
+			t.Fatalf("%s: expected %s, got %s", tt.args, exp, out)
+		}
+		res, err = s.cmdGet(&Message{Args: args, OutputType: RESP})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := res.String(); out != tt.resp {
+			t.Fatalf("%s: expected %s, got %s", tt.args, tt.resp, out)
+		}
+	}
+	// NOGEOMETRY replaces the output type
+	_, err := s.cmdGet(&Message{
+		Args:       strings.Fields("GET fleet truck1 NOGEOMETRY POINT"),
+		OutputType: JSON,
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSetVersionFromAOF(t *testing.T) {
+	s, _ := newFenceTestServer(t)
+	s.config = &Config{}
+	for _, args := range []string{
+		"SET fleet truck1 VERSION 7 POINT 33 -112",
+		"MSET fleet truck1 VERSION 7 POINT 33 -112",
+	} {
+		// clients may not set a version
+		msg := &Message{Args: strings.Fields(args), OutputType: RESP}
+		var err error
+		if msg.Command() == "set" {
+			_, _, err = s.cmdSet(msg)
+		} else {
+			_, _, err = s.cmdMset(msg)
+		}
+		if err == nil || err.Error() != errInvalidArgument("version").Error() {
+			t.Fatalf("%s: expected an invalid argument, got %v", args, err)
+		}
+	}
+	// the aof and the leader may
+	if _, _, err := s.cmdSet(&Message{
+		Args: strings.Fields("SET fleet truck1 VERSION 7 POINT 33 -112"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := s.getCol("fleet").Version("truck1"); version != 7 {
+		t.Fatalf("expected version 7, got %d", version)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strconv"
+
+	"github.com/bhojpur/space/pkg/utils/geojson"
+)
+
+// fenceDensity counts the objects that are inside the area of a DETECT
+// density fence and that pass its MATCH and WHERE filters. The count is kept
+// up to date from the details of each update.
+type fenceDensity struct {
+	ids   map[string]bool // nil until the fence sees its first update
+	state string          // "under", "over" or "normal"
+}
+
+// densityState returns the state of a count against the MIN and MAX
+// thresholds of a fence.
+func densityState(fence *liveFenceSwitches, count int) string {
+	switch {
+	case fence.hasmin && uint64(count) < fence.mincount:
+		return "under"
+	case fence.hasmax && uint64(count) > fence.maxcount:
+		return "over"
+	}
+	return "normal"
+}
+
+// densityMatch returns true if an object counts towards the density.
+func densityMatch(
+	sw *scanWriter, fence *liveFenceSwitches, id string,
+	obj geojson.Object, fields []float64, fmap map[string]int,
+) bool {
+	if obj == nil || !objIsSpatial(obj) || !fenceMatchObject(fence, obj) {
+		return false
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.fmap = fmap
+	sw.fullFields = true
+	ok, _, _ := sw.testObject(id, obj, fields)
+	return ok
+}
+
+// countDensity counts the objects that are in the collection now.
+func countDensity(sw *scanWriter, fence *liveFenceSwitches) map[string]bool {
+	ids := make(map[string]bool)
+	col := sw.s.getCol(fence.key)
+	if col == nil {
+		return ids
+	}
+	fmap := col.FieldMap()
+	col.Intersects(fence.obj, 0, nil, nil,
+		func(id string, obj geojson.Object, fields []float64) bool {
+			if densityMatch(sw, fence, id, obj, fields, fmap) {
+				ids[id] = true
+			}
+			return true
+		},
+	)
+	return ids
+}
+
+// fenceMatchDensity updates the count of a density fence and returns a
+// message when the count crosses one of the thresholds.
+func fenceMatchDensity(
+	hookName string, sw *scanWriter, fence *liveFenceSwitches,
+	metas []FenceMeta, details *commandDetails,
+) []string {
+	switch details.command {
+	case "set", "fset", "del", "drop":
+	default:
+		return nil
+	}
+	fd := fence.density
+	if fd.ids == nil {
+		// This is the first update since the fence was created or the server
+		// started. The collection already has the update, so count it and
+		// then put back the object as it was before.
+		fd.ids = countDensity(sw, fence)
+		switch details.command {
+		case "set", "fset":
+			// FSET keeps the object and only changes its fields
+			oldObj := details.oldObj
+			if details.command == "fset" {
+				oldObj = details.obj
+			}
+			delete(fd.ids, details.id)
+			if densityMatch(sw, fence, details.id, oldObj,
+				details.oldFields, details.fmap) {
+				fd.ids[details.id] = true
+			}
+		case "del":
+			if densityMatch(sw, fence, details.id, details.obj,
+				details.fields, sw.fmap) {
+				fd.ids[details.id] = true
+			}
+		}
+		fd.state = densityState(fence, len(fd.ids))
+	}
+	switch details.command {
+	case "set", "fset":
+		if densityMatch(sw, fence, details.id, details.obj, details.fields,
+			details.fmap) {
+			fd.ids[details.id] = true
+		} else {
+			delete(fd.ids, details.id)
+		}
+	case "del":
+		delete(fd.ids, details.id)
+	case "drop":
+		fd.ids = make(map[string]bool)
+	}
+	state := densityState(fence, len(fd.ids))
+	if state == fd.state {
+		return nil
+	}
+	fd.state = state
+	var buf []byte
+	buf = append(append(buf, `{"command":"`...), details.command...)
+	buf = append(buf, `","detect":"density"`...)
+	buf = appendHookDetails(buf, hookName, metas)
+	buf = appendJSONString(append(buf, `,"key":`...), details.key)
+	buf = appendJSONTimeFormat(append(buf, `,"time":`...), details.timestamp)
+	if details.id != "" {
+		buf = appendJSONString(append(buf, `,"id":`...), details.id)
+	}
+	buf = strconv.AppendInt(append(buf, `,"count":`...), int64(len(fd.ids)), 10)
+	buf = append(append(buf, `,"state":"`...), state...)
+	buf = append(buf, `"}`...)
+	return []string{string(buf)}
+}
+
+// resetFenceDensities makes the density fences of all hooks count again on
+// their next update. Counts are only kept by the leader, so this is needed
+// when a follower becomes the leader.
+func (s *Server) resetFenceDensities() {
+	s.hooks.Walk(func(v []interface{}) {
+		for _, v := range v {
+			if hook := v.(*Hook); hook.Fence.density != nil {
+				hook.Fence.density.ids = nil
+			}
+		}
+	})
+}
@@ -79,7 +79,13 @@ func fenceMatch(
 	hookName string, sw *scanWriter, fence *liveFenceSwitches,
 	metas []FenceMeta, details *commandDetails,
 ) []string {
+	if fence.density != nil {
+		return fenceMatchDensity(hookName, sw, fence, metas, details)
+	}
 	if details.command == "drop" {
+		if fence.roam.pairs != nil {
+			fence.roam.pairs.reset()
+		}
 		return []string{
 			`{"command":"drop"` + hookJSONString(hookName, metas) +
 				`,"key":` + jsonString(details.key) +
@@ -95,7 +101,7 @@ func fenceMatch(
 	if details.obj == nil || !objIsSpatial(details.obj) {
 		return nil
 	}
-	if details.command == "fset" {
+	if details.command == "fset" && !fence.detect["fieldchange"] {
 		sw.mu.Lock()
 		nofields := sw.nofields
 		sw.mu.Unlock()
@@ -104,6 +110,9 @@ func fenceMatch(
 		}
 	}
 	if details.command == "del" {
+		if fence.roam.pairs != nil {
+			fence.roam.pairs.removeAll(details.id)
+		}
 		return []string{
 			`{"command":"del"` + hookJSONString(hookName, metas) +
 				`,"key":` + jsonString(details.key) +
@@ -111,19 +120,32 @@ func fenceMatch(
 				`,"time":` + jsonTimeFormat(details.timestamp) + `}`,
 		}
 	}
+	if fence.detect["fieldchange"] {
+		return fenceMatchFieldChange(hookName, sw, fence, metas, details)
+	}
 	var roamNearbys, roamFaraways []roamMatch
+	var routeID string
+	var routeMeters float64
 	var detect = "outside"
 	if fence != nil {
 		if fence.roam.on {
 			if details.command == "set" {
 				roamNearbys, roamFaraways =
 					fenceMatchRoam(sw.s, fence, details.id,
-						details.oldObj, details.obj)
+						details.oldObj, details.obj, details.timestamp)
 				if len(roamNearbys) == 0 && len(roamFaraways) == 0 {
 					return nil
 				}
 			}
 			detect = "roam"
+		} else if fence.route.on {
+			detect, routeID, routeMeters = fenceMatchRoute(sw.s, fence,
+				details)
+			if detect == "" {
+				return nil
+			}
+		} else if details.detect != "" {
+			detect = details.detect
 		} else {
 			// not using roaming
 			match1 := fenceMatchObject(fence, details.oldObj)
@@ -183,38 +205,11 @@ func fenceMatch(
 		}
 		break
 	}
-	sw.mu.Lock()
-	var distance float64
-	if fence.distance && fence.obj != nil {
-		distance = details.obj.Distance(fence.obj)
-	}
-	sw.fmap = details.fmap
-	sw.fullFields = true
-	sw.msg.OutputType = JSON
-	sw.writeObject(ScanWriterParams{
-		id:         details.id,
-		o:          details.obj,
-		fields:     details.fields,
-		noLock:     true,
-		distance:   distance,
-		distOutput: fence.distance,
-	})
-
-	if sw.wr.Len() == 0 {
-		sw.mu.Unlock()
+	res := fenceObjectJSON(sw, fence, details)
+	if res == "" {
 		return nil
 	}
 
-	res := sw.wr.String()
-	sw.wr.Reset()
-	if len(res) > 0 && res[0] == ',' {
-		res = res[1:]
-	}
-	if sw.output == outputIDs {
-		res = `{"id":` + string(res) + `}`
-	}
-	sw.mu.Unlock()
-
 	var group string
 	if detect == "enter" {
 		group = sw.s.groupConnect(hookName, details.key, details.id)
@@ -245,6 +240,11 @@ func fenceMatch(
 		if fence.detect == nil || fence.detect["outside"] {
 			msgs = append(msgs, makemsg(details.command, group, "outside", hookName, metas, details.key, details.timestamp, res[1:]))
 		}
+	case "deviate", "return":
+		for i := range msgs {
+			msgs[i] = extendRouteMessage(fence, routeID, msgs[i],
+				routeMeters)
+		}
 	case "roam":
 		if len(msgs) > 0 {
 			var nmsgs []string
@@ -270,6 +270,102 @@ func fenceMatch(
 	return msgs
 }
 
+// fenceObjectJSON returns the object of an update as it is written in fence
+// messages, or an empty string when the object does not pass the filters.
+func fenceObjectJSON(
+	sw *scanWriter, fence *liveFenceSwitches, details *commandDetails,
+) string {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	var distance float64
+	if fence.distance && fence.obj != nil {
+		distance = details.obj.Distance(fence.obj)
+	}
+	sw.fmap = details.fmap
+	sw.fullFields = true
+	sw.msg.OutputType = JSON
+	sw.writeObject(ScanWriterParams{
+		id:         details.id,
+		o:          details.obj,
+		fields:     details.fields,
+		noLock:     true,
+		distance:   distance,
+		distOutput: fence.distance,
+	})
+
+	if sw.wr.Len() == 0 {
+		return ""
+	}
+
+	res := sw.wr.String()
+	sw.wr.Reset()
+	if len(res) > 0 && res[0] == ',' {
+		res = res[1:]
+	}
+	if sw.output == outputIDs {
+		res = `{"id":` + string(res) + `}`
+	}
+	return res
+}
+
+// fenceMatchFieldChange returns a message for each WHEN condition that is
+// met by the field changes of an object inside the fence area.
+func fenceMatchFieldChange(
+	hookName string, sw *scanWriter, fence *liveFenceSwitches,
+	metas []FenceMeta, details *commandDetails,
+) []string {
+	if (details.command != "set" && details.command != "fset") ||
+		details.fmap == nil || !fenceMatchObject(fence, details.obj) {
+		return nil
+	}
+	hasOld := details.command == "fset" || details.oldObj != nil
+	var whens []string
+	for _, when := range fence.whens {
+		var old, value float64
+		if idx, ok := details.fmap[when.field]; ok {
+			if idx < len(details.oldFields) {
+				old = details.oldFields[idx]
+			}
+			if idx < len(details.fields) {
+				value = details.fields[idx]
+			}
+		}
+		if !when.met(old, hasOld, value) {
+			continue
+		}
+		b := appendJSONString([]byte(`,"when":{"field":`), when.field)
+		b = appendJSONString(append(b, `,"op":`...), when.op)
+		if when.op != "changed" {
+			b = append(b, `,"value":`...)
+			b = strconv.AppendFloat(b, when.value, 'f', -1, 64)
+		}
+		if hasOld {
+			b = strconv.AppendFloat(append(b, `,"from":`...), old, 'f', -1, 64)
+		}
+		b = strconv.AppendFloat(append(b, `,"to":`...), value, 'f', -1, 64)
+		whens = append(whens, string(append(b, '}')))
+	}
+	if len(whens) == 0 {
+		return nil
+	}
+	res := fenceObjectJSON(sw, fence, details)
+	if len(res) == 0 || res[0] != '{' {
+		return nil
+	}
+	group := sw.s.groupGet(hookName, details.key, details.id)
+	if group == "" {
+		group = sw.s.groupConnect(hookName, details.key, details.id)
+	}
+	msgs := make([]string, len(whens))
+	for i, when := range whens {
+		msg := makemsg(details.command, group, "fieldchange", hookName,
+			metas, details.key, details.timestamp, res[1:])
+		// insert the condition before the last '}'
+		msgs[i] = msg[:len(msg)-1] + when + "}"
+	}
+	return msgs
+}
+
 func extendRoamMessage(
 	sw *scanWriter, fence *liveFenceSwitches,
 	kind string, baseMsg string, match roamMatch,
@@ -285,6 +381,12 @@ func extendRoamMessage(
 	nmsg = append(nmsg, `,"meters":`...)
 	nmsg = strconv.AppendFloat(nmsg,
 		math.Floor(match.meters*1000)/1000, 'f', -1, 64)
+	if !match.start.IsZero() {
+		nmsg = appendJSONTimeFormat(append(nmsg, `,"start":`...), match.start)
+		nmsg = append(nmsg, `,"duration":`...)
+		nmsg = strconv.AppendFloat(nmsg,
+			math.Floor(match.duration.Seconds()*1000)/1000, 'f', -1, 64)
+	}
 	if fence.roam.scan != "" {
 		nmsg = append(nmsg, `,"scan":[`...)
 		col := sw.s.getCol(fence.roam.key)
@@ -331,6 +433,24 @@ func extendRoamMessage(
 	return string(nmsg)
 }
 
+func extendRouteMessage(
+	fence *liveFenceSwitches, routeID string, baseMsg string, meters float64,
+) string {
+	// hack off the last '}'
+	nmsg := []byte(baseMsg[:len(baseMsg)-1])
+	nmsg = append(nmsg, `,"route":{"key":`...)
+	nmsg = appendJSONString(nmsg, fence.route.key)
+	nmsg = append(nmsg, `,"id":`...)
+	nmsg = appendJSONString(nmsg, routeID)
+	nmsg = append(nmsg, `,"distance":`...)
+	nmsg = strconv.AppendFloat(nmsg, math.Floor(meters*1000)/1000, 'f', -1, 64)
+	nmsg = append(nmsg, '}')
+
+	// re-add the last '}'
+	nmsg = append(nmsg, '}')
+	return string(nmsg)
+}
+
 func makemsg(
 	command, group, detect, hookName string,
 	metas []FenceMeta, key string, t time.Time, tail string,
@@ -417,8 +537,11 @@ func fenceMatchNearbys(
 
 func fenceMatchRoam(
 	s *Server, fence *liveFenceSwitches,
-	id string, old, obj geojson.Object,
+	id string, old, obj geojson.Object, now time.Time,
 ) (nearbys, faraways []roamMatch) {
+	if fence.roam.pairs != nil {
+		return fenceMatchRoamPairs(s, fence, id, obj, now)
+	}
 	oldNearbys := fenceMatchNearbys(s, fence, id, old)
 	newNearbys := fenceMatchNearbys(s, fence, id, obj)
 	// Go through all matching objects in new-nearbys and old-nearbys.
@@ -453,6 +576,123 @@ func fenceMatchRoam(
 	return nearbys, faraways
 }
 
+// fenceMatchRoamPairs is fenceMatchRoam for fences that track how long each
+// pair of objects has been together. A pair comes together within the roam
+// meters and separates beyond the SEPARATION meters. It is reported as nearby
+// once it has been together for MINDURATION, and as faraway when it
+// separates, but only if it was reported as nearby.
+func fenceMatchRoamPairs(
+	s *Server, fence *liveFenceSwitches,
+	id string, obj geojson.Object, now time.Time,
+) (nearbys, faraways []roamMatch) {
+	pairs := fence.roam.pairs
+	together := make(map[string]roamMatch)
+	for _, match := range fenceMatchNearbys(s, fence, id, obj) {
+		together[match.id] = match
+		if pairs.get(id, match.id) == nil {
+			pairs.add(id, match.id, now, fence.roam.key == fence.key)
+		}
+	}
+	separation := fence.roam.separation
+	if separation < fence.roam.meters {
+		separation = fence.roam.meters
+	}
+	col := s.getCol(fence.roam.key)
+	for other, pair := range pairs.ids[id] {
+		match, ok := together[other]
+		if !ok {
+			// not within the roam meters, but still together until
+			// separated
+			var obj2 geojson.Object
+			if col != nil {
+				obj2, _, _, ok = col.Get(other)
+			}
+			if !ok {
+				pairs.remove(id, other)
+				continue
+			}
+			match = roamMatch{id: other, obj: obj2, meters: obj.Distance(obj2)}
+			if match.meters > separation {
+				pairs.remove(id, other)
+				if pair.reported {
+					match.start, match.duration = pair.start, now.Sub(pair.start)
+					faraways = append(faraways, match)
+				}
+				continue
+			}
+		}
+		duration := now.Sub(pair.start)
+		if duration < fence.roam.minduration ||
+			(pair.reported && fence.nodwell) {
+			continue
+		}
+		pair.reported = true
+		match.start, match.duration = pair.start, duration
+		nearbys = append(nearbys, match)
+	}
+	sortRoamMatches(faraways)
+	sortRoamMatches(nearbys)
+	return nearbys, faraways
+}
+
+// roamPairs are the pairs of objects that are together in a roaming fence,
+// by the id of each object.
+type roamPairs struct {
+	ids map[string]map[string]*roamPair
+}
+
+type roamPair struct {
+	start    time.Time // when the pair came together
+	reported bool      // the pair was reported as nearby
+}
+
+func (rp *roamPairs) get(id, other string) *roamPair {
+	return rp.ids[id][other]
+}
+
+// add starts tracking a pair. Pairs of objects in the same collection are
+// added both ways, so that the pair is the same whichever object moves.
+func (rp *roamPairs) add(id, other string, start time.Time, symmetric bool) {
+	pair := &roamPair{start: start}
+	rp.set(id, other, pair)
+	if symmetric {
+		rp.set(other, id, pair)
+	}
+}
+
+func (rp *roamPairs) set(id, other string, pair *roamPair) {
+	if rp.ids == nil {
+		rp.ids = make(map[string]map[string]*roamPair)
+	}
+	if rp.ids[id] == nil {
+		rp.ids[id] = make(map[string]*roamPair)
+	}
+	rp.ids[id][other] = pair
+}
+
+func (rp *roamPairs) remove(id, other string) {
+	pair := rp.ids[id][other]
+	for _, ids := range [][2]string{{id, other}, {other, id}} {
+		if rp.ids[ids[0]][ids[1]] == pair {
+			delete(rp.ids[ids[0]], ids[1])
+			if len(rp.ids[ids[0]]) == 0 {
+				delete(rp.ids, ids[0])
+			}
+		}
+	}
+}
+
+// removeAll stops tracking the pairs of a deleted object.
+func (rp *roamPairs) removeAll(id string) {
+	for other := range rp.ids[id] {
+		rp.remove(id, other)
+	}
+}
+
+func (rp *roamPairs) reset() {
+	rp.ids = nil
+}
+
 // sortRoamMatches stable sorts roam matches
 func sortRoamMatches(matches []roamMatch) {
 	sort.Slice(matches, func(i, j int) bool {
@@ -465,3 +705,120 @@ func sortRoamMatches(matches []roamMatch) {
 		return matches[i].id < matches[j].id
 	})
 }
+
+// fenceRouteID returns the id of the route that an object is bound to,
+// which is a fixed id, the id of the object for "*", or the value of a
+// field. An object with a zero or missing field is not bound to a route.
+func fenceRouteID(
+	fence *liveFenceSwitches, details *commandDetails, fields []float64,
+) (string, bool) {
+	switch {
+	case fence.route.field != "":
+		idx, ok := details.fmap[fence.route.field]
+		if !ok || idx >= len(fields) || fields[idx] == 0 {
+			return "", false
+		}
+		return strconv.FormatFloat(fields[idx], 'f', -1, 64), true
+	case fence.route.id == "*":
+		return details.id, true
+	}
+	return fence.route.id, true
+}
+
+// fenceMatchRoute returns "deviate" when an object moves out of the corridor
+// around its route, and "return" when it moves back in, along with the id
+// of the route and the distance in meters from it. The detect is empty when
+// neither happened or when the route does not exist.
+func fenceMatchRoute(
+	s *Server, fence *liveFenceSwitches, details *commandDetails,
+) (detect, routeID string, meters float64) {
+	old, obj := details.oldObj, details.obj
+	if details.command == "fset" {
+		// FSET keeps the object and may only change its route
+		old = obj
+	}
+	col := s.getCol(fence.route.key)
+	if col == nil {
+		return "", "", 0
+	}
+	// getRoute returns the route that an object with the fields is bound to
+	getRoute := func(fields []float64) (string, geojson.Object, bool) {
+		routeID, ok := fenceRouteID(fence, details, fields)
+		if !ok {
+			return "", nil, false
+		}
+		route, _, _, ok := col.Get(routeID)
+		return routeID, route, ok
+	}
+	routeID, route, ok := getRoute(details.fields)
+	if !ok {
+		return "", "", 0
+	}
+	if meters, ok = routeDistance(route, obj.Center()); !ok {
+		return "", "", 0
+	}
+	off := meters > fence.route.meters
+	var wasOff bool
+	if old != nil && objIsSpatial(old) {
+		// the old position is measured against the route it was bound to,
+		// and an object without a route was never off route
+		if fence.route.field != "" {
+			_, route, ok = getRoute(details.oldFields)
+		}
+		if ok {
+			oldMeters, _ := routeDistance(route, old.Center())
+			wasOff = oldMeters > fence.route.meters
+		}
+	}
+	switch {
+	case off && !wasOff:
+		return "deviate", routeID, meters
+	case !off && wasOff:
+		return "return", routeID, meters
+	}
+	return "", routeID, meters
+}
+
+// routeDistance returns the distance in meters from a point to the nearest
+// segment of a route, which must be a LineString or MultiLineString.
+func routeDistance(route geojson.Object, point geometry.Point) (
+	meters float64, ok bool,
+) {
+	switch g := route.(type) {
+	case *geojson.Feature:
+		return routeDistance(g.Base(), point)
+	case *geojson.MultiLineString:
+		meters = math.Inf(+1)
+		for _, child := range g.Children() {
+			if d, cok := routeDistance(child, point); cok && d < meters {
+				meters, ok = d, true
+			}
+		}
+		return meters, ok
+	case *geojson.LineString:
+		line := g.Base()
+		meters = math.Inf(+1)
+		for i := 0; i < line.NumSegments(); i++ {
+			seg := line.SegmentAt(i)
+			if d := segmentDistance(point, seg.A, seg.B); d < meters {
+				meters = d
+			}
+		}
+		return meters, line.NumSegments() > 0
+	}
+	return 0, false
+}
+
+// segmentDistance returns the distance in meters from a point to a segment.
+// The nearest point on the segment is found on a plane around the point,
+// which is accurate enough at the scale of a route corridor.
+func segmentDistance(p, a, b geometry.Point) float64 {
+	kx := math.Cos(p.Y * math.Pi / 180)
+	ax, ay := (a.X-p.X)*kx, a.Y-p.Y
+	dx, dy := (b.X-a.X)*kx, b.Y-a.Y
+	var t float64
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+	return geo.DistanceTo(p.Y, p.X, a.Y+(b.Y-a.Y)*t, a.X+(b.X-a.X)*t)
+}
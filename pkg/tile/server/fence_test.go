@@ -0,0 +1,370 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/btree"
+	"github.com/bhojpur/space/pkg/utils/geojson"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+	"github.com/bhojpur/space/pkg/utils/rtree"
+)
+
+// newFenceTestServer returns a server with the collections that fences
+// read, and a function that parses a SETCHAN command into its hook.
+func newFenceTestServer(t *testing.T) (*Server, func(args string) *Hook) {
+	s := &Server{
+		cols:         btree.NewNonConcurrent(byCollectionKey),
+		hooks:        btree.NewNonConcurrent(byHookName),
+		groupHooks:   btree.NewNonConcurrent(byGroupHook),
+		groupObjects: btree.NewNonConcurrent(byGroupObject),
+	}
+	return s, func(args string) *Hook {
+		t.Helper()
+		hook, err := s.parseSetHook(&Message{
+			Args:       strings.Fields(args),
+			OutputType: JSON,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hook
+	}
+}
+
+// fenceDetects returns the detect of each message of a fence match.
+func fenceDetects(hook *Hook, d *commandDetails) []string {
+	d.timestamp = time.Now()
+	var detects []string
+	for _, msg := range FenceMatch(hook.Name, hook.ScanWriter, hook.Fence,
+		hook.Metas, d) {
+		detects = append(detects, gjson.Get(msg, "detect").String())
+	}
+	return detects
+}
+
+func TestRouteDistance(t *testing.T) {
+	route, err := geojson.Parse(`{"type":"LineString","coordinates":`+
+		`[[-115,33],[-115,33.01],[-114.99,33.01]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(meters, expect float64) bool {
+		return math.Abs(meters-expect) < 1
+	}
+	// a point beside the first segment, about 100 meters east
+	meters, ok := routeDistance(route, geometry.Point{X: -114.998927, Y: 33.005})
+	if !ok || !near(meters, 100) {
+		t.Fatalf("unexpected %v %v", meters, ok)
+	}
+	// a point past the start is measured to the first vertex
+	meters, ok = routeDistance(route, geometry.Point{X: -115, Y: 32.999})
+	if !ok || !near(meters, 111) {
+		t.Fatalf("unexpected %v %v", meters, ok)
+	}
+	// a point on the route
+	meters, ok = routeDistance(route, geometry.Point{X: -114.995, Y: 33.01})
+	if !ok || !near(meters, 0) {
+		t.Fatalf("unexpected %v %v", meters, ok)
+	}
+	multi, err := geojson.Parse(`{"type":"MultiLineString","coordinates":`+
+		`[[[-116,33],[-116,34]],[[-115,33],[-115,33.01]]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meters, ok = routeDistance(multi, geometry.Point{X: -114.998927, Y: 33.005})
+	if !ok || !near(meters, 100) {
+		t.Fatalf("unexpected %v %v", meters, ok)
+	}
+	point := geojson.NewPoint(geometry.Point{X: -115, Y: 33})
+	if _, ok := routeDistance(point, geometry.Point{X: -115, Y: 33}); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestRouteFence(t *testing.T) {
+	s, setchan := newFenceTestServer(t)
+	route, err := geojson.Parse(`{"type":"LineString","coordinates":`+
+		`[[-115,33],[-115,33.01]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := collection.New()
+	routes.Set("r1", route, nil, nil, 0)
+	routes.Set("truck1", route, nil, nil, 0)
+	routes.Set("7", route, nil, nil, 0)
+	s.setCol("routes", routes)
+
+	on, off := PO(-115, 33.005), PO(-114.99, 33.005)
+	fmap := map[string]int{"route": 0}
+	move := func(hook *Hook, old, obj geojson.Object, route float64) string {
+		t.Helper()
+		detects := fenceDetects(hook, &commandDetails{
+			command: "set", key: "fleet", id: "truck1",
+			oldObj: old, obj: obj, fmap: fmap, fields: []float64{route},
+			oldFields: []float64{route},
+		})
+		return strings.Join(detects, ",")
+	}
+
+	for _, routeID := range []string{"r1", "*", "FIELD route"} {
+		hook := setchan("SETCHAN c NEARBY fleet FENCE DETECT deviate,return " +
+			"ROUTE routes " + routeID + " 200")
+		steps := []struct {
+			old, obj geojson.Object
+			expect   string
+		}{
+			{nil, on, ""},
+			{on, on, ""},
+			{on, off, "deviate"},
+			{off, off, ""},
+			{off, on, "return"},
+		}
+		for i, step := range steps {
+			if got := move(hook, step.old, step.obj, 7); got != step.expect {
+				t.Fatalf("%s step %d: expected %q, got %q",
+					routeID, i, step.expect, got)
+			}
+		}
+	}
+
+	// the message names the route that the field binds the object to
+	hook := setchan("SETCHAN c NEARBY fleet FENCE DETECT deviate,return " +
+		"ROUTE routes FIELD route 200")
+	msgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, nil,
+		&commandDetails{
+			command: "set", key: "fleet", id: "truck1", oldObj: on, obj: off,
+			fmap: fmap, fields: []float64{7}, timestamp: time.Now(),
+		})
+	if len(msgs) != 1 || gjson.Get(msgs[0], "route.id").String() != "7" ||
+		gjson.Get(msgs[0], "route.distance").Float() < 900 {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+
+	// an object without a route, or with a missing one, is never off route
+	if got := move(hook, on, off, 0); got != "" {
+		t.Fatalf("expected no detect without a route, got %q", got)
+	}
+	if got := move(hook, on, off, 8); got != "" {
+		t.Fatalf("expected no detect for a missing route, got %q", got)
+	}
+
+	// an object that changes routes is measured against the old route at
+	// its old position
+	other, err := geojson.Parse(`{"type":"LineString","coordinates":`+
+		`[[-114.99,33],[-114.99,33.01]]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes.Set("9", other, nil, nil, 0)
+	rebind := func(command string, old, obj geojson.Object, from, to float64) string {
+		t.Helper()
+		return strings.Join(fenceDetects(hook, &commandDetails{
+			command: command, key: "fleet", id: "truck1",
+			oldObj: old, obj: obj, fmap: fmap, fields: []float64{to},
+			oldFields: []float64{from},
+		}), ",")
+	}
+	if got := rebind("set", on, off, 7, 9); got != "" {
+		t.Fatalf("expected no detect, got %q", got)
+	}
+	if got := rebind("set", off, off, 7, 9); got != "return" {
+		t.Fatalf("expected return, got %q", got)
+	}
+	if got := rebind("fset", nil, off, 9, 7); got != "deviate" {
+		t.Fatalf("expected deviate, got %q", got)
+	}
+	if got := rebind("fset", nil, off, 7, 7); got != "" {
+		t.Fatalf("expected no detect, got %q", got)
+	}
+}
+
+func TestDensityState(t *testing.T) {
+	var fence liveFenceSwitches
+	fence.mincount, fence.hasmin = 2, true
+	fence.maxcount, fence.hasmax = 4, true
+	for count, state := range []string{
+		"under", "under", "normal", "normal", "normal", "over",
+	} {
+		if s := densityState(&fence, count); s != state {
+			t.Fatalf("count %d: expected %s, got %s", count, state, s)
+		}
+	}
+	fence.hasmin = false
+	if s := densityState(&fence, 0); s != "normal" {
+		t.Fatalf("expected normal, got %s", s)
+	}
+}
+
+func TestDensityFence(t *testing.T) {
+	s, setchan := newFenceTestServer(t)
+	in, out := PO(-112.05, 33.45), PO(-111, 33)
+	col := collection.New()
+	col.Set("a", in, nil, nil, 0)
+	col.Set("b", in, nil, nil, 0)
+	col.Set("c", out, nil, nil, 0)
+	s.setCol("fleet", col)
+	hook := setchan("SETCHAN c WITHIN fleet FENCE DETECT density MIN 2 MAX 3 " +
+		"BOUNDS 33.4 -112.1 33.5 -112")
+	s.hooks.Set(hook)
+
+	// match returns the state and count of the message of an update
+	match := func(d *commandDetails) string {
+		t.Helper()
+		d.key = "fleet"
+		d.timestamp = time.Now()
+		msgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, nil, d)
+		if len(msgs) == 0 {
+			return ""
+		}
+		res := gjson.GetMany(msgs[0], "detect", "state", "count")
+		if len(msgs) != 1 || res[0].String() != "density" {
+			t.Fatalf("unexpected messages %v", msgs)
+		}
+		return res[1].String() + " " + res[2].String()
+	}
+	set := func(id string, obj geojson.Object) string {
+		t.Helper()
+		old, _, _, _ := col.Get(id)
+		col.Set(id, obj, nil, nil, 0)
+		return match(&commandDetails{command: "set", id: id, oldObj: old,
+			obj: obj})
+	}
+	del := func(id string) string {
+		t.Helper()
+		obj, _, _ := col.Delete(id)
+		return match(&commandDetails{command: "del", id: id, obj: obj})
+	}
+	steps := []struct {
+		update func() string
+		expect string
+	}{
+		// the first update counts a and b, which is normal
+		{func() string { return set("d", in) }, ""},
+		{func() string { return set("e", in) }, "over 4"},
+		{func() string { return set("e", in) }, ""},
+		{func() string { return set("c", in) }, ""},
+		{func() string { return del("c") }, ""},
+		{func() string { return del("e") }, "normal 3"},
+		{func() string { return set("a", out) }, ""},
+		{func() string { return set("b", out) }, "under 1"},
+	}
+	for i, step := range steps {
+		if got := step.update(); got != step.expect {
+			t.Fatalf("step %d: expected %q, got %q", i, step.expect, got)
+		}
+	}
+
+	// a follower that becomes the leader counts the objects that it was
+	// sent without the fence seeing them
+	col.Set("f", in, nil, nil, 0)
+	col.Set("g", in, nil, nil, 0)
+	s.resetFenceDensities()
+	if got := set("a", in); got != "over 4" {
+		t.Fatalf("expected over 4 after a reset, got %q", got)
+	}
+	col.Delete("f")
+	s.resetFenceDensities()
+	if got := match(&commandDetails{command: "del", id: "f", obj: in}); got != "normal 3" {
+		t.Fatalf("expected normal 3 after a reset, got %q", got)
+	}
+
+	if got := match(&commandDetails{command: "drop"}); got != "under 0" {
+		t.Fatalf("expected under 0 after a drop, got %q", got)
+	}
+}
+
+func TestDensityFenceUnseen(t *testing.T) {
+	s, setchan := newFenceTestServer(t)
+	s.hooksOut = btree.NewNonConcurrent(byHookName)
+	s.hookTree, s.hookCross = &rtree.RTree{}, &rtree.RTree{}
+	in := PO(-112.05, 33.45)
+	fmap := map[string]int{"speed": 0}
+	col := collection.New()
+	col.Set("a", in, []string{"speed"}, []float64{20}, 0)
+	col.Set("b", in, []string{"speed"}, []float64{5}, 0)
+	s.setCol("fleet", col)
+	hook := setchan("SETCHAN c WITHIN fleet FENCE DETECT density MAX 1 " +
+		"WHERE speed 10 inf BOUNDS 33.4 -112.1 33.5 -112")
+
+	// the first update is an FSET that moves b over the threshold
+	col.SetField("b", "speed", 30)
+	msgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, nil,
+		&commandDetails{command: "fset", key: "fleet", id: "b", obj: in,
+			fields: []float64{30}, oldFields: []float64{5}, fmap: fmap,
+			timestamp: time.Now()})
+	if len(msgs) != 1 || gjson.Get(msgs[0], "state").String() != "over" {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+
+	// a scheduled hook keeps counting outside of its windows
+	sc, err := parseHookSchedule("* 7-8 * * *", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook = setchan("SETCHAN c WITHIN fleet FENCE DETECT density MAX 2 " +
+		"WHERE speed 10 inf BOUNDS 33.4 -112.1 33.5 -112")
+	hook.schedule = sc
+	hook.paused = hookPauseDrop
+	s.hooksOut.Set(hook)
+	closed := time.Date(2020, 1, 6, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"c", "d"} {
+		col.Set(id, in, []string{"speed"}, []float64{20}, 0)
+		if err := s.queueHooks(&commandDetails{command: "set", key: "fleet",
+			id: id, obj: in, fields: []float64{20}, fmap: fmap,
+			timestamp: closed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(hook.Fence.density.ids); n != 4 {
+		t.Fatalf("expected a count of 4, got %d", n)
+	}
+	if hook.Fence.density.state != "over" {
+		t.Fatalf("expected over, got %s", hook.Fence.density.state)
+	}
+}
+
+func TestRoamPairs(t *testing.T) {
+	var pairs roamPairs
+	start := time.Now()
+	pairs.add("a", "b", start, true)
+	pairs.add("a", "c", start, false)
+	if pairs.get("a", "b") == nil || pairs.get("a", "b") != pairs.get("b", "a") {
+		t.Fatal("expected a shared pair")
+	}
+	if pairs.get("c", "a") != nil {
+		t.Fatal("expected no pair")
+	}
+	pairs.remove("b", "a")
+	if pairs.get("a", "b") != nil || pairs.get("b", "a") != nil {
+		t.Fatal("expected no pair")
+	}
+	pairs.removeAll("a")
+	if len(pairs.ids) != 0 {
+		t.Fatalf("expected no pairs, got %v", pairs.ids)
+	}
+}
@@ -111,6 +111,7 @@ func (s *Server) cmdFollow(msg *Message) (res resp.Value, err error) {
 			go s.follow(s.config.followHost(), s.config.followPort(), s.followc.get())
 		} else {
 			log.Infof("following no one")
+			s.resetFenceDensities()
 		}
 	}
 	return OKMessage(msg, start), nil
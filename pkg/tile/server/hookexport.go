@@ -0,0 +1,422 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/log"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+// hookExportVersion is the version of the HOOKS EXPORT document.
+const hookExportVersion = 1
+
+// hookImportOptions are the options that may appear in the "options" array
+// of an exported hook.
+var hookImportOptions = map[string]int{
+	"template": 1, "format": 1, "batch": 2, "sign": 1, "header": 2,
+	"cert": 2, "cacert": 1, "history": 1, "schedule": 2, "exitonclose": 0,
+	"paused": 1,
+}
+
+// hookSubcommand returns "export" or "import" when the HOOKS or CHANS
+// arguments are one of those subcommands rather than a pattern.
+func hookSubcommand(vs []string) string {
+	if len(vs) < 2 || (len(vs) == 3 && strings.ToLower(vs[1]) == "tag") {
+		return ""
+	}
+	switch sub := strings.ToLower(vs[0]); sub {
+	case "export", "import":
+		return sub
+	}
+	return ""
+}
+
+// appendHookExport appends the exported JSON object for a hook. The SIGN
+// secret is masked unless withSecrets is set.
+func appendHookExport(b []byte, hook *Hook, now time.Time,
+	withSecrets bool) []byte {
+	b = append(b, `{"name":`...)
+	b = appendJSONString(b, hook.Name)
+	if hook.channel {
+		b = append(b, `,"channel":true`...)
+	} else {
+		b = append(b, `,"endpoints":[`...)
+		for i, endpoint := range hook.Endpoints {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, endpoint)
+		}
+		b = append(b, ']')
+	}
+	b = append(b, `,"command":[`...)
+	for i, arg := range hook.Message.Args {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, arg)
+	}
+	b = append(b, `],"meta":{`...)
+	for i, meta := range hook.Metas {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, meta.Name)
+		b = append(b, ':')
+		b = appendJSONString(b, meta.Value)
+	}
+	b = append(b, '}')
+	if !hook.expires.IsZero() {
+		ex := float64(hook.expires.Sub(now)) / float64(time.Second)
+		if ex < 0 {
+			ex = 0
+		}
+		b = append(b, `,"ex":`...)
+		b = strconv.AppendFloat(b, ex, 'f', 1, 64)
+	}
+	b = append(b, `,"tags":[`...)
+	for i, tag := range hook.tags {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, tag)
+	}
+	b = append(b, `],"options":[`...)
+	var n int
+	for _, opt := range hook.options() {
+		if opt[0] == "tag" {
+			continue
+		}
+		if opt[0] == "sign" && !withSecrets {
+			opt = []string{opt[0], hiddenSecret}
+		}
+		if n > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		for i, arg := range opt {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, arg)
+		}
+		b = append(b, ']')
+		n++
+	}
+	return append(b, "]}"...)
+}
+
+// HOOKS EXPORT pattern [TAG tag] [WITHSECRETS]
+// CHANS EXPORT pattern [TAG tag]
+func (s *Server) cmdHooksExport(msg *Message) (res resp.Value, err error) {
+	channel := msg.Command() == "chans"
+	start := time.Now()
+	vs := msg.Args[2:]
+
+	var pattern, tag string
+	var withSecrets, ok bool
+	if vs, pattern, ok = tokenval(vs); !ok || pattern == "" {
+		return NOMessage, errInvalidNumberOfArguments
+	}
+	for len(vs) != 0 {
+		var arg string
+		vs, arg, _ = tokenval(vs)
+		switch strings.ToLower(arg) {
+		case "tag":
+			if vs, tag, ok = tokenval(vs); !ok || tag == "" {
+				return NOMessage, errInvalidNumberOfArguments
+			}
+		case "withsecrets":
+			if channel {
+				return NOMessage, errInvalidArgument(arg)
+			}
+			withSecrets = true
+		default:
+			return NOMessage, errInvalidArgument(arg)
+		}
+	}
+
+	// Secrets are masked as in HOOKS, unless WITHSECRETS asks for a
+	// document that can recreate the hooks elsewhere.
+	b := []byte(`{"version":` + strconv.Itoa(hookExportVersion) + `,"hooks":[`)
+	var i int
+	s.forEachHookByPattern(pattern, channel, func(hook *Hook) bool {
+		if tag != "" && !hook.hasTag(tag) {
+			return true
+		}
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendHookExport(b, hook, start, withSecrets)
+		i++
+		return true
+	})
+	b = append(b, "]}"...)
+
+	switch msg.OutputType {
+	case JSON:
+		return resp.StringValue(`{"ok":true,"export":` + string(b) +
+			`,"elapsed":"` + time.Since(start).String() + `"}`), nil
+	case RESP:
+		return resp.BytesValue(b), nil
+	}
+	return NOMessage, nil
+}
+
+// hookImportArgs returns the SETHOOK or SETCHAN arguments for an exported
+// hook. Channels are only imported by CHANS IMPORT, and hooks by HOOKS
+// IMPORT.
+func hookImportArgs(v gjson.Result, channel bool) ([]string, error) {
+	name := v.Get("name").String()
+	if name == "" {
+		return nil, errors.New("missing hook name")
+	}
+	if v.Get("channel").Bool() != channel {
+		if channel {
+			return nil, errors.New("not a channel")
+		}
+		return nil, errors.New("not a hook")
+	}
+	var args []string
+	if channel {
+		args = append(args, "setchan", name)
+	} else {
+		var endpoints []string
+		for _, endpoint := range v.Get("endpoints").Array() {
+			endpoints = append(endpoints, endpoint.String())
+		}
+		if len(endpoints) == 0 {
+			return nil, errors.New("missing endpoints")
+		}
+		args = append(args, "sethook", name, strings.Join(endpoints, ","))
+	}
+	v.Get("meta").ForEach(func(key, val gjson.Result) bool {
+		args = append(args, "meta", key.String(), val.String())
+		return true
+	})
+	if ex := v.Get("ex"); ex.Exists() {
+		args = append(args, "ex", strconv.FormatFloat(ex.Float(), 'f', -1, 64))
+	}
+	for _, opt := range v.Get("options").Array() {
+		vals := opt.Array()
+		if len(vals) == 0 {
+			return nil, errors.New("invalid option")
+		}
+		name := strings.ToLower(vals[0].String())
+		if n, ok := hookImportOptions[name]; !ok || n != len(vals)-1 {
+			return nil, errInvalidArgument(vals[0].String())
+		}
+		if name == "sign" && vals[1].String() == hiddenSecret {
+			return nil, errors.New("masked secret, export WITHSECRETS")
+		}
+		for _, val := range vals {
+			args = append(args, val.String())
+		}
+	}
+	for _, tag := range v.Get("tags").Array() {
+		args = append(args, "tag", tag.String())
+	}
+	command := v.Get("command").Array()
+	if len(command) == 0 {
+		return nil, errors.New("missing command")
+	}
+	for _, arg := range command {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// hookChanges returns the names of the settings that differ between two
+// hooks.
+func hookChanges(prev, hook *Hook) []string {
+	var changes []string
+	if strings.Join(prev.Endpoints, ",") != strings.Join(hook.Endpoints, ",") {
+		changes = append(changes, "endpoints")
+	}
+	if strings.Join(prev.Message.Args, "\x00") !=
+		strings.Join(hook.Message.Args, "\x00") {
+		changes = append(changes, "command")
+	}
+	metas := func(h *Hook) string {
+		var parts []string
+		for _, meta := range h.Metas {
+			parts = append(parts, meta.Name+"\x00"+meta.Value)
+		}
+		return strings.Join(parts, "\x00")
+	}
+	if metas(prev) != metas(hook) {
+		changes = append(changes, "meta")
+	}
+	// the expiration of an imported hook is relative to the time of the
+	// import, so allow for the time it took to move the document.
+	drift := prev.expires.Sub(hook.expires)
+	if drift < 0 {
+		drift = -drift
+	}
+	if prev.expires.IsZero() != hook.expires.IsZero() || drift > time.Minute {
+		changes = append(changes, "ex")
+	}
+	opts := func(h *Hook) map[string]string {
+		m := make(map[string]string)
+		for _, opt := range h.options() {
+			m[opt[0]] += strings.Join(opt[1:], "\x00") + "\x00"
+		}
+		return m
+	}
+	popts, hopts := opts(prev), opts(hook)
+	for _, name := range []string{"template", "format", "batch", "sign",
+		"header", "cert", "cacert", "history", "schedule", "exitonclose",
+		"tag", "paused"} {
+		if popts[name] != hopts[name] {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+// HOOKS IMPORT [DRYRUN] document
+// CHANS IMPORT [DRYRUN] document
+func (s *Server) cmdHooksImport(msg *Message) (res resp.Value, err error) {
+	channel := msg.Command() == "chans"
+	start := time.Now()
+	vs := msg.Args[2:]
+
+	var dryrun bool
+	if len(vs) == 2 && strings.ToLower(vs[0]) == "dryrun" {
+		dryrun = true
+		vs = vs[1:]
+	}
+	if len(vs) != 1 {
+		return NOMessage, errInvalidNumberOfArguments
+	}
+	doc := vs[0]
+	if !gjson.Valid(doc) {
+		return NOMessage, errors.New("invalid export document")
+	}
+	if version := gjson.Get(doc, "version").Int(); version != hookExportVersion {
+		return NOMessage, errors.New("unsupported export version " +
+			strconv.FormatInt(version, 10))
+	}
+
+	// parse every hook before changing anything
+	type hookImport struct {
+		args    []string
+		hook    *Hook
+		action  string
+		changes []string
+	}
+	var imports []hookImport
+	names := make(map[string]bool)
+	for i, v := range gjson.Get(doc, "hooks").Array() {
+		args, err := hookImportArgs(v, channel)
+		if err == nil && names[args[1]] {
+			err = errors.New("duplicate hook")
+		}
+		var hook *Hook
+		if err == nil {
+			names[args[1]] = true
+			hook, err = s.parseSetHook(&Message{
+				Args:       args,
+				ConnType:   msg.ConnType,
+				OutputType: msg.OutputType,
+			})
+		}
+		if err != nil {
+			name := v.Get("name").String()
+			if name == "" {
+				name = "#" + strconv.Itoa(i)
+			}
+			return NOMessage, errors.New("hook " + name + ": " + err.Error())
+		}
+		imp := hookImport{args: args, hook: hook, action: "create"}
+		if prev, _ := s.hooks.Get(&Hook{Name: hook.Name}).(*Hook); prev != nil {
+			imp.changes = hookChanges(prev, hook)
+			if len(imp.changes) == 0 {
+				imp.action = "unchanged"
+			} else {
+				imp.action = "replace"
+			}
+		}
+		imports = append(imports, imp)
+	}
+
+	if !dryrun {
+		for _, imp := range imports {
+			if imp.action == "unchanged" || !s.setHook(imp.hook) {
+				continue
+			}
+			d := commandDetails{updated: true, timestamp: time.Now()}
+			if err := s.writeAOF(imp.args, &d); err != nil {
+				log.Fatal(err)
+				return NOMessage, err
+			}
+		}
+	}
+
+	switch msg.OutputType {
+	case JSON:
+		var buf bytes.Buffer
+		buf.WriteString(`{"ok":true,"dryrun":` + strconv.FormatBool(dryrun) +
+			`,"hooks":[`)
+		for i, imp := range imports {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(`{"name":` + jsonString(imp.hook.Name) +
+				`,"action":` + jsonString(imp.action))
+			if len(imp.changes) > 0 {
+				buf.WriteString(`,"changes":[`)
+				for j, change := range imp.changes {
+					if j > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(jsonString(change))
+				}
+				buf.WriteByte(']')
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteString(`],"elapsed":"` + time.Since(start).String() + `"}`)
+		return resp.StringValue(buf.String()), nil
+	case RESP:
+		var vals []resp.Value
+		for _, imp := range imports {
+			var changes []resp.Value
+			for _, change := range imp.changes {
+				changes = append(changes, resp.StringValue(change))
+			}
+			vals = append(vals, resp.ArrayValue([]resp.Value{
+				resp.StringValue(imp.hook.Name),
+				resp.StringValue(imp.action),
+				resp.ArrayValue(changes),
+			}))
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
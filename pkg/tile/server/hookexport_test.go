@@ -0,0 +1,110 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/endpoint"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+)
+
+func TestHookSubcommand(t *testing.T) {
+	for _, tc := range []struct {
+		args string
+		sub  string
+	}{
+		{"*", ""},
+		{"export", ""},
+		{"export *", "export"},
+		{"EXPORT * TAG ops", "export"},
+		{"export TAG ops", ""},
+		{"import {}", "import"},
+		{"import DRYRUN {}", "import"},
+	} {
+		if sub := hookSubcommand(strings.Split(tc.args, " ")); sub != tc.sub {
+			t.Fatalf("%q: expected %q, got %q", tc.args, tc.sub, sub)
+		}
+	}
+}
+
+func TestHookImportArgs(t *testing.T) {
+	args, err := hookImportArgs(gjson.Parse(`{"name":"h1",` +
+		`"endpoints":["http://a","http://b"],"command":["NEARBY","fleet",` +
+		`"FENCE","POINT","33","-112","500"],"meta":{"a":"1"},"ex":10.5,` +
+		`"tags":["ops"],"options":[["batch","10","1.5"]]}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "sethook h1 http://a,http://b meta a 1 ex 10.5 batch 10 1.5 " +
+		"tag ops NEARBY fleet FENCE POINT 33 -112 500"
+	if strings.Join(args, " ") != exp {
+		t.Fatalf("expected %q, got %q", exp, strings.Join(args, " "))
+	}
+	args, err = hookImportArgs(gjson.Parse(`{"name":"c1","channel":true,` +
+		`"command":["NEARBY","fleet","FENCE","POINT","33","-112","500"]}`), true)
+	if err != nil || args[0] != "setchan" {
+		t.Fatalf("unexpected %v %v", args, err)
+	}
+	for _, doc := range []string{
+		`{"endpoints":["http://a"],"command":["NEARBY"]}`,
+		`{"name":"h1","command":["NEARBY"]}`,
+		`{"name":"h1","endpoints":["http://a"]}`,
+		`{"name":"h1","endpoints":["http://a"],"command":["NEARBY"],` +
+			`"options":[["nearby","fleet"]]}`,
+		`{"name":"h1","endpoints":["http://a"],"command":["NEARBY"],` +
+			`"options":[["batch","10"]]}`,
+		`{"name":"h1","endpoints":["http://a"],"command":["NEARBY"],` +
+			`"options":[["sign","********"]]}`,
+		`{"name":"c1","channel":true,"command":["NEARBY"]}`,
+	} {
+		if _, err := hookImportArgs(gjson.Parse(doc), false); err == nil {
+			t.Fatalf("expected error for %s", doc)
+		}
+	}
+	// CHANS IMPORT only takes channels
+	if _, err := hookImportArgs(gjson.Parse(`{"name":"h1",`+
+		`"endpoints":["http://a"],"command":["NEARBY"]}`), true); err == nil {
+		t.Fatal("expected an error for a hook")
+	}
+}
+
+func TestHookExportSecrets(t *testing.T) {
+	hook := &Hook{
+		Name:      "h1",
+		Endpoints: []string{"http://a"},
+		Message:   &Message{Args: []string{"NEARBY", "fleet"}},
+		httpOpts:  &endpoint.HTTPOptions{Secret: "topsecret"},
+	}
+	sign := func(withSecrets bool) string {
+		t.Helper()
+		b := appendHookExport(nil, hook, time.Now(), withSecrets)
+		return gjson.GetBytes(b, `options.#(0=="sign").1`).String()
+	}
+	if secret := sign(false); secret != hiddenSecret {
+		t.Fatalf("expected a masked secret, got %q", secret)
+	}
+	if secret := sign(true); secret != "topsecret" {
+		t.Fatalf("expected the secret, got %q", secret)
+	}
+}
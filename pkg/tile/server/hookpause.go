@@ -0,0 +1,193 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"time"
+
+	kvdb "github.com/bhojpur/space/pkg/data/base"
+	"github.com/bhojpur/space/pkg/tile/log"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+// Policies for the events of a paused hook
+const (
+	hookPauseBuffer = "buffer" // queue events until the hook is resumed
+	hookPauseDrop   = "drop"   // discard events while the hook is paused
+)
+
+var hookPausedSetDefaults = &kvdb.SetOptions{
+	Expires: true, // automatically delete after 24 hours
+	TTL:     time.Hour * 24,
+}
+
+func parseHookPausePolicy(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case hookPauseBuffer:
+		return hookPauseBuffer, nil
+	case hookPauseDrop:
+		return hookPauseDrop, nil
+	}
+	return "", errInvalidArgument(s)
+}
+
+// hasTag returns true if the hook has the tag.
+func (h *Hook) hasTag(tag string) bool {
+	for _, t := range h.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachHookByPatternAndTag iterates over the hooks and the channels that
+// match the pattern and, when a tag is provided, have that tag.
+func (s *Server) forEachHookByPatternAndTag(
+	pattern, tag string, iter func(hook *Hook) bool,
+) {
+	for _, channel := range []bool{false, true} {
+		ok := true
+		s.forEachHookByPattern(pattern, channel, func(hook *Hook) bool {
+			if tag != "" && !hook.hasTag(tag) {
+				return true
+			}
+			ok = iter(hook)
+			return ok
+		})
+		if !ok {
+			return
+		}
+	}
+}
+
+// HOOKPAUSE pattern [TAG tag] [BUFFER|DROP]
+// HOOKRESUME pattern [TAG tag]
+func (s *Server) cmdHookPause(msg *Message) (
+	res resp.Value, d commandDetails, err error,
+) {
+	resume := msg.Command() == "hookresume"
+	start := time.Now()
+	vs := msg.Args[1:]
+
+	var pattern, tag, arg string
+	var ok bool
+	if vs, pattern, ok = tokenval(vs); !ok || pattern == "" {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	policy := hookPauseBuffer
+	for len(vs) > 0 {
+		vs, arg, _ = tokenval(vs)
+		switch {
+		case strings.ToLower(arg) == "tag":
+			if vs, tag, ok = tokenval(vs); !ok || tag == "" {
+				return NOMessage, d, errInvalidNumberOfArguments
+			}
+		case !resume:
+			if policy, err = parseHookPausePolicy(arg); err != nil {
+				return NOMessage, d, err
+			}
+		default:
+			return NOMessage, d, errInvalidArgument(arg)
+		}
+	}
+	if resume {
+		policy = ""
+	}
+
+	var hooks []*Hook
+	s.forEachHookByPatternAndTag(pattern, tag, func(hook *Hook) bool {
+		if hook.paused != policy {
+			hooks = append(hooks, hook)
+		}
+		return true
+	})
+	for _, hook := range hooks {
+		hook.pause(policy)
+		if resume && hook.channel && s.loadedAndReady.on() {
+			s.drainChanQueue(hook)
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	switch msg.OutputType {
+	case JSON:
+		return OKMessage(msg, start), d, nil
+	case RESP:
+		return resp.IntegerValue(len(hooks)), d, nil
+	}
+	return
+}
+
+// pause sets the pause policy of the hook. An empty policy resumes the hook,
+// which then sends the events that were buffered while it was paused.
+func (h *Hook) pause(policy string) {
+	h.cond.L.Lock()
+	h.paused = policy
+	h.cond.L.Unlock()
+	if policy == "" {
+		h.Signal()
+	}
+}
+
+// drainChanQueue publishes the messages that were buffered while a channel
+// was paused.
+func (s *Server) drainChanQueue(hook *Hook) {
+	query := `{"hook":` + jsonString(hook.Name) + `}`
+	err := s.qdb.Update(func(tx *kvdb.Tx) error {
+		var keys, vals []string
+		tx.AscendGreaterOrEqual("hooks", query, func(key, val string) bool {
+			if gjson.Get(val, "hook").String() != hook.Name {
+				return false
+			}
+			keys = append(keys, key)
+			vals = append(vals, val)
+			return true
+		})
+		for i, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+			emsg, err := hook.render(vals[i])
+			if err != nil {
+				log.Errorf("channel %s: %v", hook.Name, err)
+				continue
+			}
+			m := emsg.Encode()
+			if hook.history == nil {
+				s.Publish(hook.Name, m)
+				continue
+			}
+			m, id := s.publishChanHistory(hook, m)
+			if err := s.appendChanHistory(tx, hook, m, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		delete(s.chlens, hook.Name)
+		log.Errorf("channel %s: %v", hook.Name, err)
+	}
+}
@@ -49,27 +49,50 @@ func byHookName(a, b interface{}) bool {
 func (s *Server) cmdSetHook(msg *Message) (
 	res resp.Value, d commandDetails, err error,
 ) {
-	channel := msg.Command() == "setchan"
 	start := time.Now()
+	hook, err := s.parseSetHook(msg)
+	if err != nil {
+		return NOMessage, d, err
+	}
+	if s.setHook(hook) {
+		d.updated = true
+		d.timestamp = time.Now()
+	}
+	switch msg.OutputType {
+	case JSON:
+		return OKMessage(msg, start), d, nil
+	case RESP:
+		if d.updated {
+			return resp.IntegerValue(1), d, nil
+		}
+		return resp.IntegerValue(0), d, nil
+	}
+	return NOMessage, d, nil
+}
+
+// parseSetHook returns the hook for a SETHOOK or SETCHAN command without
+// adding it to the server.
+func (s *Server) parseSetHook(msg *Message) (hook *Hook, err error) {
+	channel := msg.Command() == "setchan"
 	vs := msg.Args[1:]
 	var name, urls, cmd string
 	var ok bool
 	if vs, name, ok = tokenval(vs); !ok || name == "" {
-		return NOMessage, d, errInvalidNumberOfArguments
+		return nil, errInvalidNumberOfArguments
 	}
 	var endpoints []string
 	if channel {
 		endpoints = []string{"local://" + name}
 	} else {
 		if vs, urls, ok = tokenval(vs); !ok || urls == "" {
-			return NOMessage, d, errInvalidNumberOfArguments
+			return nil, errInvalidNumberOfArguments
 		}
 		for _, url := range strings.Split(urls, ",") {
 			url = strings.TrimSpace(url)
 			err := s.epc.Validate(url)
 			if err != nil {
 				log.Errorf("sethook: %v", err)
-				return resp.SimpleStringValue(""), d, errInvalidArgument(url)
+				return nil, errInvalidArgument(url)
 			}
 			endpoints = append(endpoints, url)
 		}
@@ -79,39 +102,176 @@ func (s *Server) cmdSetHook(msg *Message) (
 	var types map[string]bool
 	var expires float64
 	var expiresSet bool
+	var tmpl *hookTemplate
+	var format endpoint.Format
+	var batchSize int
+	var batchWait time.Duration
+	var httpOpts endpoint.HTTPOptions
+	var history *chanHistory
+	var schedule *hookSchedule
+	var exitOnClose bool
+	var tags []string
+	var paused string
 	metaMap := make(map[string]string)
 	for {
 		commandvs = vs
 		if vs, cmd, ok = tokenval(vs); !ok || cmd == "" {
-			return NOMessage, d, errInvalidNumberOfArguments
+			return nil, errInvalidNumberOfArguments
 		}
 		cmdlc = strings.ToLower(cmd)
 		switch cmdlc {
 		default:
-			return NOMessage, d, errInvalidArgument(cmd)
+			return nil, errInvalidArgument(cmd)
 		case "meta":
 			var metakey string
 			var metaval string
 			if vs, metakey, ok = tokenval(vs); !ok || metakey == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			if vs, metaval, ok = tokenval(vs); !ok || metaval == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			metaMap[metakey] = metaval
 			continue
 		case "ex":
 			var s string
 			if vs, s, ok = tokenval(vs); !ok || s == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			v, err := strconv.ParseFloat(s, 64)
 			if err != nil {
-				return NOMessage, d, errInvalidArgument(s)
+				return nil, errInvalidArgument(s)
 			}
 			expires = v
 			expiresSet = true
 			continue
+		case "template":
+			var src string
+			if vs, src, ok = tokenval(vs); !ok || src == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			tmpl, err = parseHookTemplate(src)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case "format":
+			var s string
+			if vs, s, ok = tokenval(vs); !ok || s == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			format, err = endpoint.ParseFormat(s)
+			if err != nil || (channel && format == endpoint.FormatProtobuf) {
+				return nil, errInvalidArgument(s)
+			}
+			for _, url := range endpoints {
+				if !format.Supports(url) {
+					return nil, errInvalidArgument(s)
+				}
+			}
+			continue
+		case "sign", "header", "cert", "cacert":
+			if channel {
+				return nil, errInvalidArgument(cmd)
+			}
+			n := 1
+			if cmdlc == "header" || cmdlc == "cert" {
+				n = 2
+			}
+			args := make([]string, n)
+			for i := range args {
+				if vs, args[i], ok = tokenval(vs); !ok || args[i] == "" {
+					return nil, errInvalidNumberOfArguments
+				}
+			}
+			switch cmdlc {
+			case "sign":
+				httpOpts.Secret = args[0]
+			case "header":
+				httpOpts.Headers = append(httpOpts.Headers,
+					[2]string{args[0], args[1]})
+			case "cert":
+				httpOpts.CertFile, httpOpts.KeyFile = args[0], args[1]
+			case "cacert":
+				httpOpts.CACertFile = args[0]
+			}
+			continue
+		case "tag":
+			var tag string
+			if vs, tag, ok = tokenval(vs); !ok || tag == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			for _, t := range tags {
+				if t == tag {
+					tag = ""
+					break
+				}
+			}
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+			continue
+		case "paused":
+			var s string
+			if vs, s, ok = tokenval(vs); !ok || s == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			if paused, err = parseHookPausePolicy(s); err != nil {
+				return nil, err
+			}
+			continue
+		case "history":
+			if !channel {
+				return nil, errInvalidArgument(cmd)
+			}
+			var src string
+			if vs, src, ok = tokenval(vs); !ok || src == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			history, err = parseChanHistory(src)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case "schedule":
+			var src, tz string
+			if vs, src, ok = tokenval(vs); !ok || src == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			if vs, tz, ok = tokenval(vs); !ok || tz == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			schedule, err = parseHookSchedule(src, tz)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case "exitonclose":
+			exitOnClose = true
+			continue
+		case "batch":
+			if channel {
+				return nil, errInvalidArgument(cmd)
+			}
+			var ssize, swait string
+			if vs, ssize, ok = tokenval(vs); !ok || ssize == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			if vs, swait, ok = tokenval(vs); !ok || swait == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			n, err := strconv.ParseUint(ssize, 10, 32)
+			if err != nil || n == 0 {
+				return nil, errInvalidArgument(ssize)
+			}
+			wait, err := strconv.ParseFloat(swait, 64)
+			if err != nil || wait < 0 ||
+				wait >= hookLogSetDefaults.TTL.Seconds() {
+				return nil, errInvalidArgument(swait)
+			}
+			batchSize = int(n)
+			batchWait = time.Duration(wait * float64(time.Second))
+			continue
 		case "nearby":
 			types = nearbyTypes
 		case "within", "intersects":
@@ -124,10 +284,16 @@ func (s *Server) cmdSetHook(msg *Message) (
 		defer args.Close()
 	}
 	if err != nil {
-		return NOMessage, d, err
+		return nil, err
 	}
 	if !args.fence {
-		return NOMessage, d, errors.New("missing FENCE argument")
+		return nil, errors.New("missing FENCE argument")
+	}
+	if exitOnClose {
+		if schedule == nil {
+			return nil, errors.New("missing SCHEDULE argument")
+		}
+		schedule.exit = true
 	}
 	args.cmd = cmdlc
 	cmsg := &Message{}
@@ -142,7 +308,7 @@ func (s *Server) cmdSetHook(msg *Message) (
 	}
 	sort.Sort(hookMetaByName(metas))
 
-	hook := &Hook{
+	hook = &Hook{
 		Key:       args.key,
 		Name:      name,
 		Endpoints: endpoints,
@@ -150,10 +316,22 @@ func (s *Server) cmdSetHook(msg *Message) (
 		Message:   cmsg,
 		epm:       s.epc,
 		Metas:     metas,
+		Template:  tmpl,
+		Format:    format,
+		batchSize: batchSize,
+		batchWait: batchWait,
+		history:   history,
+		schedule:  schedule,
+		tags:      tags,
+		paused:    paused,
 		channel:   channel,
 		cond:      sync.NewCond(&sync.Mutex{}),
 		counter:   &s.statsTotalMsgsSent,
 	}
+	if httpOpts.Secret != "" || len(httpOpts.Headers) > 0 ||
+		httpOpts.CertFile != "" || httpOpts.CACertFile != "" {
+		hook.httpOpts = &httpOpts
+	}
 	if expiresSet {
 		hook.expires =
 			time.Now().Add(time.Duration(expires * float64(time.Second)))
@@ -165,17 +343,29 @@ func (s *Server) cmdSetHook(msg *Message) (
 	hook.ScanWriter, err = s.newScanWriter(
 		&wr, cmsg, args.key, args.output, args.precision, args.glob, false,
 		args.cursor, args.limit, args.wheres, args.whereins, args.whereevals,
-		args.nofields)
+		args.filter, args.orderBy, args.fields, args.nofields, args.nogeometry,
+		args.profile)
 	if err != nil {
-
-		return NOMessage, d, err
+		return nil, err
 	}
-	prevHook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook)
-	if prevHook != nil {
+	if prevHook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook); prevHook != nil {
 		if prevHook.channel != channel {
-			return NOMessage, d,
+			return nil,
 				errors.New("hooks and channels cannot share the same name")
 		}
+		if paused == "" {
+			// redefining a paused hook does not resume it
+			hook.paused = prevHook.paused
+		}
+	}
+	return hook, nil
+}
+
+// setHook adds a hook to the server, replacing any hook with the same name.
+// It returns false if an identical hook already exists.
+func (s *Server) setHook(hook *Hook) bool {
+	prevHook, _ := s.hooks.Get(&Hook{Name: hook.Name}).(*Hook)
+	if prevHook != nil {
 		if prevHook.Equals(hook) {
 			// it was a match so we do nothing. But let's signal just
 			// for good measure.
@@ -183,27 +373,25 @@ func (s *Server) cmdSetHook(msg *Message) (
 			if !hook.expires.IsZero() {
 				s.hookExpires.Set(hook)
 			}
-			switch msg.OutputType {
-			case JSON:
-				return OKMessage(msg, start), d, nil
-			case RESP:
-				return resp.IntegerValue(0), d, nil
-			}
+			return false
 		}
 		prevHook.Close()
+		delete(s.chlens, hook.Name)
+		if prevHook.history != nil && hook.history == nil &&
+			s.loadedAndReady.on() {
+			s.deleteChanHistory(hook.Name)
+		}
 		s.hooks.Delete(prevHook)
 		s.hooksOut.Delete(prevHook)
 		if !prevHook.expires.IsZero() {
 			s.hookExpires.Delete(prevHook)
 		}
-		s.groupDisconnectHook(name)
+		s.groupDisconnectHook(hook.Name)
 	}
 
-	d.updated = true
-	d.timestamp = time.Now()
-
 	s.hooks.Set(hook)
-	if hook.Fence.detect == nil || hook.Fence.detect["outside"] {
+	if hook.Fence.detect == nil || hook.Fence.detect["outside"] ||
+		hook.Fence.route.on || hook.Fence.density != nil {
 		s.hooksOut.Set(hook)
 	}
 
@@ -240,13 +428,7 @@ func (s *Server) cmdSetHook(msg *Message) (
 	if !hook.expires.IsZero() {
 		s.hookExpires.Set(hook)
 	}
-	switch msg.OutputType {
-	case JSON:
-		return OKMessage(msg, start), d, nil
-	case RESP:
-		return resp.IntegerValue(1), d, nil
-	}
-	return NOMessage, d, nil
+	return true
 }
 
 func byHookExpires(a, b interface{}) bool {
@@ -279,6 +461,9 @@ func (s *Server) cmdDelHook(msg *Message) (
 	hook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook)
 	if hook != nil && hook.channel == channel {
 		hook.Close()
+		if hook.history != nil && s.loadedAndReady.on() {
+			s.deleteChanHistory(hook.Name)
+		}
 		// remove hook from maps
 		s.hooks.Delete(hook)
 		s.hooksOut.Delete(hook)
@@ -345,6 +530,9 @@ func (s *Server) cmdPDelHook(msg *Message) (
 			continue
 		}
 		hook.Close()
+		if hook.history != nil && s.loadedAndReady.on() {
+			s.deleteChanHistory(hook.Name)
+		}
 		// remove hook from maps
 		s.hooks.Delete(hook)
 		s.hooksOut.Delete(hook)
@@ -408,14 +596,37 @@ func (s *Server) cmdHooks(msg *Message) (
 	start := time.Now()
 	vs := msg.Args[1:]
 
+	switch hookSubcommand(vs) {
+	case "export":
+		return s.cmdHooksExport(msg)
+	case "import":
+		return s.cmdHooksImport(msg)
+	}
+
 	var pattern string
 	var ok bool
 
 	if vs, pattern, ok = tokenval(vs); !ok || pattern == "" {
 		return NOMessage, errInvalidNumberOfArguments
 	}
+	var tag string
 	if len(vs) != 0 {
-		return NOMessage, errInvalidNumberOfArguments
+		var arg string
+		vs, arg, _ = tokenval(vs)
+		if strings.ToLower(arg) != "tag" {
+			return NOMessage, errInvalidArgument(arg)
+		}
+		if vs, tag, ok = tokenval(vs); !ok || tag == "" || len(vs) != 0 {
+			return NOMessage, errInvalidNumberOfArguments
+		}
+	}
+	forEachHook := func(iter func(hook *Hook) bool) {
+		s.forEachHookByPattern(pattern, channel, func(hook *Hook) bool {
+			if tag != "" && !hook.hasTag(tag) {
+				return true
+			}
+			return iter(hook)
+		})
 	}
 
 	switch msg.OutputType {
@@ -428,7 +639,7 @@ func (s *Server) cmdHooks(msg *Message) (
 			buf.WriteString(`"hooks":[`)
 		}
 		var i int
-		s.forEachHookByPattern(pattern, channel, func(hook *Hook) bool {
+		forEachHook(func(hook *Hook) bool {
 			var ttl = -1
 			if !hook.expires.IsZero() {
 				ttl = int(hook.expires.Sub(start).Seconds())
@@ -469,7 +680,9 @@ func (s *Server) cmdHooks(msg *Message) (
 				buf.WriteString(`:`)
 				buf.WriteString(jsonString(meta.Value))
 			}
-			buf.WriteString(`}}`)
+			buf.WriteString(`}`)
+			writeHookOptionsJSON(buf, hook.options())
+			buf.WriteString(`}`)
 			i++
 			return true
 		})
@@ -478,7 +691,7 @@ func (s *Server) cmdHooks(msg *Message) (
 		return resp.StringValue(buf.String()), nil
 	case RESP:
 		var vals []resp.Value
-		s.forEachHookByPattern(pattern, channel, func(hook *Hook) bool {
+		forEachHook(func(hook *Hook) bool {
 			var hvals []resp.Value
 			hvals = append(hvals, resp.StringValue(hook.Name))
 			hvals = append(hvals, resp.StringValue(hook.Key))
@@ -498,6 +711,27 @@ func (s *Server) cmdHooks(msg *Message) (
 				metas = append(metas, resp.StringValue(meta.Value))
 			}
 			hvals = append(hvals, resp.ArrayValue(metas))
+			var opts []resp.Value
+			for _, opt := range hook.options() {
+				if opt[0] == "sign" {
+					opt = []string{opt[0], hiddenSecret}
+				}
+				opts = append(opts, resp.StringValue(opt[0]))
+				if len(opt) == 1 {
+					opts = append(opts, resp.IntegerValue(1))
+					continue
+				}
+				if len(opt) == 2 {
+					opts = append(opts, resp.StringValue(opt[1]))
+					continue
+				}
+				var args []resp.Value
+				for _, arg := range opt[1:] {
+					args = append(args, resp.StringValue(arg))
+				}
+				opts = append(opts, resp.ArrayValue(args))
+			}
+			hvals = append(hvals, resp.ArrayValue(opts))
 			vals = append(vals, resp.ArrayValue(hvals))
 			return true
 		})
@@ -506,6 +740,57 @@ func (s *Server) cmdHooks(msg *Message) (
 	return resp.SimpleStringValue(""), nil
 }
 
+// hiddenSecret replaces the SIGN secret in the HOOKS output
+const hiddenSecret = "********"
+
+// writeHookOptionsJSON writes the hook options as JSON members. Options with
+// one argument are strings, those with more are arrays, and flags are true.
+// Headers and tags, which may appear more than once, are always written as
+// arrays.
+func writeHookOptionsJSON(buf *bytes.Buffer, opts [][]string) {
+	writeArgs := func(opt []string) {
+		if len(opt) == 1 {
+			buf.WriteString("true")
+			return
+		}
+		if len(opt) == 2 {
+			buf.WriteString(jsonString(opt[1]))
+			return
+		}
+		buf.WriteByte('[')
+		for i, arg := range opt[1:] {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(jsonString(arg))
+		}
+		buf.WriteByte(']')
+	}
+	for i := 0; i < len(opts); i++ {
+		if opts[i][0] == "sign" {
+			opts[i] = []string{opts[i][0], hiddenSecret}
+		}
+		j := i + 1
+		for j < len(opts) && opts[j][0] == opts[i][0] {
+			j++
+		}
+		buf.WriteString(`,` + jsonString(opts[i][0]) + `:`)
+		if j == i+1 && opts[i][0] != "header" && opts[i][0] != "tag" {
+			writeArgs(opts[i])
+			continue
+		}
+		buf.WriteByte('[')
+		for k := i; k < j; k++ {
+			if k > i {
+				buf.WriteByte(',')
+			}
+			writeArgs(opts[k])
+		}
+		buf.WriteByte(']')
+		i = j - 1
+	}
+}
+
 // Hook represents a hook.
 type Hook struct {
 	cond       *sync.Cond
@@ -516,6 +801,8 @@ type Hook struct {
 	Fence      *liveFenceSwitches
 	ScanWriter *scanWriter
 	Metas      []FenceMeta
+	Template   *hookTemplate
+	Format     endpoint.Format
 	db         *kvdb.DB
 	channel    bool
 	closed     bool
@@ -524,6 +811,14 @@ type Hook struct {
 	epm        *endpoint.Manager
 	expires    time.Time
 	counter    *aint // counter that grows when a message was sent
+	batchSize  int
+	batchWait  time.Duration
+	batchStart time.Time // when the hook started waiting for a full batch
+	httpOpts   *endpoint.HTTPOptions
+	history    *chanHistory  // channel messages retained for late subscribers
+	schedule   *hookSchedule // activation windows, nil when always active
+	tags       []string
+	paused     string // pause policy, empty when the hook is active
 	sig        int
 }
 
@@ -543,6 +838,15 @@ func (h *Hook) Equals(hook *Hook) bool {
 	if !h.expires.Equal(hook.expires) {
 		return false
 	}
+	hopts, opts := h.options(), hook.options()
+	if len(hopts) != len(opts) {
+		return false
+	}
+	for i := range hopts {
+		if strings.Join(hopts[i], "\x00") != strings.Join(opts[i], "\x00") {
+			return false
+		}
+	}
 	for i, endpoint := range h.Endpoints {
 		if endpoint != hook.Endpoints[i] {
 			return false
@@ -565,6 +869,69 @@ func (h *Hook) Equals(hook *Hook) bool {
 	return true
 }
 
+// options returns the optional hook settings as they appear in the
+// SETHOOK command, such as ["batch","10","1.5"], in the order that they
+// are written to the AOF.
+func (h *Hook) options() [][]string {
+	var opts [][]string
+	if h.Template != nil {
+		opts = append(opts, []string{"template", h.Template.src})
+	}
+	if h.Format != endpoint.FormatJSON {
+		opts = append(opts, []string{"format", h.Format.String()})
+	}
+	if h.batchSize > 0 {
+		opts = append(opts, []string{"batch", strconv.Itoa(h.batchSize),
+			strconv.FormatFloat(h.batchWait.Seconds(), 'f', -1, 64)})
+	}
+	if h.httpOpts != nil {
+		if h.httpOpts.Secret != "" {
+			opts = append(opts, []string{"sign", h.httpOpts.Secret})
+		}
+		for _, header := range h.httpOpts.Headers {
+			opts = append(opts, []string{"header", header[0], header[1]})
+		}
+		if h.httpOpts.CertFile != "" {
+			opts = append(opts, []string{"cert", h.httpOpts.CertFile,
+				h.httpOpts.KeyFile})
+		}
+		if h.httpOpts.CACertFile != "" {
+			opts = append(opts, []string{"cacert", h.httpOpts.CACertFile})
+		}
+	}
+	if h.history != nil {
+		opts = append(opts, []string{"history", h.history.src})
+	}
+	if h.schedule != nil {
+		opts = append(opts, []string{"schedule", h.schedule.src,
+			h.schedule.tz})
+		if h.schedule.exit {
+			opts = append(opts, []string{"exitonclose"})
+		}
+	}
+	for _, tag := range h.tags {
+		opts = append(opts, []string{"tag", tag})
+	}
+	if h.paused != "" {
+		opts = append(opts, []string{"paused", h.paused})
+	}
+	return opts
+}
+
+// render returns the message that is delivered to the hook endpoints.
+func (h *Hook) render(msg string) (*endpoint.Message, error) {
+	emsg := &endpoint.Message{
+		Format: h.Format, Event: msg, Value: msg, HTTP: h.httpOpts,
+	}
+	if h.Template != nil {
+		var err error
+		if emsg.Value, err = h.Template.render(msg); err != nil {
+			return nil, err
+		}
+	}
+	return emsg, nil
+}
+
 // FenceMeta is a meta key/value pair for fences
 type FenceMeta struct {
 	Name, Value string
@@ -641,6 +1008,11 @@ func (h *Hook) manager() {
 			// the hook has closed, end manager
 			return
 		}
+		if h.paused != "" {
+			// leave the queue alone until the hook is resumed
+			h.cond.Wait()
+			continue
+		}
 		sig = h.sig
 		// unlock/logk the hook and send outgoing messages
 		if !func() bool {
@@ -686,6 +1058,24 @@ func (h *Hook) proc() (ok bool) {
 			return err
 		}
 
+		if h.batchSize > 1 && len(keys) > 0 {
+			// only send full batches, until the oldest message has waited
+			// long enough.
+			if h.batchStart.IsZero() {
+				h.batchStart = start
+				time.AfterFunc(h.batchWait, h.Signal)
+			}
+			if start.Sub(h.batchStart) < h.batchWait {
+				n := len(keys) / h.batchSize * h.batchSize
+				if n == len(keys) {
+					h.batchStart = time.Time{}
+				}
+				keys, vals = keys[:n], vals[:n]
+			} else {
+				h.batchStart = time.Time{}
+			}
+		}
+
 		// delete the keys
 		for _, key := range keys {
 			ttl, err := tx.TTL(key)
@@ -709,46 +1099,86 @@ func (h *Hook) proc() (ok bool) {
 		return false
 	}
 
-	// send each val. on failure reinsert that one and all of the following
-	for i, key := range keys {
-		val := vals[i]
-		idx := stringToUint64(key[len(hookLogPrefix):])
-		var sent bool
-		for _, endpoint := range h.Endpoints {
-			err := h.epm.Send(endpoint, val)
+	// reinsert puts back log entries that could not be sent.
+	// if this fails we lose log entries.
+	reinsert := func(idxs []int) {
+		h.db.Update(func(tx *kvdb.Tx) error {
+			for _, i := range idxs {
+				ttl := ttls[i] - time.Since(start)
+				if ttl > 0 {
+					opts := &kvdb.SetOptions{
+						Expires: true,
+						TTL:     ttl,
+					}
+					_, _, err := tx.Set(keys[i], vals[i], opts)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	// render the vals to messages, dropping those that cannot be rendered
+	var idxs []int
+	var msgs []*endpoint.Message
+	for i, val := range vals {
+		msg, err := h.render(val)
+		if err != nil {
+			// a message that cannot be rendered will never succeed, drop it.
+			log.Errorf("hook %s: %v: %v", h.Name, keys[i], err)
+			continue
+		}
+		idxs = append(idxs, i)
+		msgs = append(msgs, msg)
+	}
+
+	// send the messages, one batch at a time. on failure reinsert the
+	// failed messages and all of the following
+	size := h.batchSize
+	if size < 1 {
+		size = 1
+	}
+	for i := 0; i < len(msgs); i += size {
+		end := i + size
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		pending := idxs[i:end]
+		pmsgs := msgs[i:end]
+		for _, ep := range h.Endpoints {
+			var failed []int
+			var err error
+			if len(pmsgs) == 1 {
+				err = h.epm.SendMessage(ep, pmsgs[0])
+			} else {
+				failed, err = h.epm.SendBatch(ep, pmsgs)
+			}
 			if err != nil {
 				log.Debugf("Endpoint connect/send error: %v: %v: %v",
-					idx, endpoint, err)
+					keys[pending[0]], ep, err)
 				continue
 			}
-			log.Debugf("Endpoint send ok: %v: %v: %v", idx, endpoint, err)
-			sent = true
-			h.counter.add(1)
-			break
+			log.Debugf("Endpoint send ok: %v: %v: %v",
+				keys[pending[0]], ep, len(pmsgs)-len(failed))
+			h.counter.add(len(pmsgs) - len(failed))
+			if len(failed) == 0 {
+				pending = nil
+				break
+			}
+			// try the failed messages on the next endpoint
+			npending := make([]int, len(failed))
+			npmsgs := make([]*endpoint.Message, len(failed))
+			for j, k := range failed {
+				npending[j] = pending[k]
+				npmsgs[j] = pmsgs[k]
+			}
+			pending, pmsgs = npending, npmsgs
 		}
-		if !sent {
+		if len(pending) > 0 {
 			// failed to send. try to reinsert the remaining.
-			// if this fails we lose log entries.
-			keys = keys[i:]
-			vals = vals[i:]
-			ttls = ttls[i:]
-			h.db.Update(func(tx *kvdb.Tx) error {
-				for i, key := range keys {
-					val := vals[i]
-					ttl := ttls[i] - time.Since(start)
-					if ttl > 0 {
-						opts := &kvdb.SetOptions{
-							Expires: true,
-							TTL:     ttl,
-						}
-						_, _, err := tx.Set(key, val, opts)
-						if err != nil {
-							return err
-						}
-					}
-				}
-				return nil
-			})
+			reinsert(append(pending, idxs[end:]...))
 			return false
 		}
 	}
@@ -106,6 +106,9 @@ func (s *Server) goLive(
 	case liveAOFSwitches:
 		return s.liveAOF(lfs.pos, conn, rd, msg)
 	case liveSubscriptionSwitches:
+		if msg.stream != nil {
+			return s.liveStream(conn, rd, msg, websocket)
+		}
 		return s.liveSubscription(conn, rd, msg, websocket)
 	case liveMonitorSwitches:
 		return s.liveMonitor(conn, rd, msg)
@@ -127,7 +130,8 @@ func (s *Server) goLive(
 	s.mu.RLock()
 	sw, err = s.newScanWriter(
 		&wr, msg, lfs.key, lfs.output, lfs.precision, lfs.glob, false,
-		lfs.cursor, lfs.limit, lfs.wheres, lfs.whereins, lfs.whereevals, lfs.nofields)
+		lfs.cursor, lfs.limit, lfs.wheres, lfs.whereins, lfs.whereevals, lfs.filter, lfs.orderBy,
+		lfs.fields, lfs.nofields, lfs.nogeometry, lfs.profile)
 	s.mu.RUnlock()
 
 	// everything below if for live SCAN, NEARBY, WITHIN, INTERSECTS
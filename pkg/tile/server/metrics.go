@@ -51,6 +51,9 @@ var (
 		"bhojpur_total_connections_received": prometheus.NewDesc("bhojpur_connections_received_total", "", nil, nil),
 		"bhojpur_total_messages_sent":        prometheus.NewDesc("bhojpur_messages_sent_total", "", nil, nil),
 		"bhojpur_expired_keys":               prometheus.NewDesc("bhojpur_expired_keys_total", "", nil, nil),
+		"query_cache_hits":                   prometheus.NewDesc("bhojpur_query_cache_hits_total", "Total number of searches answered from the query cache", nil, nil),
+		"query_cache_misses":                 prometheus.NewDesc("bhojpur_query_cache_misses_total", "Total number of cacheable searches not in the query cache", nil, nil),
+		"query_cache_entries":                prometheus.NewDesc("bhojpur_query_cache_entries", "Number of searches in the query cache", nil, nil),
 
 		/*
 			these metrics are NOT taken from basicStats() / extStats()
@@ -70,6 +73,19 @@ var (
 		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.95: 0.005, 0.99: 0.001},
 	}, []string{"cmd"},
 	)
+
+	cmdLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bhojpur_cmd_latency_seconds",
+		Help:    "Command latency distribution",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"cmd"},
+	)
+
+	cmdSlow = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bhojpur_cmd_slow_total",
+		Help: "Total number of commands added to the slowlog",
+	}, []string{"cmd"},
+	)
 )
 
 func (s *Server) MetricsIndexHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,6 +104,8 @@ func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 		prometheus.NewGoCollector(),
 		prometheus.NewBuildInfoCollector(),
 		cmdDurations,
+		cmdLatency,
+		cmdSlow,
 		s,
 	)
 
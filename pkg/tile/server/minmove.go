@@ -0,0 +1,229 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/geojson"
+	"github.com/bhojpur/space/pkg/utils/geojson/geo"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+// minMove is a movement threshold for SET. An object that is set closer
+// than meters to its stored geometry keeps the stored geometry, and only
+// its fields and expiration change. With an age, the geometry is still
+// written once the stored geometry is older than the age.
+type minMove struct {
+	meters float64
+	age    time.Duration
+}
+
+// parseMinMoveValue parses the meters of MINMOVE or the seconds of MINAGE.
+func parseMinMoveValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, errInvalidArgument(s)
+	}
+	return v, nil
+}
+
+// args returns the SETMINMOVE command of the threshold, for the aof.
+func (mm minMove) args(key string) []string {
+	args := []string{"setminmove", key,
+		strconv.FormatFloat(mm.meters, 'f', -1, 64)}
+	if mm.age > 0 {
+		args = append(args, "minage",
+			strconv.FormatFloat(mm.age.Seconds(), 'f', -1, 64))
+	}
+	return args
+}
+
+// minMoveOf returns the movement threshold of a SET, which is its MINMOVE
+// option or the default of the collection. Commands from the aof or from a
+// leader have none, as they were already held back before they were
+// written. A SET with VERSION is always written.
+func (s *Server) minMoveOf(msg *Message, key string, opts *setOpts) (
+	minMove, bool,
+) {
+	if msg.fromAOF() {
+		return minMove{}, false
+	}
+	if opts.setVersion != 0 {
+		return minMove{}, false
+	}
+	if opts.minMove != nil {
+		return *opts.minMove, true
+	}
+	mm, ok := s.minmoves[key]
+	return mm, ok
+}
+
+// unmoved returns true when obj is closer than the threshold to the stored
+// object. Points are compared by their distance, ignoring the z, and any
+// other objects must be the same.
+func (mm minMove) unmoved(col *collection.Collection, id string,
+	obj geojson.Object, now time.Time,
+) bool {
+	old, _, _, ok := col.Get(id)
+	if !ok {
+		return false
+	}
+	if mm.age > 0 {
+		moved, _ := col.Moved(id)
+		if now.Sub(time.Unix(0, moved)) >= mm.age {
+			return false
+		}
+	}
+	p1, ok1 := minMovePoint(old)
+	p2, ok2 := minMovePoint(obj)
+	if ok1 && ok2 {
+		return p1 == p2 || geo.DistanceTo(p1.Y, p1.X, p2.Y, p2.X) < mm.meters
+	}
+	return old.String() == obj.String()
+}
+
+func minMovePoint(o geojson.Object) (geometry.Point, bool) {
+	switch o.(type) {
+	case *geojson.Point, *geojson.SimplePoint:
+		return o.Center(), true
+	}
+	return geometry.Point{}, false
+}
+
+// setUnmoved changes the fields and the expiration of an object like SET
+// would, but keeps the stored geometry. It fills d like FSET does, and
+// returns the commands that are written to the aof in place of the SET.
+func setUnmoved(col *collection.Collection, d *commandDetails,
+	fields []string, values []float64, ex int64, now time.Time,
+) (aof [][]string) {
+	obj, oldFields, oldEx, _ := col.Get(d.id)
+	d.obj = nil
+	d.command = "expire"
+	if len(fields) > 0 {
+		oldFields = append([]float64(nil), oldFields...)
+		_, newFields, updateCount, _ := col.SetFields(d.id, fields, values)
+		if updateCount > 0 {
+			args := []string{"fset", d.key, d.id}
+			for i, field := range fields {
+				args = append(args, field,
+					strconv.FormatFloat(values[i], 'f', -1, 64))
+			}
+			aof = append(aof, args)
+			d.command = "fset"
+			d.obj = obj
+			d.fields = newFields
+			d.oldFields = oldFields
+		}
+	}
+	if ex != 0 {
+		col.SetExpires(d.id, ex)
+		secs := time.Duration(ex - now.UnixNano()).Round(time.Millisecond)
+		aof = append(aof, []string{"expire", d.key, d.id,
+			strconv.FormatFloat(secs.Seconds(), 'f', -1, 64)})
+	} else if oldEx != 0 {
+		// SET without EX removes the expiration
+		col.SetExpires(d.id, 0)
+		aof = append(aof, []string{"persist", d.key, d.id})
+	}
+	d.updated = len(aof) > 0
+	d.timestamp = now
+	return aof
+}
+
+// SETMINMOVE key meters [MINAGE seconds]
+func (s *Server) cmdSetMinMove(msg *Message) (
+	res resp.Value, d commandDetails, err error,
+) {
+	start := time.Now()
+	vs := msg.Args[1:]
+	var key, smeters, sage string
+	var ok bool
+	if vs, key, ok = tokenval(vs); !ok || key == "" {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	if vs, smeters, ok = tokenval(vs); !ok || smeters == "" {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	var mm minMove
+	if mm.meters, err = parseMinMoveValue(smeters); err != nil {
+		return NOMessage, d, err
+	}
+	if len(vs) > 0 {
+		var arg string
+		vs, arg, _ = tokenval(vs)
+		if !lc(arg, "minage") {
+			return NOMessage, d, errInvalidArgument(arg)
+		}
+		if vs, sage, ok = tokenval(vs); !ok || sage == "" {
+			return NOMessage, d, errInvalidNumberOfArguments
+		}
+		var age float64
+		if age, err = parseMinMoveValue(sage); err != nil {
+			return NOMessage, d, err
+		}
+		mm.age = time.Duration(age * float64(time.Second))
+	}
+	if len(vs) != 0 {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	s.minmoves[key] = mm
+	d.command = "setminmove"
+	d.updated = true
+	d.timestamp = time.Now()
+	return OKMessage(msg, start), d, nil
+}
+
+// DELMINMOVE key
+func (s *Server) cmdDelMinMove(msg *Message) (
+	res resp.Value, d commandDetails, err error,
+) {
+	start := time.Now()
+	vs := msg.Args[1:]
+	var key string
+	var ok bool
+	if vs, key, ok = tokenval(vs); !ok || key == "" {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	if len(vs) != 0 {
+		return NOMessage, d, errInvalidNumberOfArguments
+	}
+	if _, ok := s.minmoves[key]; ok {
+		delete(s.minmoves, key)
+		d.updated = true
+	}
+	d.command = "delminmove"
+	d.timestamp = time.Now()
+	switch msg.OutputType {
+	case JSON:
+		return OKMessage(msg, start), d, nil
+	case RESP:
+		if d.updated {
+			return resp.IntegerValue(1), d, nil
+		}
+		return resp.IntegerValue(0), d, nil
+	}
+	return
+}
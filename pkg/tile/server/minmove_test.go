@@ -0,0 +1,178 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/geojson"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+)
+
+func TestMinMove(t *testing.T) {
+	rect := func(minX, minY, maxX, maxY float64) geojson.Object {
+		return geojson.NewRect(geometry.Rect{
+			Min: geometry.Point{X: minX, Y: minY},
+			Max: geometry.Point{X: maxX, Y: maxY},
+		})
+	}
+	col := collection.New()
+	col.Set("truck1", PO(-112, 33), nil, nil, 0)
+	col.Set("zone1", rect(-112, 33, -111, 34), nil, nil, 0)
+	now := time.Now()
+
+	mm := minMove{meters: 10}
+	tests := []struct {
+		id  string
+		obj geojson.Object
+		ok  bool
+	}{
+		{"truck1", PO(-112, 33), true},
+		{"truck1", PO(-112.00005, 33), true}, // about 4.7 meters
+		{"truck1", PO(-112.0005, 33), false}, // about 47 meters
+		{"truck2", PO(-112, 33), false},
+		{"zone1", rect(-112, 33, -111, 34), true},
+		{"zone1", rect(-112, 33, -111, 35), false},
+	}
+	for _, tt := range tests {
+		if ok := mm.unmoved(col, tt.id, tt.obj, now); ok != tt.ok {
+			t.Fatalf("%s %s: expected %v, got %v", tt.id, tt.obj, tt.ok, ok)
+		}
+	}
+	// the stored geometry is written again once it is older than MINAGE
+	mm.age = time.Minute
+	if !mm.unmoved(col, "truck1", PO(-112, 33), now) {
+		t.Fatal("expected unmoved")
+	}
+	if mm.unmoved(col, "truck1", PO(-112, 33), now.Add(time.Hour)) {
+		t.Fatal("expected moved")
+	}
+	if !reflect.DeepEqual(mm.args("fleet"),
+		[]string{"setminmove", "fleet", "10", "minage", "60"}) {
+		t.Fatalf("unexpected args %v", mm.args("fleet"))
+	}
+}
+
+func TestSetUnmoved(t *testing.T) {
+	col := collection.New()
+	col.Set("truck1", PO(-112, 33), []string{"speed"}, []float64{10}, 0)
+	now := time.Now()
+
+	d := commandDetails{key: "fleet", id: "truck1", obj: PO(-112, 33)}
+	aof := setUnmoved(col, &d, []string{"speed"}, []float64{10}, 0, now)
+	if aof != nil || d.updated {
+		t.Fatalf("expected no changes, got %v", aof)
+	}
+
+	d = commandDetails{key: "fleet", id: "truck1", obj: PO(-112, 33)}
+	aof = setUnmoved(col, &d, []string{"speed"}, []float64{0.5}, 0, now)
+	if !reflect.DeepEqual(aof, [][]string{{"fset", "fleet", "truck1", "speed", "0.5"}}) {
+		t.Fatalf("unexpected aof %v", aof)
+	}
+	if !d.updated || d.command != "fset" || d.oldFields[0] != 10 || d.fields[0] != 0.5 {
+		t.Fatalf("unexpected details %+v", d)
+	}
+
+	d = commandDetails{key: "fleet", id: "truck1", obj: PO(-112, 33)}
+	ex := now.Add(30 * time.Second).UnixNano()
+	aof = setUnmoved(col, &d, nil, nil, ex, now)
+	if !reflect.DeepEqual(aof, [][]string{{"expire", "fleet", "truck1", "30"}}) {
+		t.Fatalf("unexpected aof %v", aof)
+	}
+	if !d.updated || d.command != "expire" || d.obj != nil {
+		t.Fatalf("unexpected details %+v", d)
+	}
+
+	// a SET without EX removes the expiration
+	d = commandDetails{key: "fleet", id: "truck1", obj: PO(-112, 33)}
+	aof = setUnmoved(col, &d, nil, nil, 0, now)
+	if !reflect.DeepEqual(aof, [][]string{{"persist", "fleet", "truck1"}}) {
+		t.Fatalf("unexpected aof %v", aof)
+	}
+	if o, _, ex, _ := col.Get("truck1"); ex != 0 || o.String() != PO(-112, 33).String() {
+		t.Fatalf("unexpected object %v %v", o, ex)
+	}
+}
+
+func TestMinMoveDropRename(t *testing.T) {
+	s, _ := newFenceTestServer(t)
+	s.minmoves = map[string]minMove{
+		"fleet": {meters: 10},
+		"taxis": {meters: 20},
+		"empty": {meters: 30},
+	}
+	for _, key := range []string{"fleet", "taxis", "buses"} {
+		col := collection.New()
+		col.Set("truck1", PO(-112, 33), nil, nil, 0)
+		s.setCol(key, col)
+	}
+	exec := func(args ...string) commandDetails {
+		t.Helper()
+		msg := &Message{Args: args, OutputType: RESP}
+		var d commandDetails
+		var err error
+		switch msg.Command() {
+		case "drop":
+			_, d, err = s.cmdDrop(msg)
+		default:
+			_, d, err = s.cmdRename(msg)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// the default is moved with the collection and replaces the one of
+	// the new key
+	exec("rename", "fleet", "taxis")
+	if mm, ok := s.minmoves["taxis"]; !ok || mm.meters != 10 {
+		t.Fatalf("expected the default of fleet on taxis, got %v", mm)
+	}
+	if _, ok := s.minmoves["fleet"]; ok {
+		t.Fatal("expected no default on fleet")
+	}
+	// RENAMENX to an existing key keeps the default where it is
+	exec("renamenx", "taxis", "buses")
+	if mm, ok := s.minmoves["taxis"]; !ok || mm.meters != 10 {
+		t.Fatalf("expected the default to stay on taxis, got %v", mm)
+	}
+	// a collection without a default removes the one of the new key
+	exec("rename", "buses", "taxis")
+	if _, ok := s.minmoves["taxis"]; ok {
+		t.Fatal("expected no default on taxis")
+	}
+	if d := exec("drop", "taxis"); !d.updated {
+		t.Fatal("expected taxis to be dropped")
+	}
+	// a default without a collection is dropped, and written to the aof
+	if d := exec("drop", "empty"); !d.updated {
+		t.Fatal("expected the default of empty to be dropped")
+	}
+	if len(s.minmoves) != 0 {
+		t.Fatalf("expected no defaults, got %v", s.minmoves)
+	}
+	if d := exec("drop", "empty"); d.updated {
+		t.Fatal("expected nothing to drop")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/bhojpur/space/pkg/utils/tinyqueue"
+)
+
+// orderByT is a field that search results are ordered by.
+type orderByT struct {
+	field string
+	index int
+	desc  bool
+}
+
+// parseOrderBy parses the fields that follow ORDER BY, such as
+// "rating DESC, speed". A field is ascending unless followed by DESC, and
+// fields are separated by commas, which may be separate arguments or at the
+// end of an argument.
+func parseOrderBy(vs []string) (nvs []string, orderBy []orderByT, err error) {
+	for {
+		var tok string
+		var ok bool
+		if vs, tok, ok = tokenval(vs); !ok || tok == "" || tok == "," {
+			return nil, nil, errors.New("missing ORDER BY field")
+		}
+		field := strings.TrimSuffix(tok, ",")
+		more := field != tok
+		var desc bool
+		if !more {
+			if nvs, tok, ok := tokenval(vs); ok {
+				switch strings.ToLower(strings.TrimSuffix(tok, ",")) {
+				case "asc":
+					vs, more = nvs, strings.HasSuffix(tok, ",")
+				case "desc":
+					vs, more, desc = nvs, strings.HasSuffix(tok, ","), true
+				}
+			}
+		}
+		if !more {
+			if nvs, tok, ok := tokenval(vs); ok && tok == "," {
+				vs, more = nvs, true
+			}
+		}
+		orderBy = append(orderBy, orderByT{field: field, desc: desc})
+		if !more {
+			return vs, orderBy, nil
+		}
+	}
+}
+
+// orderedItem is a search result that waits to be written in order.
+type orderedItem struct {
+	orderBy []orderByT
+	opts    ScanWriterParams
+	keys    []float64
+}
+
+// Less puts the last result at the top of the queue, which is the one that
+// is dropped when a better result arrives and the queue is full.
+func (item *orderedItem) Less(other tinyqueue.Item) bool {
+	return other.(*orderedItem).before(item)
+}
+
+// before returns true if the item comes before the other item. Results with
+// equal fields are ordered by id, which keeps cursors stable.
+func (item *orderedItem) before(other *orderedItem) bool {
+	for i, o := range item.orderBy {
+		if item.keys[i] != other.keys[i] {
+			return (item.keys[i] < other.keys[i]) != o.desc
+		}
+	}
+	return item.opts.id < other.opts.id
+}
+
+// setOrderBy makes the scan writer hold results in a queue that is bounded
+// by the cursor and the limit, and write them in order at the end.
+func (sw *scanWriter) setOrderBy(orderBy []orderByT) {
+	if len(orderBy) == 0 || sw.output == outputCount {
+		return
+	}
+	sw.orderBy = make([]orderByT, len(orderBy))
+	for i, o := range orderBy {
+		var ok bool
+		if o.index, ok = sw.fmap[o.field]; !ok {
+			o.index = math.MaxInt32
+		}
+		sw.orderBy[i] = o
+	}
+	sw.orderCap = sw.cursor + sw.limit
+	if sw.orderCap < sw.cursor {
+		sw.orderCap = math.MaxUint64
+	}
+	sw.ordered = tinyqueue.New(nil)
+}
+
+// pushOrdered adds a result to the queue, keeping only the first results.
+func (sw *scanWriter) pushOrdered(opts ScanWriterParams) {
+	sw.orderMatches++
+	item := &orderedItem{
+		orderBy: sw.orderBy,
+		opts:    opts,
+		keys:    make([]float64, len(sw.orderBy)),
+	}
+	for i, o := range sw.orderBy {
+		if o.index < len(opts.fields) {
+			item.keys[i] = opts.fields[o.index]
+		} else if o.field == "z" && o.index == math.MaxInt32 {
+			item.keys[i] = extractZCoordinate(opts.o)
+		}
+	}
+	if uint64(sw.ordered.Len()) < sw.orderCap {
+		sw.ordered.Push(item)
+	} else if item.before(sw.ordered.Peek().(*orderedItem)) {
+		sw.ordered.Pop()
+		sw.ordered.Push(item)
+	}
+}
+
+// writeOrdered writes the queued results that follow the cursor. The next
+// cursor is the position after the last written result.
+func (sw *scanWriter) writeOrdered() {
+	start := sw.profile.now()
+	items := make([]*orderedItem, sw.ordered.Len())
+	for i := len(items) - 1; i >= 0; i-- {
+		items[i] = sw.ordered.Pop().(*orderedItem)
+	}
+	sw.profile.ordered(start)
+	sw.count = 0
+	for i := sw.cursor; i < uint64(len(items)); i++ {
+		sw.count++
+		sw.writeResult(items[i].opts)
+	}
+	sw.numberIters = uint64(len(items))
+	sw.hitLimit = sw.orderMatches > uint64(len(items))
+}
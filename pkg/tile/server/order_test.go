@@ -0,0 +1,87 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		orderBy []orderByT
+		rest    int
+	}{
+		{[]string{"rating"}, []orderByT{{field: "rating"}}, 0},
+		{[]string{"rating", "DESC", "LIMIT", "10"},
+			[]orderByT{{field: "rating", desc: true}}, 2},
+		{[]string{"rating", "desc,", "speed", "ASC"},
+			[]orderByT{{field: "rating", desc: true}, {field: "speed"}}, 0},
+		{[]string{"rating,", "speed", ",", "age", "desc", "IDS"},
+			[]orderByT{{field: "rating"}, {field: "speed"},
+				{field: "age", desc: true}}, 1},
+	} {
+		rest, orderBy, err := parseOrderBy(tc.args)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		if !reflect.DeepEqual(orderBy, tc.orderBy) || len(rest) != tc.rest {
+			t.Fatalf("%v: got %v %v", tc.args, orderBy, rest)
+		}
+	}
+	for _, args := range [][]string{{}, {","}, {"rating", "DESC,"}} {
+		if _, _, err := parseOrderBy(args); err == nil {
+			t.Fatalf("%v: expected error", args)
+		}
+	}
+}
+
+func TestOrderedTopK(t *testing.T) {
+	sw := &scanWriter{
+		fmap:   map[string]int{"rating": 0, "trips": 1},
+		cursor: 2,
+		limit:  3,
+	}
+	sw.setOrderBy([]orderByT{{field: "rating", desc: true}, {field: "trips"}})
+	for i := 0; i < 20; i++ {
+		sw.pushOrdered(ScanWriterParams{
+			id:     fmt.Sprintf("driver%02d", i),
+			fields: []float64{float64(i % 5), float64(i % 3)},
+		})
+	}
+	if sw.ordered.Len() != 5 || sw.orderMatches != 20 {
+		t.Fatalf("expected 5 of 20, got %d of %d",
+			sw.ordered.Len(), sw.orderMatches)
+	}
+	var ids []string
+	for sw.ordered.Len() > 0 {
+		ids = append([]string{sw.ordered.Pop().(*orderedItem).opts.id}, ids...)
+	}
+	// rating 4 is driver04 (trips 1), driver09 (0), driver14 (2), driver19 (1)
+	// rating 3 starts with driver03 and driver18 (0), ordered by id
+	expect := []string{"driver09", "driver04", "driver19", "driver14",
+		"driver03"}
+	if !reflect.DeepEqual(ids, expect) {
+		t.Fatalf("expected %v, got %v", expect, ids)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+// scanProfile is the statistics of a search, for EXPLAIN and PROFILE.
+type scanProfile struct {
+	collection.Stats
+	start          time.Time
+	globRejected   uint64
+	fieldRejected  uint64 // WHERE, WHEREIN and WHEREEVAL
+	filterRejected uint64
+	matched        uint64
+	clipped        uint64
+	testTime       time.Duration
+	orderTime      time.Duration
+	clipTime       time.Duration
+	writeTime      time.Duration // includes the clipTime
+	totalTime      time.Duration
+}
+
+// Stats returns the stats that the collection keeps for the search, or nil
+// when the search is not profiled.
+func (sw *scanWriter) Stats() *collection.Stats {
+	if sw.profile == nil {
+		return nil
+	}
+	return &sw.profile.Stats
+}
+
+// now returns the current time, or the zero time when not profiling.
+func (p *scanProfile) now() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// The tests that reject objects in testObject.
+const (
+	rejectGlob = iota
+	rejectField
+	rejectFilter
+)
+
+// rejected records an object that failed a test that started at start.
+func (p *scanProfile) rejected(start time.Time, test int) {
+	if p != nil {
+		p.testTime += time.Since(start)
+		switch test {
+		case rejectGlob:
+			p.globRejected++
+		case rejectField:
+			p.fieldRejected++
+		case rejectFilter:
+			p.filterRejected++
+		}
+	}
+}
+
+// passed records an object that passed the tests that started at start.
+func (p *scanProfile) passed(start time.Time) {
+	if p != nil {
+		p.testTime += time.Since(start)
+		p.matched++
+	}
+}
+
+func (p *scanProfile) clip(start time.Time) {
+	if p != nil {
+		p.clipTime += time.Since(start)
+		p.clipped++
+	}
+}
+
+func (p *scanProfile) wrote(start time.Time) {
+	if p != nil {
+		p.writeTime += time.Since(start)
+	}
+}
+
+func (p *scanProfile) ordered(start time.Time) {
+	if p != nil {
+		p.orderTime += time.Since(start)
+	}
+}
+
+type profileValue struct {
+	name  string
+	value interface{} // string, uint64 or time.Duration
+}
+
+// values returns the statistics in the order that they are output. The
+// index time is the time that is not spent in the other stages.
+func (p *scanProfile) values() (counts, times []profileValue) {
+	strategy := p.Strategy
+	if strategy == "" {
+		strategy = "none"
+	}
+	index := p.totalTime - p.GeometryTime - p.testTime - p.orderTime -
+		p.writeTime
+	if index < 0 {
+		index = 0
+	}
+	counts = []profileValue{
+		{"strategy", strategy},
+		{"candidates", p.Candidates},
+		{"skipped", p.Skipped},
+		{"geometry_rejected", p.Rejected},
+		{"sparse_areas", p.SparseAreas},
+		{"glob_rejected", p.globRejected},
+		{"field_rejected", p.fieldRejected},
+		{"filter_rejected", p.filterRejected},
+		{"matched", p.matched},
+		{"clipped", p.clipped},
+	}
+	times = []profileValue{
+		{"index", index},
+		{"geometry", p.GeometryTime},
+		{"filter", p.testTime},
+		{"order", p.orderTime},
+		{"clip", p.clipTime},
+		{"write", p.writeTime - p.clipTime},
+		{"total", p.totalTime},
+	}
+	return counts, times
+}
+
+func appendProfileValuesJSON(dst []byte, vals []profileValue) []byte {
+	dst = append(dst, '{')
+	for i, v := range vals {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, jsonString(v.name)...)
+		dst = append(dst, ':')
+		switch v := v.value.(type) {
+		case string:
+			dst = append(dst, jsonString(v)...)
+		case uint64:
+			dst = strconv.AppendUint(dst, v, 10)
+		case time.Duration:
+			dst = append(dst, jsonString(v.String())...)
+		}
+	}
+	return append(dst, '}')
+}
+
+func profileValuesRESP(vals []profileValue) resp.Value {
+	arr := make([]resp.Value, 0, len(vals)*2)
+	for _, v := range vals {
+		arr = append(arr, resp.StringValue(v.name))
+		switch v := v.value.(type) {
+		case string:
+			arr = append(arr, resp.StringValue(v))
+		case uint64:
+			arr = append(arr, resp.IntegerValue(int(v)))
+		case time.Duration:
+			arr = append(arr, resp.StringValue(v.String()))
+		}
+	}
+	return resp.ArrayValue(arr)
+}
+
+// appendJSON appends the statistics as a JSON object.
+func (p *scanProfile) appendJSON(dst []byte) []byte {
+	counts, times := p.values()
+	dst = appendProfileValuesJSON(dst, counts)
+	dst = append(dst[:len(dst)-1], `,"times":`...)
+	dst = appendProfileValuesJSON(dst, times)
+	return append(dst, '}')
+}
+
+// respValue returns the statistics as name and value pairs.
+func (p *scanProfile) respValue() resp.Value {
+	counts, times := p.values()
+	arr := profileValuesRESP(counts).Array()
+	arr = append(arr, resp.StringValue("times"), profileValuesRESP(times))
+	return resp.ArrayValue(arr)
+}
+
+// rewriteExplainMsg turns an EXPLAIN message into the search that it
+// explains.
+func rewriteExplainMsg(msg *Message) error {
+	if len(msg.Args) < 2 {
+		return errInvalidNumberOfArguments
+	}
+	msg.Args = msg.Args[1:]
+	msg._command = ""
+	switch msg.Command() {
+	case "scan", "search", "nearby", "within", "intersects":
+	default:
+		return fmt.Errorf("explain not supported for '%s'", msg.Args[0])
+	}
+	msg.explain = true
+	return nil
+}
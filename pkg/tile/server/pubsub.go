@@ -24,6 +24,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,8 +41,9 @@ const (
 )
 
 type pubsub struct {
-	mu   sync.RWMutex
-	hubs [2]map[string]*subhub
+	mu     sync.RWMutex
+	hubs   [2]map[string]*subhub
+	replay *replayBuffer
 }
 
 func newPubsub() *pubsub {
@@ -50,21 +52,30 @@ func newPubsub() *pubsub {
 			make(map[string]*subhub),
 			make(map[string]*subhub),
 		},
+		replay: newReplayBuffer(),
 	}
 }
 
 // Publish a message to subscribers
 func (s *Server) Publish(channel string, message ...string) int {
+	return s.publish(channel, nil, message)
+}
+
+// publish sends messages to subscribers under the message ids, or under new
+// ids when ids is nil.
+func (s *Server) publish(channel string, ids []int64, message []string) int {
 	var msgs []submsg
+	ids = s.pubsub.replay.add(channel, ids, message, s.config.streamReplaySize())
 	s.pubsub.mu.RLock()
 	if hub := s.pubsub.hubs[pubsubChannel][channel]; hub != nil {
 		for target := range hub.targets {
-			for _, message := range message {
+			for i, message := range message {
 				msgs = append(msgs, submsg{
 					kind:    pubsubChannel,
 					target:  target,
 					channel: channel,
 					message: message,
+					id:      ids[i],
 				})
 			}
 		}
@@ -72,13 +83,14 @@ func (s *Server) Publish(channel string, message ...string) int {
 	for pattern, hub := range s.pubsub.hubs[pubsubPattern] {
 		if match.Match(channel, pattern) {
 			for target := range hub.targets {
-				for _, message := range message {
+				for i, message := range message {
 					msgs = append(msgs, submsg{
 						kind:    pubsubPattern,
 						target:  target,
 						channel: channel,
 						pattern: pattern,
 						message: message,
+						id:      ids[i],
 					})
 				}
 			}
@@ -125,6 +137,10 @@ type submsg struct {
 	pattern string
 	channel string
 	message string
+	id      int64 // message id, shared with the channel history
+	// replayed is set for messages taken from the replay buffer rather than
+	// delivered by a live publish.
+	replayed bool
 }
 
 type subtarget struct {
@@ -158,7 +174,8 @@ func (sub liveSubscriptionSwitches) Error() string {
 }
 
 func (s *Server) cmdSubscribe(msg *Message) (resp.Value, error) {
-	if len(msg.Args) < 2 {
+	// WebSocket streams may start empty and subscribe through frames
+	if len(msg.Args) < 2 && !(msg.stream != nil && msg.ConnType == WebSocket) {
 		return resp.Value{}, errInvalidNumberOfArguments
 	}
 	return NOMessage, liveSubscriptionSwitches{}
@@ -247,6 +264,15 @@ func (s *Server) liveSubscription(
 				"PING / QUIT allowed in this context\r\n"))
 		}
 	}
+	writeErr := func(err error) {
+		switch outputType {
+		case JSON:
+			write([]byte(`{"ok":false,"err":` + jsonString(err.Error()) +
+				`,"elapsed":"` + time.Since(start).String() + `"}`))
+		case RESP:
+			write([]byte("-ERR " + err.Error() + "\r\n"))
+		}
+	}
 	writeSubscribe := func(command, channel string, num int) {
 		switch outputType {
 		case JSON:
@@ -372,14 +398,33 @@ func (s *Server) liveSubscription(
 			}
 			for i := 1; i < len(msg.Args); i++ {
 				channel := msg.Args[i]
+				// SUBSCRIBE channel FROM id|time
+				from := int64(-1)
+				if kind == pubsubChannel && !un && i+2 < len(msg.Args) &&
+					strings.ToLower(msg.Args[i+1]) == "from" {
+					pivot, err := parseChanHistoryFrom(msg.Args[i+2])
+					i += 2
+					if err != nil {
+						writeErr(err)
+						continue
+					}
+					from = pivot
+				}
 				if un {
 					delete(m[kind], channel)
 					s.pubsub.unregister(kind, channel, target)
 				} else {
 					m[kind][channel] = true
-					s.pubsub.register(kind, channel, target)
+					if from == -1 {
+						s.pubsub.register(kind, channel, target)
+					}
 				}
 				writeSubscribe(msg.Command(), channel, len(m[0])+len(m[1]))
+				if from != -1 {
+					if err := s.subscribeFrom(channel, from, target); err != nil {
+						writeErr(err)
+					}
+				}
 			}
 		}
 		var err error
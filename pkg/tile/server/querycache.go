@@ -0,0 +1,274 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"container/list"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+	"github.com/bhojpur/space/pkg/utils/resp"
+	"github.com/bhojpur/space/pkg/utils/rtree"
+)
+
+// queryCacheEntry is the response of a search that can be returned again
+// until a write changes an object in its area.
+type queryCacheEntry struct {
+	id      string                 // normalized command
+	key     string                 // collection key
+	col     *collection.Collection // collection that was searched
+	rect    geometry.Rect          // area of the search
+	nfields int                    // number of fields in the collection
+	refKey  string                 // collection of the GET area, if any
+	refID   string                 // object of the GET area, if any
+	json    []byte                 // JSON response, without the elapsed time
+	resp    resp.Value             // RESP response
+	elem    *list.Element          // position in the lru list
+}
+
+// queryCacheCounts are the hits and misses of the searches on a collection.
+type queryCacheCounts struct {
+	hits   uint64
+	misses uint64
+}
+
+// queryCache holds the responses of WITHIN and INTERSECTS searches. The
+// entries are kept in a spatial index, like the hooks in hookTree, so that
+// a write only removes the entries whose area holds its old or new object.
+// The entries whose area is an object, from GET, are also removed when
+// that object changes.
+type queryCache struct {
+	mu      sync.Mutex
+	entries map[string]*queryCacheEntry
+	refs    map[string]map[*queryCacheEntry]bool // entries by GET area key
+	tree    *rtree.RTree
+	lru     *list.List // front is the most recently used
+	counts  map[string]*queryCacheCounts
+	total   queryCacheCounts
+}
+
+func newQueryCache() *queryCache {
+	return &queryCache{
+		entries: make(map[string]*queryCacheEntry),
+		refs:    make(map[string]map[*queryCacheEntry]bool),
+		tree:    &rtree.RTree{},
+		lru:     list.New(),
+		counts:  make(map[string]*queryCacheCounts),
+	}
+}
+
+// queryCacheID returns the normalized form of a search command, which is
+// the same for commands that only differ in the case of the command name.
+func queryCacheID(msg *Message) string {
+	var sb strings.Builder
+	sb.WriteByte(byte(msg.OutputType))
+	sb.WriteString(msg.Command())
+	for _, arg := range msg.Args[1:] {
+		sb.WriteByte(0)
+		sb.WriteString(arg)
+	}
+	return sb.String()
+}
+
+// get returns the entry for the search with id on the collection key, when
+// it was made on the same collection with the same fields, and counts the
+// hit or miss.
+func (qc *queryCache) get(id, key string, col *collection.Collection,
+	nfields int,
+) *queryCacheEntry {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	counts := qc.counts[key]
+	if counts == nil {
+		counts = &queryCacheCounts{}
+		qc.counts[key] = counts
+	}
+	entry := qc.entries[id]
+	if entry != nil && (entry.col != col || entry.nfields != nfields) {
+		// the collection was replaced, or a new field changes the output
+		// of every object
+		qc.remove(entry)
+		entry = nil
+	}
+	if entry == nil {
+		counts.misses++
+		qc.total.misses++
+		return nil
+	}
+	counts.hits++
+	qc.total.hits++
+	qc.lru.MoveToFront(entry.elem)
+	return entry
+}
+
+// put adds an entry, removing the least recently used entries that no
+// longer fit in size.
+func (qc *queryCache) put(entry *queryCacheEntry, size int) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if prev := qc.entries[entry.id]; prev != nil {
+		qc.remove(prev)
+	}
+	entry.elem = qc.lru.PushFront(entry)
+	qc.entries[entry.id] = entry
+	qc.tree.Insert(
+		[2]float64{entry.rect.Min.X, entry.rect.Min.Y},
+		[2]float64{entry.rect.Max.X, entry.rect.Max.Y},
+		entry)
+	if entry.refKey != "" {
+		refs := qc.refs[entry.refKey]
+		if refs == nil {
+			refs = make(map[*queryCacheEntry]bool)
+			qc.refs[entry.refKey] = refs
+		}
+		refs[entry] = true
+	}
+	for len(qc.entries) > size {
+		qc.remove(qc.lru.Back().Value.(*queryCacheEntry))
+	}
+}
+
+func (qc *queryCache) remove(entry *queryCacheEntry) {
+	qc.tree.Delete(
+		[2]float64{entry.rect.Min.X, entry.rect.Min.Y},
+		[2]float64{entry.rect.Max.X, entry.rect.Max.Y},
+		entry)
+	qc.lru.Remove(entry.elem)
+	delete(qc.entries, entry.id)
+	if refs := qc.refs[entry.refKey]; refs != nil {
+		delete(refs, entry)
+		if len(refs) == 0 {
+			delete(qc.refs, entry.refKey)
+		}
+	}
+}
+
+// invalidate removes the entries whose results may be changed by a write.
+func (qc *queryCache) invalidate(d *commandDetails) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if len(qc.entries) == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			qc.invalidateDetails(d)
+		}
+		return
+	}
+	qc.invalidateDetails(d)
+}
+
+func (qc *queryCache) invalidateDetails(d *commandDetails) {
+	switch {
+	case d.command == "flushdb":
+		for _, entry := range qc.entries {
+			qc.remove(entry)
+		}
+	case d.command == "expire":
+		// the expiration of an object is not part of the results
+	case d.obj == nil && d.oldObj == nil:
+		// drop, rename, or a delete without the old object
+		qc.invalidateKey(d.key)
+		qc.invalidateRefs(d.key, "")
+		if d.newKey != "" {
+			qc.invalidateKey(d.newKey)
+			qc.invalidateRefs(d.newKey, "")
+		}
+	default:
+		qc.invalidateRefs(d.key, d.id)
+		var rects []geometry.Rect
+		if d.oldObj != nil {
+			rects = append(rects, d.oldObj.Rect())
+		}
+		if d.obj != nil {
+			rects = append(rects, d.obj.Rect())
+		}
+		var entries []*queryCacheEntry
+		for _, rect := range rects {
+			qc.tree.Search(
+				[2]float64{rect.Min.X, rect.Min.Y},
+				[2]float64{rect.Max.X, rect.Max.Y},
+				func(min, max [2]float64, value interface{}) bool {
+					entry := value.(*queryCacheEntry)
+					if entry.key == d.key {
+						entries = append(entries, entry)
+					}
+					return true
+				})
+		}
+		for _, entry := range entries {
+			if qc.entries[entry.id] == entry {
+				qc.remove(entry)
+			}
+		}
+	}
+}
+
+// invalidateRefs removes the entries whose GET area is the object with the
+// id, or any object of the collection when id is empty.
+func (qc *queryCache) invalidateRefs(key, id string) {
+	for entry := range qc.refs[key] {
+		if id == "" || entry.refID == id {
+			qc.remove(entry)
+		}
+	}
+}
+
+func (qc *queryCache) invalidateKey(key string) {
+	for _, entry := range qc.entries {
+		if entry.key == key {
+			qc.remove(entry)
+		}
+	}
+}
+
+// stats adds the cache counters of the collection key, or of all
+// collections when key is empty, to m.
+func (qc *queryCache) stats(key string, m map[string]interface{}) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	counts := qc.total
+	entries := len(qc.entries)
+	if key != "" {
+		counts = queryCacheCounts{}
+		if c := qc.counts[key]; c != nil {
+			counts = *c
+		}
+		entries = 0
+		for _, entry := range qc.entries {
+			if entry.key == key {
+				entries++
+			}
+		}
+	}
+	m["query_cache_hits"] = int(counts.hits)
+	m["query_cache_misses"] = int(counts.misses)
+	m["query_cache_entries"] = entries
+	var ratio float64
+	if counts.hits+counts.misses > 0 {
+		ratio = float64(counts.hits) / float64(counts.hits+counts.misses)
+	}
+	m["query_cache_hit_ratio"] = math.Round(ratio*1000) / 1000
+}
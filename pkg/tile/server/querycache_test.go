@@ -0,0 +1,156 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
+	"github.com/bhojpur/space/pkg/utils/resp"
+)
+
+func TestQueryCache(t *testing.T) {
+	qc := newQueryCache()
+	col := collection.New()
+	rect := func(minX, minY, maxX, maxY float64) geometry.Rect {
+		return geometry.Rect{
+			Min: geometry.Point{X: minX, Y: minY},
+			Max: geometry.Point{X: maxX, Y: maxY},
+		}
+	}
+	put := func(id, key string, r geometry.Rect) {
+		qc.put(&queryCacheEntry{
+			id: id, key: key, col: col, rect: r,
+			resp: resp.StringValue(id),
+		}, 3)
+	}
+	has := func(id, key string) bool {
+		return qc.get(id, key, col, 0) != nil
+	}
+
+	put("a", "fleet", rect(0, 0, 10, 10))
+	put("b", "fleet", rect(20, 20, 30, 30))
+	put("c", "boats", rect(0, 0, 10, 10))
+	if !has("a", "fleet") || !has("b", "fleet") || !has("c", "boats") {
+		t.Fatal("expected all entries")
+	}
+
+	// a write only removes the entries of its collection in its area
+	qc.invalidate(&commandDetails{
+		command: "set", key: "fleet", obj: PO(5, 5),
+	})
+	if has("a", "fleet") || !has("b", "fleet") || !has("c", "boats") {
+		t.Fatal("expected only 'a' to be removed")
+	}
+
+	// the old object of a write is checked too
+	qc.invalidate(&commandDetails{
+		command: "set", key: "fleet",
+		oldObj: PO(25, 25), obj: PO(50, 50),
+	})
+	if has("b", "fleet") {
+		t.Fatal("expected 'b' to be removed")
+	}
+
+	// a drop removes all entries of the collection
+	put("a", "fleet", rect(0, 0, 10, 10))
+	qc.invalidate(&commandDetails{command: "drop", key: "boats"})
+	if has("c", "boats") || !has("a", "fleet") {
+		t.Fatal("expected only 'c' to be removed")
+	}
+
+	// the least recently used entry is evicted
+	put("b", "fleet", rect(20, 20, 30, 30))
+	put("c", "boats", rect(0, 0, 10, 10))
+	has("a", "fleet")
+	put("d", "fleet", rect(40, 40, 50, 50))
+	if !has("a", "fleet") || has("b", "fleet") || !has("d", "fleet") {
+		t.Fatal("expected 'b' to be evicted")
+	}
+
+	// a new field or a new collection is a miss
+	if qc.get("a", "fleet", col, 1) != nil || has("a", "fleet") {
+		t.Fatal("expected 'a' to be removed after a new field")
+	}
+	if qc.get("d", "fleet", collection.New(), 0) != nil {
+		t.Fatal("expected a miss for a new collection")
+	}
+
+	qc.invalidate(&commandDetails{command: "flushdb"})
+	if has("c", "boats") {
+		t.Fatal("expected an empty cache after flushdb")
+	}
+
+	m := make(map[string]interface{})
+	qc.stats("fleet", m)
+	if m["query_cache_entries"] != 0 || m["query_cache_hits"].(int) == 0 ||
+		m["query_cache_misses"].(int) == 0 {
+		t.Fatalf("unexpected stats %v", m)
+	}
+}
+
+func TestQueryCacheGetArea(t *testing.T) {
+	qc := newQueryCache()
+	col := collection.New()
+	area := geometry.Rect{Max: geometry.Point{X: 10, Y: 10}}
+	put := func(id, refID string) {
+		qc.put(&queryCacheEntry{
+			id: id, key: "fleet", col: col, rect: area,
+			refKey: "zones", refID: refID,
+			resp: resp.StringValue(id),
+		}, 10)
+	}
+	has := func(id string) bool {
+		return qc.get(id, "fleet", col, 0) != nil
+	}
+
+	// WITHIN fleet GET zones z1, and GET zones z2
+	put("a", "z1")
+	put("b", "z2")
+
+	// a new shape for z1, far from the area, removes only its searches
+	qc.invalidate(&commandDetails{
+		command: "set", key: "zones", id: "z1",
+		oldObj: PO(5, 5), obj: PO(50, 50),
+	})
+	if has("a") || !has("b") {
+		t.Fatal("expected only 'a' to be removed")
+	}
+
+	// a write on another collection with the same id is not a match
+	put("a", "z1")
+	qc.invalidate(&commandDetails{
+		command: "set", key: "boats", id: "z2", obj: PO(50, 50),
+	})
+	if !has("a") || !has("b") {
+		t.Fatal("expected both entries")
+	}
+
+	// a drop of the area collection removes all of its searches
+	qc.invalidate(&commandDetails{command: "drop", key: "zones"})
+	if has("a") || has("b") {
+		t.Fatal("expected all entries to be removed")
+	}
+	if len(qc.refs) != 0 {
+		t.Fatalf("expected no refs, got %d", len(qc.refs))
+	}
+}
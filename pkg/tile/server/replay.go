@@ -0,0 +1,222 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/space/pkg/utils/match"
+)
+
+const (
+	// replayBufferIdle is how long a channel may go without a publish before
+	// its buffered messages are discarded.
+	replayBufferIdle = 5 * time.Minute
+)
+
+var errInvalidEventID = errors.New("invalid last event id")
+
+type replayEntry struct {
+	id      int64
+	message string
+}
+
+type replayRing struct {
+	entries []replayEntry // oldest first
+	last    time.Time
+}
+
+// push appends an entry and drops the oldest entries over the size.
+func (ring *replayRing) push(entry replayEntry, size int) {
+	ring.entries = append(ring.entries, entry)
+	if len(ring.entries) > size {
+		ring.entries = ring.entries[len(ring.entries)-size:]
+	}
+}
+
+// scan iterates the ring from oldest to newest.
+func (ring *replayRing) scan(iter func(entry replayEntry)) {
+	for _, entry := range ring.entries {
+		iter(entry)
+	}
+}
+
+// replayBuffer keeps the most recent messages of the channels that have
+// streaming subscribers so that they can catch up after a reconnect. A
+// channel is buffered from its first stream subscription until it has no
+// stream subscribers and no publishes for replayBufferIdle.
+//
+// Every published message is assigned an id, which is also the id of the
+// message in a channel HISTORY. Ids are the publish time in unix
+// nanoseconds, so they are unique and increasing across server runs.
+type replayBuffer struct {
+	mu    sync.Mutex
+	last  int64 // last message id
+	rings map[string]*replayRing
+	subs  [2]map[string]int // stream subscriptions by channel and pattern
+	swept time.Time
+}
+
+func newReplayBuffer() *replayBuffer {
+	return &replayBuffer{
+		rings: make(map[string]*replayRing),
+		subs: [2]map[string]int{
+			make(map[string]int),
+			make(map[string]int),
+		},
+		swept: time.Now(),
+	}
+}
+
+// watch starts buffering the messages of a channel, or of the channels that
+// match a pattern, for a stream subscription.
+func (rb *replayBuffer) watch(kind int, name string) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.subs[kind][name]++
+	if kind == pubsubChannel && rb.rings[name] == nil {
+		rb.rings[name] = &replayRing{last: time.Now()}
+	}
+}
+
+// unwatch ends a stream subscription. The buffered messages are kept until
+// the channel goes idle, for the subscriber to resume.
+func (rb *replayBuffer) unwatch(kind int, name string) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.subs[kind][name]--; rb.subs[kind][name] <= 0 {
+		delete(rb.subs[kind], name)
+	}
+	if ring := rb.rings[name]; ring != nil && kind == pubsubChannel {
+		ring.last = time.Now()
+	}
+}
+
+// watched returns true when a channel without a ring has a stream
+// subscription through a pattern.
+func (rb *replayBuffer) watched(channel string) bool {
+	for pattern := range rb.subs[pubsubPattern] {
+		if match.Match(channel, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextID returns a new message id.
+func (rb *replayBuffer) nextID() int64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.next(time.Now())
+}
+
+func (rb *replayBuffer) next(now time.Time) int64 {
+	id := now.UnixNano()
+	if id <= rb.last {
+		id = rb.last + 1
+	}
+	rb.last = id
+	return id
+}
+
+// add records messages for a channel and returns their ids, which are new
+// ids unless they were taken with nextID and passed in. Only the channels
+// with stream subscribers are buffered, up to size messages each. A size of
+// zero turns off the buffering.
+func (rb *replayBuffer) add(channel string, ids []int64, messages []string,
+	size int,
+) []int64 {
+	now := time.Now()
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if ids == nil {
+		ids = make([]int64, len(messages))
+		for i := range ids {
+			ids[i] = rb.next(now)
+		}
+	}
+	ring := rb.rings[channel]
+	if ring == nil && size > 0 && rb.watched(channel) {
+		ring = new(replayRing)
+		rb.rings[channel] = ring
+	}
+	if ring != nil && size > 0 {
+		ring.last = now
+	}
+	for i, message := range messages {
+		if ring != nil && size > 0 {
+			ring.push(replayEntry{id: ids[i], message: message}, size)
+		}
+	}
+	if now.Sub(rb.swept) > replayBufferIdle {
+		for channel, ring := range rb.rings {
+			if rb.subs[pubsubChannel][channel] == 0 &&
+				(size == 0 || now.Sub(ring.last) > replayBufferIdle) {
+				delete(rb.rings, channel)
+			}
+		}
+		rb.swept = now
+	}
+	return ids
+}
+
+// since returns the buffered messages for a channel or pattern subscription
+// starting at the message id, along with the newest message id at the time
+// of the call.
+func (rb *replayBuffer) since(kind int, name string, from int64) (
+	msgs []submsg, floor int64,
+) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	collect := func(channel string, ring *replayRing) {
+		ring.scan(func(entry replayEntry) {
+			if entry.id >= from {
+				msg := submsg{
+					kind:     byte(kind),
+					channel:  channel,
+					message:  entry.message,
+					id:       entry.id,
+					replayed: true,
+				}
+				if kind == pubsubPattern {
+					msg.pattern = name
+				}
+				msgs = append(msgs, msg)
+			}
+		})
+	}
+	if kind == pubsubPattern {
+		for channel, ring := range rb.rings {
+			if match.Match(channel, name) {
+				collect(channel, ring)
+			}
+		}
+		sort.Slice(msgs, func(i, j int) bool {
+			return msgs[i].id < msgs[j].id
+		})
+	} else if ring := rb.rings[name]; ring != nil {
+		collect(name, ring)
+	}
+	return msgs, rb.last
+}
@@ -0,0 +1,142 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	const replayBufferSize = 256
+	rb := newReplayBuffer()
+	rb.watch(pubsubChannel, "fleet")
+	rb.watch(pubsubPattern, "al*")
+	var ids []int64
+	for i := 0; i < replayBufferSize+10; i++ {
+		ids = append(ids, rb.add("fleet", nil, []string{fmt.Sprint(i)},
+			replayBufferSize)...)
+	}
+	ids = append(ids, rb.add("alerts", nil, []string{"a", "b"},
+		replayBufferSize)...)
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("expected increasing ids, got %d after %d", ids[i], ids[i-1])
+		}
+	}
+
+	// an old id replays everything still buffered
+	msgs, floor := rb.since(pubsubChannel, "fleet", 0)
+	if len(msgs) != replayBufferSize {
+		t.Fatalf("expected %d, got %d", replayBufferSize, len(msgs))
+	}
+	if msgs[0].message != "10" || msgs[len(msgs)-1].message != fmt.Sprint(replayBufferSize+9) {
+		t.Fatalf("unexpected range %s..%s", msgs[0].message, msgs[len(msgs)-1].message)
+	}
+	if floor != ids[len(ids)-1] {
+		t.Fatalf("expected floor %d, got %d", ids[len(ids)-1], floor)
+	}
+
+	msgs, _ = rb.since(pubsubChannel, "fleet", ids[replayBufferSize+5])
+	if len(msgs) != 5 || msgs[0].id != ids[replayBufferSize+5] {
+		t.Fatalf("unexpected replay %v", msgs)
+	}
+
+	msgs, _ = rb.since(pubsubPattern, "*", ids[replayBufferSize+9])
+	if len(msgs) != 3 || msgs[0].channel != "fleet" || msgs[2].message != "b" ||
+		msgs[2].pattern != "*" {
+		t.Fatalf("unexpected replay %v", msgs)
+	}
+
+	// ids taken ahead of the publish are kept
+	id := rb.nextID()
+	if got := rb.add("fleet", []int64{id}, []string{"h"}, replayBufferSize); got[0] != id {
+		t.Fatalf("expected %d, got %d", id, got[0])
+	}
+
+	// last event ids are message ids or times
+	if from, err := parseLastEventID("42"); err != nil || from != 43 {
+		t.Fatalf("unexpected %d %v", from, err)
+	}
+	if _, err := parseLastEventID("dm8whoxb8qnp-1"); err != errInvalidEventID {
+		t.Fatalf("expected %v, got %v", errInvalidEventID, err)
+	}
+
+	// channels without stream subscribers are not buffered
+	rb.add("other", nil, []string{"x"}, replayBufferSize)
+	if len(rb.rings) != 2 {
+		t.Fatalf("expected 2 rings, got %d", len(rb.rings))
+	}
+
+	// the ring is trimmed to a smaller size, and zero turns it off
+	rb.add("fleet", nil, []string{"y"}, 4)
+	msgs, _ = rb.since(pubsubChannel, "fleet", 0)
+	if len(msgs) != 4 || msgs[3].message != "y" {
+		t.Fatalf("unexpected replay %v", msgs)
+	}
+	rb.add("fleet", nil, []string{"z"}, 0)
+	msgs, _ = rb.since(pubsubChannel, "fleet", 0)
+	if len(msgs) != 4 || msgs[3].message != "y" {
+		t.Fatalf("unexpected replay %v", msgs)
+	}
+
+	// an idle channel without subscribers is removed by the sweep
+	rb.unwatch(pubsubChannel, "fleet")
+	rb.unwatch(pubsubPattern, "al*")
+	rb.rings["fleet"].last = rb.rings["fleet"].last.Add(-2 * replayBufferIdle)
+	rb.swept = rb.swept.Add(-2 * replayBufferIdle)
+	rb.add("alerts", nil, []string{"c"}, replayBufferSize)
+	if len(rb.rings) != 1 || rb.rings["alerts"] == nil {
+		t.Fatalf("expected only alerts, got %v", rb.rings)
+	}
+}
+
+func TestParseStreamPath(t *testing.T) {
+	stream, err := parseStreamPath("fleet,geo%2Fzone*?token=secret&last_event_id=42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.channels) != 2 || stream.channels[1] != "geo/zone*" ||
+		!isChannelPattern(stream.channels[1]) || isChannelPattern(stream.channels[0]) {
+		t.Fatalf("unexpected channels %v", stream.channels)
+	}
+	if stream.token != "secret" || stream.lastEventID != "42" {
+		t.Fatalf("unexpected query %+v", stream)
+	}
+}
+
+func TestStreamOrigin(t *testing.T) {
+	config := &Config{}
+	if origin := config.streamOrigin("https://a.example"); origin != "" {
+		t.Fatalf("expected no origin by default, got %q", origin)
+	}
+	config.setProperty(StreamOrigin, "https://a.example, https://b.example", false)
+	if origin := config.streamOrigin("https://b.example"); origin != "https://b.example" {
+		t.Fatalf("expected https://b.example, got %q", origin)
+	}
+	if origin := config.streamOrigin("https://c.example"); origin != "" {
+		t.Fatalf("expected no origin, got %q", origin)
+	}
+	config.setProperty(StreamOrigin, "*", false)
+	if origin := config.streamOrigin("https://c.example"); origin != "*" {
+		t.Fatalf("expected *, got %q", origin)
+	}
+}
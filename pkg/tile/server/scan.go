@@ -68,7 +68,8 @@ func (s *Server) cmdScan(msg *Message) (res resp.Value, err error) {
 	sw, err := s.newScanWriter(
 		wr, msg, args.key, args.output, args.precision, args.glob, false,
 		args.cursor, args.limit, args.wheres, args.whereins, args.whereevals,
-		args.nofields)
+		args.filter, args.orderBy, args.fields, args.nofields, args.nogeometry,
+		args.profile)
 	if err != nil {
 		return NOMessage, err
 	}
@@ -78,12 +79,15 @@ func (s *Server) cmdScan(msg *Message) (res resp.Value, err error) {
 	sw.writeHead()
 	if sw.col != nil {
 		if sw.output == outputCount && len(sw.wheres) == 0 &&
-			len(sw.whereins) == 0 && sw.globEverything {
+			len(sw.whereins) == 0 && sw.filter == nil && sw.globEverything {
 			count := sw.col.Count() - int(args.cursor)
 			if count < 0 {
 				count = 0
 			}
 			sw.count = uint64(count)
+			if sw.profile != nil {
+				sw.profile.Strategy = "collection count"
+			}
 		} else {
 			g := glob.Parse(sw.globPattern, args.desc)
 			if g.Limits[0] == "" && g.Limits[1] == "" {
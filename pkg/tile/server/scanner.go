@@ -26,12 +26,15 @@ import (
 	"math"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/bhojpur/space/pkg/tile/clip"
 	"github.com/bhojpur/space/pkg/tile/collection"
+	"github.com/bhojpur/space/pkg/tile/filter"
 	"github.com/bhojpur/space/pkg/tile/glob"
 	"github.com/bhojpur/space/pkg/utils/geojson"
 	"github.com/bhojpur/space/pkg/utils/resp"
+	"github.com/bhojpur/space/pkg/utils/tinyqueue"
 	"github.com/mmcloughlin/geohash"
 )
 
@@ -62,9 +65,18 @@ type scanWriter struct {
 	wheres         []whereT
 	whereins       []whereinT
 	whereevals     []whereevalT
+	filter         *filter.Expr
+	orderBy        []orderByT
+	ordered        *tinyqueue.Queue
+	orderCap       uint64
+	orderMatches   uint64
 	numberIters    uint64
 	numberItems    uint64
 	nofields       bool
+	nogeometry     bool
+	profile        *scanProfile
+	explain        bool
+	headLen        int
 	cursor         uint64
 	limit          uint64
 	hitLimit       bool
@@ -97,7 +109,8 @@ func (s *Server) newScanWriter(
 	wr *bytes.Buffer, msg *Message, key string, output outputT,
 	precision uint64, globPattern string, matchValues bool,
 	cursor, limit uint64, wheres []whereT, whereins []whereinT,
-	whereevals []whereevalT, nofields bool,
+	whereevals []whereevalT, filter *filter.Expr, orderBy []orderByT,
+	fields []string, nofields, nogeometry, profile bool,
 ) (
 	*scanWriter, error,
 ) {
@@ -121,8 +134,11 @@ func (s *Server) newScanWriter(
 		cursor:      cursor,
 		output:      output,
 		nofields:    nofields,
+		nogeometry:  nogeometry,
+		explain:     msg.explain,
 		precision:   precision,
 		whereevals:  whereevals,
+		filter:      filter,
 		globPattern: globPattern,
 		matchValues: matchValues,
 	}
@@ -160,6 +176,15 @@ func (s *Server) newScanWriter(
 		}
 	}
 	sw.fvals = make([]float64, len(sw.farr))
+	if fields != nil {
+		// only the output uses farr after this point, fvals keeps the
+		// size of all fields.
+		sw.farr = selectFields(sw.farr, fields)
+	}
+	sw.setOrderBy(orderBy)
+	if profile || msg.explain {
+		sw.profile = &scanProfile{start: time.Now()}
+	}
 	return sw, nil
 }
 
@@ -175,6 +200,7 @@ func (sw *scanWriter) hasFieldsOutput() bool {
 func (sw *scanWriter) writeHead() {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	sw.headLen = sw.wr.Len()
 	switch sw.msg.OutputType {
 	case JSON:
 		if len(sw.farr) > 0 && sw.hasFieldsOutput() {
@@ -208,6 +234,16 @@ func (sw *scanWriter) writeHead() {
 func (sw *scanWriter) writeFoot() {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
+	if sw.ordered != nil {
+		sw.writeOrdered()
+	}
+	if sw.profile != nil {
+		sw.profile.totalTime = time.Since(sw.profile.start)
+		if sw.explain {
+			sw.writeExplain()
+			return
+		}
+	}
 	cursor := sw.numberIters
 	if !sw.hitLimit {
 		cursor = 0
@@ -222,19 +258,43 @@ func (sw *scanWriter) writeFoot() {
 		}
 		sw.wr.WriteString(`,"count":` + strconv.FormatUint(sw.count, 10))
 		sw.wr.WriteString(`,"cursor":` + strconv.FormatUint(cursor, 10))
+		if sw.profile != nil {
+			sw.wr.WriteString(`,"profile":`)
+			sw.wr.Write(sw.profile.appendJSON(nil))
+		}
 	case RESP:
 		if sw.output == outputCount {
 			sw.respOut = resp.IntegerValue(int(sw.count))
+			if sw.profile != nil {
+				sw.respOut = resp.ArrayValue([]resp.Value{
+					sw.respOut, sw.profile.respValue(),
+				})
+			}
 		} else {
 			values := []resp.Value{
 				resp.IntegerValue(int(cursor)),
 				resp.ArrayValue(sw.values),
 			}
+			if sw.profile != nil {
+				values = append(values, sw.profile.respValue())
+			}
 			sw.respOut = resp.ArrayValue(values)
 		}
 	}
 }
 
+// writeExplain replaces the results with the statistics of the search.
+func (sw *scanWriter) writeExplain() {
+	switch sw.msg.OutputType {
+	case JSON:
+		sw.wr.Truncate(sw.headLen)
+		sw.wr.WriteString(`,"explain":`)
+		sw.wr.Write(sw.profile.appendJSON(nil))
+	case RESP:
+		sw.respOut = sw.profile.respValue()
+	}
+}
+
 func extractZCoordinate(o geojson.Object) float64 {
 	for {
 		switch g := o.(type) {
@@ -368,6 +428,10 @@ func (sw *scanWriter) globMatch(id string, o geojson.Object) (ok, keepGoing bool
 
 // Increment cursor
 func (sw *scanWriter) Offset() uint64 {
+	if sw.ordered != nil {
+		// ordered results are found by scanning from the start
+		return 0
+	}
 	return sw.cursor
 }
 
@@ -375,16 +439,55 @@ func (sw *scanWriter) Step(n uint64) {
 	sw.numberIters += n
 }
 
+// Parallelism returns the number of goroutines that the collection may use
+// for the geometry tests of the search.
+func (sw *scanWriter) Parallelism() int {
+	return sw.s.config.parallelism()
+}
+
 // ok is whether the object passes the test and should be written
 // keepGoing is whether there could be more objects to test
 func (sw *scanWriter) testObject(id string, o geojson.Object, fields []float64) (
 	ok, keepGoing bool, fieldVals []float64) {
+	start := sw.profile.now()
 	match, kg := sw.globMatch(id, o)
 	if !match {
+		sw.profile.rejected(start, rejectGlob)
 		return false, kg, fieldVals
 	}
 	nf, ok := sw.fieldMatch(fields, o)
-	return ok, true, nf
+	if !ok {
+		sw.profile.rejected(start, rejectField)
+		return false, true, nf
+	}
+	if sw.filter != nil && !sw.filter.Match(&filterEnv{id, o, fields, sw.fmap}) {
+		sw.profile.rejected(start, rejectFilter)
+		return false, true, nf
+	}
+	sw.profile.passed(start)
+	return true, true, nf
+}
+
+// filterEnv is an object that a FILTER expression is evaluated against.
+type filterEnv struct {
+	id     string
+	o      geojson.Object
+	fields []float64
+	fmap   map[string]int
+}
+
+func (env *filterEnv) ID() string             { return env.id }
+func (env *filterEnv) Object() geojson.Object { return env.o }
+
+func (env *filterEnv) Field(name string) (float64, bool) {
+	idx, ok := env.fmap[name]
+	if !ok {
+		return 0, false
+	}
+	if idx < len(env.fields) {
+		return env.fields[idx], true
+	}
+	return 0, true
 }
 
 //id string, o geojson.Object, fields []float64, noLock bool
@@ -401,8 +504,25 @@ func (sw *scanWriter) writeObject(opts ScanWriterParams) bool {
 	if sw.output == outputCount {
 		return sw.count < sw.limit
 	}
+	if sw.ordered != nil {
+		start := sw.profile.now()
+		sw.pushOrdered(opts)
+		sw.profile.ordered(start)
+		return keepGoing
+	}
+	return sw.writeResult(opts) && keepGoing
+}
+
+// writeResult writes an object that passed the tests, and returns false
+// when the limit is reached.
+func (sw *scanWriter) writeResult(opts ScanWriterParams) bool {
+	if sw.profile != nil {
+		defer sw.profile.wrote(time.Now())
+	}
 	if opts.clip != nil {
+		start := sw.profile.now()
 		opts.o = clip.Clip(opts.o, opts.clip, &sw.s.geomIndexOpts)
+		sw.profile.clip(start)
 	}
 	switch sw.msg.OutputType {
 	case JSON:
@@ -452,7 +572,11 @@ func (sw *scanWriter) writeObject(opts ScanWriterParams) bool {
 			wr.WriteString(jsonString(opts.id))
 		} else {
 			wr.WriteString(`{"id":` + jsonString(opts.id))
-			switch sw.output {
+			output := sw.output
+			if sw.nogeometry {
+				output = outputIDs
+			}
+			switch output {
 			case outputObjects:
 				wr.WriteString(`,"object":` + string(opts.o.AppendJSON(nil)))
 			case outputPoints:
@@ -480,7 +604,11 @@ func (sw *scanWriter) writeObject(opts ScanWriterParams) bool {
 		if sw.output == outputIDs {
 			sw.values = append(sw.values, vals[0])
 		} else {
-			switch sw.output {
+			output := sw.output
+			if sw.nogeometry {
+				output = outputIDs
+			}
+			switch output {
 			case outputObjects:
 				vals = append(vals, resp.StringValue(opts.o.String()))
 			case outputPoints:
@@ -539,5 +667,5 @@ func (sw *scanWriter) writeObject(opts ScanWriterParams) bool {
 		sw.hitLimit = true
 		return false
 	}
-	return keepGoing
+	return true
 }
@@ -21,11 +21,15 @@ package server
 // THE SOFTWARE.
 
 import (
+	"encoding/json"
 	"math"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bhojpur/space/pkg/tile/collection"
 	"github.com/bhojpur/space/pkg/utils/geojson"
 	"github.com/bhojpur/space/pkg/utils/geojson/geometry"
 )
@@ -69,3 +73,92 @@ func BenchmarkFieldMatch(t *testing.B) {
 		}
 	}
 }
+
+func TestSelectFields(t *testing.T) {
+	farr := []string{"age", "rating", "speed"}
+	sel := selectFields(farr, []string{"speed", "nope", "age", "speed"})
+	if !reflect.DeepEqual(sel, []string{"speed", "age"}) {
+		t.Fatalf("got %v", sel)
+	}
+	vs, fields, err := parseFieldList([]string{"2", "speed", "age", "IDS"})
+	if err != nil || !reflect.DeepEqual(fields, []string{"speed", "age"}) ||
+		len(vs) != 1 {
+		t.Fatalf("got %v %v %v", vs, fields, err)
+	}
+	for _, args := range [][]string{{}, {"0"}, {"2", "speed"}, {"x", "speed"}} {
+		if _, _, err := parseFieldList(args); err == nil {
+			t.Fatalf("%v: expected error", args)
+		}
+	}
+}
+
+func TestScanFieldsOutput(t *testing.T) {
+	s, _ := newFenceTestServer(t)
+	col := collection.New()
+	col.Set("truck1", PO(-112, 33), []string{"speed", "age", "rating"},
+		[]float64{55, 3, 0}, 0)
+	col.Set("truck2", PO(-111, 34), []string{"speed"}, []float64{10}, 0)
+	s.setCol("fleet", col)
+	tests := []struct {
+		args       string
+		json, resp string
+	}{
+		{"SCAN fleet FIELDS 2 rating speed OBJECTS",
+			`"fields":["rating","speed"],"objects":[` +
+				`{"id":"truck1","object":{"type":"Point","coordinates":[-112,33]},"fields":[0,55]},` +
+				`{"id":"truck2","object":{"type":"Point","coordinates":[-111,34]},"fields":[0,10]}]`,
+			`[0 [[truck1 {"type":"Point","coordinates":[-112,33]} [speed 55]] ` +
+				`[truck2 {"type":"Point","coordinates":[-111,34]} [speed 10]]]]`},
+		{"SCAN fleet NOGEOMETRY OBJECTS",
+			`"fields":["age","rating","speed"],"objects":[` +
+				`{"id":"truck1","fields":[3,0,55]},{"id":"truck2","fields":[0,0,10]}]`,
+			`[0 [[truck1 [age 3 speed 55]] [truck2 [speed 10]]]]`},
+		{"SCAN fleet FIELDS 1 speed NOGEOMETRY POINTS",
+			`"fields":["speed"],"points":[` +
+				`{"id":"truck1","fields":[55]},{"id":"truck2","fields":[10]}]`,
+			`[0 [[truck1 [speed 55]] [truck2 [speed 10]]]]`},
+		{"SCAN fleet NOFIELDS NOGEOMETRY OBJECTS",
+			`"objects":[{"id":"truck1"},{"id":"truck2"}]`,
+			`[0 [[truck1] [truck2]]]`},
+	}
+	for _, tt := range tests {
+		res, err := s.cmdScan(&Message{Args: strings.Fields(tt.args),
+			OutputType: JSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"ok":true,` + tt.json + `,"count":2,"cursor":0,"elapsed"`
+		if out := res.String(); !strings.HasPrefix(out, exp) {
+			t.Fatalf("%s: expected %s, got %s", tt.args, exp, out)
+		}
+		res, err = s.cmdScan(&Message{Args: strings.Fields(tt.args),
+			OutputType: RESP})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := res.String(); out != tt.resp {
+			t.Fatalf("%s: expected %s, got %s", tt.args, tt.resp, out)
+		}
+	}
+}
+
+func TestScanProfile(t *testing.T) {
+	p := &scanProfile{totalTime: time.Millisecond, matched: 3}
+	p.Strategy = "spatial index"
+	p.GeometryTime = 2 * time.Millisecond
+	var v struct {
+		Strategy string
+		Matched  int
+		Times    map[string]string
+	}
+	if err := json.Unmarshal(p.appendJSON(nil), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Strategy != "spatial index" || v.Matched != 3 ||
+		v.Times["index"] != "0s" || v.Times["total"] != "1ms" {
+		t.Fatalf("got %+v", v)
+	}
+	if n := len(p.respValue().Array()); n != 22 {
+		t.Fatalf("expected 22 values, got %d", n)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/cron"
+	"github.com/bhojpur/space/pkg/tile/log"
+	"github.com/bhojpur/space/pkg/utils/geojson"
+)
+
+const bgScheduleDelay = time.Second
+
+// hookSchedule limits a hook to the minutes that match a cron expression in
+// a timezone, such as "* 7-8,14-15 * * mon-fri" in "America/Denver".
+type hookSchedule struct {
+	src    string // cron expression
+	tz     string // timezone name
+	cron   *cron.Schedule
+	loc    *time.Location
+	exit   bool // send exit events for objects inside when a window closes
+	active bool // the window was open at the last check
+}
+
+func parseHookSchedule(src, tz string) (*hookSchedule, error) {
+	sched, err := cron.Parse(src)
+	if err != nil {
+		return nil, errInvalidArgument(src)
+	}
+	if strings.EqualFold(tz, "local") {
+		// the server timezone would make the schedule depend on the host
+		return nil, errInvalidArgument(tz)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errInvalidArgument(tz)
+	}
+	sc := &hookSchedule{src: src, tz: tz, cron: sched, loc: loc}
+	sc.active = sc.activeAt(time.Now())
+	return sc, nil
+}
+
+// activeAt returns true if the time is within an activation window.
+func (sc *hookSchedule) activeAt(t time.Time) bool {
+	return sc.cron.Match(t.In(sc.loc))
+}
+
+// backgroundSchedules watches for the activation windows of hooks to open
+// and close. Windows change on minute boundaries, so it checks once a second
+// for a new minute.
+func (s *Server) backgroundSchedules() {
+	var last time.Time
+	for {
+		if s.stopServer.on() {
+			return
+		}
+		now := time.Now()
+		if minute := now.Truncate(time.Minute); !minute.Equal(last) {
+			last = minute
+			func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.backgroundCloseSchedules(now)
+			}()
+		}
+		time.Sleep(bgScheduleDelay)
+	}
+}
+
+// backgroundCloseSchedules updates the state of each scheduled hook and
+// queues exit events for the hooks with EXITONCLOSE whose window has just
+// closed.
+func (s *Server) backgroundCloseSchedules(now time.Time) {
+	var scheduled []*Hook
+	s.hooks.Walk(func(v []interface{}) {
+		for _, v := range v {
+			if hook := v.(*Hook); hook.schedule != nil {
+				scheduled = append(scheduled, hook)
+			}
+		}
+	})
+	var hooks []*Hook
+	var msgs [][]string
+	for _, hook := range scheduled {
+		active := hook.schedule.activeAt(now)
+		closed := hook.schedule.active && !active
+		hook.schedule.active = active
+		if !closed || !hook.schedule.exit || s.config.followHost() != "" {
+			continue
+		}
+		if hmsgs := s.scheduleExitMsgs(hook, now); len(hmsgs) > 0 {
+			hooks = append(hooks, hook)
+			msgs = append(msgs, hmsgs)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	if err := s.queueHookMsgs(hooks, msgs); err != nil {
+		log.Errorf("schedule: %v", err)
+	}
+}
+
+// scheduleExitMsgs returns the exit messages for the objects that are inside
+// the hook's fence. Roaming fences have no inside and are skipped.
+func (s *Server) scheduleExitMsgs(hook *Hook, now time.Time) []string {
+	fence := hook.Fence
+	if fence.obj == nil || fence.roam.on {
+		return nil
+	}
+	col := s.getCol(hook.Key)
+	if col == nil {
+		return nil
+	}
+	fmap := col.FieldMap()
+	var msgs []string
+	col.Intersects(fence.obj, 0, nil, nil,
+		func(id string, obj geojson.Object, fields []float64) bool {
+			if !fenceMatchObject(fence, obj) {
+				return true
+			}
+			d := &commandDetails{
+				command:   "set",
+				key:       hook.Key,
+				id:        id,
+				fmap:      fmap,
+				obj:       obj,
+				fields:    fields,
+				oldObj:    obj,
+				oldFields: fields,
+				timestamp: now,
+				detect:    "exit",
+			}
+			for _, msg := range FenceMatch(hook.Name, hook.ScanWriter,
+				fence, hook.Metas, d) {
+				// mark the message as coming from the closed window
+				msgs = append(msgs, msg[:len(msg)-1]+`,"schedule":"close"}`)
+			}
+			return true
+		},
+	)
+	return msgs
+}
@@ -0,0 +1,53 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHookSchedule(t *testing.T) {
+	sc, err := parseHookSchedule("* 7-8 * * mon-fri", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2020-01-06 is a Monday
+	if !sc.activeAt(time.Date(2020, 1, 6, 7, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected active")
+	}
+	if sc.activeAt(time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected inactive")
+	}
+	// the window is in the schedule's timezone, not the time's
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	if !sc.activeAt(time.Date(2020, 1, 6, 9, 30, 0, 0, loc)) {
+		t.Fatal("expected active")
+	}
+	for _, args := range [][2]string{
+		{"* 7-8 * *", "UTC"}, {"* 25 * * *", "UTC"},
+		{"* * * * *", "Nowhere/Special"}, {"* * * * *", "Local"},
+	} {
+		if _, err := parseHookSchedule(args[0], args[1]); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
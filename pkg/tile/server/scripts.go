@@ -613,6 +613,8 @@ func (s *Server) commandInScript(msg *Message) (
 		err = fmt.Errorf("unknown command '%s'", msg.Args[0])
 	case "set":
 		res, d, err = s.cmdSet(msg)
+	case "mset":
+		res, d, err = s.cmdMset(msg)
 	case "fset":
 		res, d, err = s.cmdFset(msg)
 	case "del":
@@ -647,6 +649,8 @@ func (s *Server) commandInScript(msg *Message) (
 		res, err = s.cmdBounds(msg)
 	case "get":
 		res, err = s.cmdGet(msg)
+	case "mget":
+		res, err = s.cmdMget(msg)
 	case "jget":
 		res, err = s.cmdJget(msg)
 	case "jset":
@@ -679,7 +683,7 @@ func (s *Server) luaBhojpurCall(evalcmd string, cmd string, args ...string) (res
 
 	switch msg.Command() {
 	case "ping", "echo", "auth", "massinsert", "shutdown", "gc",
-		"sethook", "pdelhook", "delhook",
+		"sethook", "pdelhook", "delhook", "hookpause", "hookresume",
 		"follow", "readonly", "config", "output", "client",
 		"aofshrink",
 		"script load", "script exists", "script flush",
@@ -706,8 +710,8 @@ func (s *Server) luaBhojpurAtomicRW(msg *Message) (resp.Value, error) {
 	switch msg.Command() {
 	default:
 		return resp.NullValue(), errCmdNotSupported
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "mset", "del", "drop", "fset", "flushdb", "expire", "persist", "jset",
+		"pdel", "rename", "renamenx":
 		// write operations
 		write = true
 		if s.config.followHost() != "" {
@@ -716,7 +720,7 @@ func (s *Server) luaBhojpurAtomicRW(msg *Message) (resp.Value, error) {
 		if s.config.readOnly() {
 			return resp.NullValue(), errReadOnly
 		}
-	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
+	case "get", "mget", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
 		"ttl", "bounds", "server", "info", "type", "jget", "test":
 		// read operations
 		if s.config.followHost() != "" && !s.fcuponce {
@@ -764,12 +768,12 @@ func (s *Server) luaBhojpurAtomicRO(msg *Message) (resp.Value, error) {
 	default:
 		return resp.NullValue(), errCmdNotSupported
 
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "mset", "del", "drop", "fset", "flushdb", "expire", "persist", "jset",
+		"pdel", "rename", "renamenx":
 		// write operations
 		return resp.NullValue(), errReadOnly
 
-	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
+	case "get", "mget", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
 		"ttl", "bounds", "server", "info", "type", "jget", "test":
 		// read operations
 		if s.config.followHost() != "" && !s.fcuponce {
@@ -808,8 +812,8 @@ func (s *Server) luaBhojpurNonAtomic(msg *Message) (resp.Value, error) {
 	switch msg.Command() {
 	default:
 		return resp.NullValue(), errCmdNotSupported
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "mset", "del", "drop", "fset", "flushdb", "expire", "persist", "jset",
+		"pdel", "rename", "renamenx":
 		// write operations
 		write = true
 		s.mu.Lock()
@@ -820,7 +824,7 @@ func (s *Server) luaBhojpurNonAtomic(msg *Message) (resp.Value, error) {
 		if s.config.readOnly() {
 			return resp.NullValue(), errReadOnly
 		}
-	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
+	case "get", "mget", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
 		"ttl", "bounds", "server", "info", "type", "jget", "test":
 		// read operations
 		s.mu.RLock()
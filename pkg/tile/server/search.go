@@ -43,26 +43,43 @@ const defaultCircleSteps = 64
 
 type liveFenceSwitches struct {
 	searchScanBaseTokens
-	obj  geojson.Object
-	cmd  string
-	roam roamSwitches
+	obj     geojson.Object
+	getKey  string // key of the GET area, if any
+	getID   string // id of the GET area, if any
+	cmd     string
+	roam    roamSwitches
+	route   routeSwitches
+	density *fenceDensity
 }
 
 type roamSwitches struct {
-	on      bool
-	key     string
-	id      string
-	pattern bool
-	meters  float64
-	scan    string
+	on          bool
+	key         string
+	id          string
+	pattern     bool
+	meters      float64
+	scan        string
+	separation  float64       // pairs stay together until this far apart
+	minduration time.Duration // pairs are reported once together this long
+	pairs       *roamPairs    // nil unless SEPARATION or MINDURATION is used
 }
 
-type roamMatch struct {
-	id     string
-	obj    geojson.Object
+type routeSwitches struct {
+	on     bool
+	key    string
+	id     string // route id, or "*" for the route with the object's id
+	field  string // field that holds the route id, in place of id
 	meters float64
 }
 
+type roamMatch struct {
+	id       string
+	obj      geojson.Object
+	meters   float64
+	start    time.Time // when the pair came together, if tracked
+	duration time.Duration
+}
+
 func (lfs liveFenceSwitches) Error() string {
 	return goingLive
 }
@@ -224,6 +241,10 @@ func (s *Server) cmdSearchArgs(
 		// allow roaming for nearby fence searches.
 		found = true
 	}
+	if !found && lfs.searchScanBaseTokens.fence && ltyp == "route" && cmd == "nearby" {
+		// allow route corridors for nearby fence searches.
+		found = true
+	}
 	if !found {
 		err = errInvalidArgument(typ)
 		return
@@ -390,6 +411,7 @@ func (s *Server) cmdSearchArgs(
 			err = errInvalidNumberOfArguments
 			return
 		}
+		lfs.getKey, lfs.getID = key, id
 		col := s.getCol(key)
 		if col == nil {
 			err = errKeyNotFound
@@ -420,18 +442,80 @@ func (s *Server) cmdSearchArgs(
 			err = errInvalidArgument(smeters)
 			return
 		}
-		var scan string
-		if vs, scan, ok = tokenval(vs); ok {
-			if strings.ToLower(scan) != "scan" {
-				err = errInvalidArgument(scan)
+		var opt, val string
+		for len(vs) > 0 {
+			vs, opt, _ = tokenval(vs)
+			if vs, val, ok = tokenval(vs); !ok || val == "" {
+				err = errInvalidNumberOfArguments
 				return
 			}
-			if vs, scan, ok = tokenval(vs); !ok || scan == "" {
+			switch strings.ToLower(opt) {
+			default:
+				err = errInvalidArgument(opt)
+				return
+			case "scan":
+				lfs.roam.scan = val
+			case "separation":
+				lfs.roam.separation, err = strconv.ParseFloat(val, 64)
+				if err != nil || lfs.roam.separation < lfs.roam.meters {
+					err = errInvalidArgument(val)
+					return
+				}
+			case "minduration":
+				var secs float64
+				secs, err = strconv.ParseFloat(val, 64)
+				if err != nil || secs < 0 {
+					err = errInvalidArgument(val)
+					return
+				}
+				lfs.roam.minduration = time.Duration(secs * float64(time.Second))
+			}
+		}
+		if lfs.roam.separation > 0 || lfs.roam.minduration > 0 {
+			lfs.roam.pairs = &roamPairs{}
+		}
+	case "route":
+		lfs.route.on = true
+		if vs, lfs.route.key, ok = tokenval(vs); !ok || lfs.route.key == "" {
+			err = errInvalidNumberOfArguments
+			return
+		}
+		if vs, lfs.route.id, ok = tokenval(vs); !ok || lfs.route.id == "" {
+			err = errInvalidNumberOfArguments
+			return
+		}
+		if strings.ToLower(lfs.route.id) == "field" {
+			// ROUTE key FIELD name meters
+			lfs.route.id = ""
+			if vs, lfs.route.field, ok = tokenval(vs); !ok || lfs.route.field == "" {
 				err = errInvalidNumberOfArguments
 				return
 			}
-			lfs.roam.scan = scan
 		}
+		var smeters string
+		if vs, smeters, ok = tokenval(vs); !ok || smeters == "" {
+			err = errInvalidNumberOfArguments
+			return
+		}
+		lfs.route.meters, err = strconv.ParseFloat(smeters, 64)
+		if err != nil || lfs.route.meters < 0 {
+			err = errInvalidArgument(smeters)
+			return
+		}
+	}
+
+	// deviate and return are the only detections for route corridors, and
+	// density and fieldchange are detected on their own over a static area
+	for detect := range lfs.detect {
+		if lfs.route.on != (detect == "deviate" || detect == "return") ||
+			((lfs.detect["density"] || lfs.detect["fieldchange"]) &&
+				(len(lfs.detect) > 1 || lfs.roam.on)) {
+			err = errInvalidArgument(detect)
+			return
+		}
+	}
+	if lfs.detect["density"] {
+		lfs.density = &fenceDensity{}
 	}
 
 	var clip_rect *geojson.Rect
@@ -505,11 +589,15 @@ func (s *Server) cmdNearby(msg *Message) (res resp.Value, err error) {
 	}
 	sargs.cmd = "nearby"
 	if sargs.fence {
+		if msg.explain {
+			return NOMessage, errors.New("FENCE is not allowed with EXPLAIN")
+		}
 		return NOMessage, sargs
 	}
 	sw, err := s.newScanWriter(
 		wr, msg, sargs.key, sargs.output, sargs.precision, sargs.glob, false,
-		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.nofields)
+		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.filter, sargs.orderBy,
+		sargs.fields, sargs.nofields, sargs.nogeometry, sargs.profile)
 	if err != nil {
 		return NOMessage, err
 	}
@@ -597,11 +685,38 @@ func (s *Server) cmdWithinOrIntersects(cmd string, msg *Message) (res resp.Value
 	}
 	sargs.cmd = cmd
 	if sargs.fence {
+		if msg.explain {
+			return NOMessage, errors.New("FENCE is not allowed with EXPLAIN")
+		}
 		return NOMessage, sargs
 	}
+	var cached *queryCacheEntry
+	if s.config.queryCacheSize() > 0 && !msg.explain &&
+		!sargs.profile && !sargs.usingLua() {
+		if col := s.getCol(sargs.key); col != nil {
+			cached = &queryCacheEntry{
+				id:      queryCacheID(msg),
+				key:     sargs.key,
+				col:     col,
+				rect:    sargs.obj.Rect(),
+				nfields: len(col.FieldArr()),
+				refKey:  sargs.getKey,
+				refID:   sargs.getID,
+			}
+			if entry := s.qcache.get(cached.id, cached.key, col,
+				cached.nfields); entry != nil {
+				if msg.OutputType == JSON {
+					return resp.StringValue(string(entry.json) +
+						`,"elapsed":"` + time.Since(start).String() + "\"}"), nil
+				}
+				return entry.resp, nil
+			}
+		}
+	}
 	sw, err := s.newScanWriter(
 		wr, msg, sargs.key, sargs.output, sargs.precision, sargs.glob, false,
-		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.nofields)
+		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.filter, sargs.orderBy,
+		sargs.fields, sargs.nofields, sargs.nogeometry, sargs.profile)
 	if err != nil {
 		return NOMessage, err
 	}
@@ -641,6 +756,14 @@ func (s *Server) cmdWithinOrIntersects(cmd string, msg *Message) (res resp.Value
 		}
 	}
 	sw.writeFoot()
+	if cached != nil {
+		if msg.OutputType == JSON {
+			cached.json = append([]byte(nil), wr.Bytes()...)
+		} else {
+			cached.resp = sw.respOut
+		}
+		s.qcache.put(cached, s.config.queryCacheSize())
+	}
 	if msg.OutputType == JSON {
 		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
 		return resp.BytesValue(wr.Bytes()), nil
@@ -685,7 +808,8 @@ func (s *Server) cmdSearch(msg *Message) (res resp.Value, err error) {
 	}
 	sw, err := s.newScanWriter(
 		wr, msg, sargs.key, sargs.output, sargs.precision, sargs.glob, true,
-		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.nofields)
+		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.filter, sargs.orderBy,
+		sargs.fields, sargs.nofields, sargs.nogeometry, sargs.profile)
 	if err != nil {
 		return NOMessage, err
 	}
@@ -694,12 +818,16 @@ func (s *Server) cmdSearch(msg *Message) (res resp.Value, err error) {
 	}
 	sw.writeHead()
 	if sw.col != nil {
-		if sw.output == outputCount && len(sw.wheres) == 0 && sw.globEverything {
+		if sw.output == outputCount && len(sw.wheres) == 0 &&
+			sw.filter == nil && sw.globEverything {
 			count := sw.col.Count() - int(sargs.cursor)
 			if count < 0 {
 				count = 0
 			}
 			sw.count = uint64(count)
+			if sw.profile != nil {
+				sw.profile.Strategy = "collection count"
+			}
 		} else {
 			g := glob.Parse(sw.globPattern, sargs.desc)
 			if g.Limits[0] == "" && g.Limits[1] == "" {
@@ -68,6 +68,7 @@ func errTimeoutOnCmd(cmd string) error {
 const (
 	goingLive     = "going live"
 	hookLogPrefix = "hook:log:"
+	chanLogPrefix = "chan:log:"
 )
 
 // commandDetails is detailed information about a mutable command. It's used
@@ -86,6 +87,8 @@ type commandDetails struct {
 	parent    bool              // when true, only children are forwarded
 	pattern   string            // PDEL key pattern
 	children  []*commandDetails // for multi actions such as "PDEL"
+	detect    string            // forced detect value, such as a scheduled exit
+	aof       [][]string        // commands written in place of the client command
 }
 
 // Server is a Bhojpur Space controller
@@ -120,13 +123,15 @@ type Server struct {
 	conns   map[int]*Client
 
 	mu       sync.RWMutex
-	aof      *os.File     // active aof file
-	aofdirty int32        // mark the aofbuf as having data
-	aofbuf   []byte       // prewrite buffer
-	aofsz    int          // active size of the aof file
-	qdb      *kvdb.DB     // hook queue log
-	qidx     uint64       // hook queue log last idx
-	cols     *btree.BTree // data collections
+	aof      *os.File       // active aof file
+	aofdirty int32          // mark the aofbuf as having data
+	aofbuf   []byte         // prewrite buffer
+	aofsz    int            // active size of the aof file
+	qdb      *kvdb.DB       // hook queue log
+	qidx     uint64         // hook queue log last idx
+	chlens   map[string]int // channel history lengths, counted once
+	cols     *btree.BTree   // data collections
+	colver   uint64         // last object version of the removed collections
 
 	follows      map[*bytes.Buffer]bool
 	fcond        *sync.Cond
@@ -140,7 +145,7 @@ type Server struct {
 	hooks        *btree.BTree // hook name -- [string]*Hook
 	hookCross    *rtree.RTree // hook spatial tree for "cross" geofences
 	hookTree     *rtree.RTree // hook spatial tree for all
-	hooksOut     *btree.BTree // hooks with "outside" detection -- [string]*Hook
+	hooksOut     *btree.BTree // hooks that see updates outside of their area -- [string]*Hook
 	groupHooks   *btree.BTree // hooks that are connected to objects
 	groupObjects *btree.BTree // objects that are connected to hooks
 	hookExpires  *btree.BTree // queue of all hooks marked for expiration
@@ -151,6 +156,12 @@ type Server struct {
 
 	pubsub *pubsub
 
+	minmoves map[string]minMove // default MINMOVE of collection keys
+
+	slowlog  *slowlog
+	cmdstats *commandStats
+	qcache   *queryCache
+
 	monconnsMu sync.RWMutex
 	monconns   map[net.Conn]bool // monitor connections
 }
@@ -183,6 +194,8 @@ func Serve(opts Options) error {
 		port:      opts.Port,
 		dir:       opts.Dir,
 		follows:   make(map[*bytes.Buffer]bool),
+		minmoves:  make(map[string]minMove),
+		chlens:    make(map[string]int),
 		fcond:     sync.NewCond(&sync.Mutex{}),
 		lives:     make(map[*liveBuffer]bool),
 		lcond:     sync.NewCond(&sync.Mutex{}),
@@ -195,6 +208,9 @@ func Serve(opts Options) error {
 		conns:     make(map[int]*Client),
 		http:      opts.UseHTTP,
 		pubsub:    newPubsub(),
+		slowlog:   newSlowlog(),
+		cmdstats:  newCommandStats(),
+		qcache:    newQueryCache(),
 		monconns:  make(map[net.Conn]bool),
 		cols:      btree.NewNonConcurrent(byCollectionKey),
 
@@ -216,6 +232,10 @@ func Serve(opts Options) error {
 	if err != nil {
 		return err
 	}
+	if err := s.epc.AllowFiles(s.config.hookFileDir()); err != nil {
+		return err
+	}
+	s.epc.AllowUnix(s.config.hookUnix())
 
 	// Send "500 Internal Server" error instead of "200 OK" for json responses
 	// with `"ok":false`. T38HTTP500ERRORS=1
@@ -316,6 +336,8 @@ func Serve(opts Options) error {
 			s.aof.Sync()
 		}()
 	}
+	// channels may have been deleted while the aof was loading
+	s.sweepChanHistory()
 
 	// Start background routines
 	if s.config.followHost() != "" {
@@ -337,6 +359,7 @@ func Serve(opts Options) error {
 	go s.watchLuaStatePool()
 	go s.watchAutoGC()
 	go s.backgroundExpiring()
+	go s.backgroundSchedules()
 	go s.backgroundSyncAOF()
 	defer func() {
 		// Stop background routines
@@ -707,7 +730,11 @@ func byCollectionKey(a, b interface{}) bool {
 	return a.(*collectionKeyContainer).key < b.(*collectionKeyContainer).key
 }
 
+// setCol adds a collection. Its object versions continue from those of the
+// removed collections, so an IFVERSION made before a collection was removed
+// does not match an object of the new collection.
 func (s *Server) setCol(key string, col *collection.Collection) {
+	col.SetLastVersion(s.colver)
 	s.cols.Set(&collectionKeyContainer{key, col})
 }
 
@@ -731,11 +758,21 @@ func (s *Server) scanGreaterOrEqual(
 
 func (s *Server) deleteCol(key string) *collection.Collection {
 	if v := s.cols.Delete(&collectionKeyContainer{key: key}); v != nil {
-		return v.(*collectionKeyContainer).col
+		col := v.(*collectionKeyContainer).col
+		s.keepColVersion(col)
+		return col
 	}
 	return nil
 }
 
+// keepColVersion keeps the last object version of a collection that is being
+// removed.
+func (s *Server) keepColVersion(col *collection.Collection) {
+	if v := col.LastVersion(); v > s.colver {
+		s.colver = v
+	}
+}
+
 func isReservedFieldName(field string) bool {
 	switch field {
 	case "z", "lat", "lon":
@@ -822,9 +859,16 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 	}
 
 	cmd := msg.Command()
+	args := msg.Args
+	var failed bool
 	defer func() {
-		took := time.Since(start).Seconds()
-		cmdDurations.With(prometheus.Labels{"cmd": cmd}).Observe(took)
+		took := time.Since(start)
+		cmdDurations.With(prometheus.Labels{"cmd": cmd}).Observe(took.Seconds())
+		var key string
+		if len(msg.Args) > 1 {
+			key = msg.Args[1]
+		}
+		s.recordCommand(client, cmd, args, key, took, failed)
 	}()
 
 	// Ping. Just send back the response. No need to put through the pipeline.
@@ -847,6 +891,7 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 	}
 
 	writeErr := func(errMsg string) error {
+		failed = true
 		switch msg.OutputType {
 		case JSON:
 			return writeOutput(`{"ok":false,"err":` + jsonString(errMsg) + `,"elapsed":"` + time.Since(start).String() + "\"}")
@@ -893,6 +938,12 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		}
 	}
 
+	if msg.Command() == "explain" {
+		if err := rewriteExplainMsg(msg); err != nil {
+			return writeErr(err.Error())
+		}
+	}
+
 	var write bool
 
 	if (!client.authd || cmd == "auth") && cmd != "output" {
@@ -928,9 +979,10 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 	default:
 		s.mu.RLock()
 		defer s.mu.RUnlock()
-	case "set", "del", "drop", "fset", "flushdb",
+	case "set", "mset", "del", "drop", "fset", "flushdb",
 		"setchan", "pdelchan", "delchan",
-		"sethook", "pdelhook", "delhook",
+		"sethook", "pdelhook", "delhook", "hookpause", "hookresume",
+		"setminmove", "delminmove", "setlastversion",
 		"expire", "persist", "jset", "pdel", "rename", "renamenx":
 		// write operations
 		write = true
@@ -952,11 +1004,31 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		if s.config.readOnly() {
 			return writeErr("read only")
 		}
-	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks",
-		"chans", "search", "ttl", "bounds", "server", "info", "type", "jget",
+	case "get", "mget", "keys", "scan", "nearby", "within", "intersects",
+		"search", "ttl", "bounds", "server", "info", "type", "jget",
 		"evalro", "evalrosha", "healthz":
 		// read operations
 
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if s.config.followHost() != "" && !s.fcuponce {
+			return writeErr("catching up to leader")
+		}
+	case "hooks", "chans":
+		if hookSubcommand(msg.Args[1:]) == "import" {
+			// write operation, which writes its own SETHOOK commands to
+			// the aof.
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.config.followHost() != "" {
+				return writeErr("not the leader")
+			}
+			if s.config.readOnly() {
+				return writeErr("read only")
+			}
+			break
+		}
+		// read operations
 		s.mu.RLock()
 		defer s.mu.RUnlock()
 		if s.config.followHost() != "" && !s.fcuponce {
@@ -969,6 +1041,8 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		defer s.mu.Unlock()
 	case "output":
 		// this is local connection operation. Locks not needed.
+	case "slowlog":
+		// the slowlog has its own lock
 	case "echo":
 	case "massinsert":
 		// dev operation
@@ -1069,6 +1143,7 @@ func randomKey(n int) string {
 func (s *Server) reset() {
 	s.aofsz = 0
 	s.cols = btree.NewNonConcurrent(byCollectionKey)
+	s.colver = 0
 }
 
 func (s *Server) command(msg *Message, client *Client) (
@@ -1079,6 +1154,8 @@ func (s *Server) command(msg *Message, client *Client) (
 		err = fmt.Errorf("unknown command '%s'", msg.Args[0])
 	case "set":
 		res, d, err = s.cmdSet(msg)
+	case "mset":
+		res, d, err = s.cmdMset(msg)
 	case "fset":
 		res, d, err = s.cmdFset(msg)
 	case "del":
@@ -1089,6 +1166,8 @@ func (s *Server) command(msg *Message, client *Client) (
 		res, d, err = s.cmdDrop(msg)
 	case "flushdb":
 		res, d, err = s.cmdFlushDB(msg)
+	case "setlastversion":
+		res, d, err = s.cmdSetLastVersion(msg)
 	case "rename":
 		res, d, err = s.cmdRename(msg)
 	case "renamenx":
@@ -1101,6 +1180,8 @@ func (s *Server) command(msg *Message, client *Client) (
 		res, d, err = s.cmdPDelHook(msg)
 	case "hooks":
 		res, err = s.cmdHooks(msg)
+	case "hookpause", "hookresume":
+		res, d, err = s.cmdHookPause(msg)
 	case "setchan":
 		res, d, err = s.cmdSetHook(msg)
 	case "delchan":
@@ -1109,6 +1190,10 @@ func (s *Server) command(msg *Message, client *Client) (
 		res, d, err = s.cmdPDelHook(msg)
 	case "chans":
 		res, err = s.cmdHooks(msg)
+	case "setminmove":
+		res, d, err = s.cmdSetMinMove(msg)
+	case "delminmove":
+		res, d, err = s.cmdDelMinMove(msg)
 	case "expire":
 		res, d, err = s.cmdExpire(msg)
 	case "persist":
@@ -1147,6 +1232,8 @@ func (s *Server) command(msg *Message, client *Client) (
 		res, err = s.cmdHealthz(msg)
 	case "info":
 		res, err = s.cmdInfo(msg)
+	case "slowlog":
+		res, err = s.cmdSlowlog(msg)
 	case "scan":
 		res, err = s.cmdScan(msg)
 	case "nearby":
@@ -1161,6 +1248,8 @@ func (s *Server) command(msg *Message, client *Client) (
 		res, err = s.cmdBounds(msg)
 	case "get":
 		res, err = s.cmdGet(msg)
+	case "mget":
+		res, err = s.cmdMget(msg)
 	case "jget":
 		res, err = s.cmdJget(msg)
 	case "jset":
@@ -1247,9 +1336,14 @@ server to start accepting connections from the outside.
 
 // WriteWebSocketMessage write a websocket message to an io.Writer.
 func WriteWebSocketMessage(w io.Writer, data []byte) error {
+	return writeWebSocketFrame(w, wsOpText, data)
+}
+
+// writeWebSocketFrame writes a single unmasked frame with the FIN bit set.
+func writeWebSocketFrame(w io.Writer, opcode byte, data []byte) error {
 	var msg []byte
 	buf := make([]byte, 10+len(data))
-	buf[0] = 129 // FIN + TEXT
+	buf[0] = 0x80 | opcode // FIN + opcode
 	if len(data) <= 125 {
 		buf[1] = byte(len(data))
 		copy(buf[2:], data)
@@ -1307,6 +1401,8 @@ type Message struct {
 	OutputType Type
 	Auth       string
 	Deadline   *deadline.Deadline
+	stream     *streamRequest
+	explain    bool // the message is a search wrapped by EXPLAIN
 }
 
 // Command returns the first argument as a lowercase string
@@ -1317,6 +1413,12 @@ func (msg *Message) Command() string {
 	return msg._command
 }
 
+// fromAOF returns true when the command is loaded from the aof or sent by a
+// leader, rather than by a client or a script.
+func (msg *Message) fromAOF() bool {
+	return msg.ConnType == Null && msg.OutputType == Null
+}
+
 // PipelineReader ...
 type PipelineReader struct {
 	rd     io.Reader
@@ -1374,6 +1476,13 @@ func readNextHTTPCommand(packet []byte, argsIn [][]byte, msg *Message, wr io.Wri
 		if len(path) == 0 || path[0] != '/' {
 			return false, errInvalidHTTP
 		}
+		var stream *streamRequest
+		if strings.HasPrefix(path, "/subscribe/") {
+			stream, err = parseStreamPath(path[len("/subscribe/"):])
+			if err != nil || method != "GET" {
+				return false, errInvalidHTTP
+			}
+		}
 		path, err = url.QueryUnescape(path[1:])
 		if err != nil {
 			return false, errInvalidHTTP
@@ -1405,6 +1514,14 @@ func readNextHTTPCommand(packet []byte, argsIn [][]byte, msg *Message, wr io.Wri
 				} else if strings.HasPrefix(strings.ToLower(header), "sec-websocket-key:") {
 					websocketKey = strings.TrimSpace(header[len("sec-websocket-key:"):])
 				}
+			} else if header[0] == 'o' || header[0] == 'O' {
+				if stream != nil && strings.HasPrefix(strings.ToLower(header), "origin:") {
+					stream.origin = strings.TrimSpace(header[len("origin:"):])
+				}
+			} else if header[0] == 'l' || header[0] == 'L' {
+				if stream != nil && strings.HasPrefix(strings.ToLower(header), "last-event-id:") {
+					stream.lastEventID = strings.TrimSpace(header[len("last-event-id:"):])
+				}
 			} else if header[0] == 'c' || header[0] == 'C' {
 				if strings.HasPrefix(strings.ToLower(header), "content-length:") {
 					var n uint64
@@ -1435,6 +1552,14 @@ func readNextHTTPCommand(packet []byte, argsIn [][]byte, msg *Message, wr io.Wri
 			path += string(packet[:contentLength])
 			packet = packet[contentLength:]
 		}
+		if stream != nil {
+			if msg.Auth == "" {
+				msg.Auth = stream.token
+			}
+			msg.Args = append([]string{"subscribe"}, stream.channels...)
+			msg.stream = stream
+			return true, nil
+		}
 		if path == "" {
 			return true, nil
 		}
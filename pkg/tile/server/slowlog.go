@@ -0,0 +1,402 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/space/pkg/core"
+	"github.com/bhojpur/space/pkg/utils/resp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	slowlogMaxArgs   = 32  // maximum number of arguments kept per entry
+	slowlogMaxArgLen = 128 // maximum length of each argument kept
+	slowlogDefaultN  = 10  // entries returned by SLOWLOG GET without count
+	latencyBuckets   = 24  // power-of-two microsecond buckets, 1us to ~8s
+	slowlogRedacted  = "(redacted)"
+	unknownCommand   = "unknown" // stats bucket for unrecognized commands
+)
+
+// knownCommands are the commands documented in core.Commands along with
+// those handled by the server that are not documented there.
+var knownCommands = func() map[string]bool {
+	known := map[string]bool{
+		"client": true, "echo": true, "healthz": true, "info": true,
+		"massinsert": true, "monitor": true, "output": true, "publish": true,
+		"replconf": true, "shutdown": true, "slaveof": true, "sleep": true,
+		"type": true,
+	}
+	for name := range core.Commands {
+		known[strings.ToLower(strings.Fields(name)[0])] = true
+	}
+	return known
+}()
+
+// statsCommand returns the name that the metrics of cmd are recorded under.
+// Unrecognized commands share a single name, which keeps clients from
+// growing the stats without bound.
+func statsCommand(cmd string) string {
+	if knownCommands[cmd] {
+		return cmd
+	}
+	return unknownCommand
+}
+
+// slowlogEntry is a single command that took at least the
+// slowlog-log-slower-than threshold to execute.
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+}
+
+// slowlog is a bounded list of the most recent slow commands.
+type slowlog struct {
+	mu      sync.Mutex
+	entries []slowlogEntry // oldest first
+	nextID  int64
+}
+
+func newSlowlog() *slowlog {
+	return &slowlog{}
+}
+
+// redactFrom returns the index of the first argument that holds a password,
+// as in AUTH and CONFIG SET requirepass, or len(args) when there is none.
+func redactFrom(args []string) int {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "auth":
+			return 1
+		case "config":
+			if len(args) < 3 {
+				break
+			}
+			// the server rewrites the subcommand to "CONFIG SET"
+			sub := strings.TrimPrefix(strings.ToLower(args[1]), "config ")
+			switch strings.ToLower(args[2]) {
+			case RequirePass, LeaderAuth:
+				if sub == "set" {
+					return 3
+				}
+			}
+		}
+	}
+	return len(args)
+}
+
+// slowlogArgs returns a copy of args trimmed in the same way as Redis, which
+// keeps the log from holding on to large values. Passwords are redacted.
+func slowlogArgs(args []string) []string {
+	redact := redactFrom(args)
+	n := len(args)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs - 1
+	}
+	trimmed := make([]string, 0, n+1)
+	for i, arg := range args[:n] {
+		if i >= redact {
+			arg = slowlogRedacted
+		} else if len(arg) > slowlogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)",
+				arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		trimmed = append(trimmed, arg)
+	}
+	if n < len(args) {
+		trimmed = append(trimmed,
+			fmt.Sprintf("... (%d more arguments)", len(args)-n))
+	}
+	return trimmed
+}
+
+// add appends an entry, assigning it the next id, and drops the oldest
+// entries that no longer fit in maxlen.
+func (sl *slowlog) add(entry slowlogEntry, maxlen int) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	entry.id = sl.nextID
+	sl.nextID++
+	sl.entries = append(sl.entries, entry)
+	if over := len(sl.entries) - maxlen; over > 0 {
+		sl.entries = append(sl.entries[:0], sl.entries[over:]...)
+	}
+}
+
+// get returns up to n entries, newest first. A negative n returns them all.
+func (sl *slowlog) get(n int) []slowlogEntry {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if n < 0 || n > len(sl.entries) {
+		n = len(sl.entries)
+	}
+	entries := make([]slowlogEntry, 0, n)
+	for i := len(sl.entries) - 1; len(entries) < n; i-- {
+		entries = append(entries, sl.entries[i])
+	}
+	return entries
+}
+
+func (sl *slowlog) len() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return len(sl.entries)
+}
+
+func (sl *slowlog) reset() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.entries = nil
+}
+
+// cmdStat holds the counters and latency histogram for one command.
+type cmdStat struct {
+	calls        uint64
+	failed       uint64
+	slow         uint64
+	usec         uint64
+	buckets      [latencyBuckets]uint64
+	lastSlowKey  string
+	lastSlowAddr string
+}
+
+// latencyBucket returns the histogram bucket for a duration. Bucket i holds
+// the calls that took at most 1<<i microseconds.
+func latencyBucket(usec int64) int {
+	if usec <= 1 {
+		return 0
+	}
+	i := bits.Len64(uint64(usec - 1))
+	if i >= latencyBuckets {
+		i = latencyBuckets - 1
+	}
+	return i
+}
+
+// percentile estimates the latency at p (0-100) in microseconds, using the
+// upper bound of the bucket that contains it.
+func (st *cmdStat) percentile(p float64) int64 {
+	if st.calls == 0 {
+		return 0
+	}
+	rank := uint64(float64(st.calls)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range st.buckets {
+		seen += n
+		if seen >= rank {
+			return 1 << i
+		}
+	}
+	return 1 << (latencyBuckets - 1)
+}
+
+// commandStats tracks per-command call counts and latencies for
+// INFO commandstats.
+type commandStats struct {
+	mu sync.Mutex
+	m  map[string]*cmdStat
+}
+
+func newCommandStats() *commandStats {
+	return &commandStats{m: make(map[string]*cmdStat)}
+}
+
+func (cs *commandStats) record(cmd string, took time.Duration, failed, slow bool,
+	key, addr string,
+) {
+	usec := took.Microseconds()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	st := cs.m[cmd]
+	if st == nil {
+		st = &cmdStat{}
+		cs.m[cmd] = st
+	}
+	st.calls++
+	st.usec += uint64(usec)
+	st.buckets[latencyBucket(usec)]++
+	if failed {
+		st.failed++
+	}
+	if slow {
+		st.slow++
+		st.lastSlowKey = key
+		st.lastSlowAddr = addr
+	}
+}
+
+// writeInfo writes one cmdstat line per command, sorted by name.
+func (cs *commandStats) writeInfo(w *bytes.Buffer) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cmds := make([]string, 0, len(cs.m))
+	for cmd := range cs.m {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+	for _, cmd := range cmds {
+		st := cs.m[cmd]
+		fmt.Fprintf(w, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,"+
+			"failed_calls=%d,slow_calls=%d,p50=%d,p99=%d,p99.9=%d",
+			strings.ReplaceAll(cmd, " ", "|"), st.calls, st.usec,
+			float64(st.usec)/float64(st.calls), st.failed, st.slow,
+			st.percentile(50), st.percentile(99), st.percentile(99.9))
+		if st.slow > 0 {
+			fmt.Fprintf(w, ",last_slow_key=%s,last_slow_client=%s",
+				st.lastSlowKey, st.lastSlowAddr)
+		}
+		w.WriteString("\r\n")
+	}
+}
+
+// recordCommand updates the command metrics after a command completes and
+// adds it to the slowlog when it reached the configured threshold.
+func (s *Server) recordCommand(client *Client, cmd string, args []string,
+	key string, took time.Duration, failed bool,
+) {
+	cmd = statsCommand(cmd)
+	if redactFrom(args) <= 1 {
+		key = slowlogRedacted
+	}
+	cmdLatency.With(prometheus.Labels{"cmd": cmd}).Observe(took.Seconds())
+	var slow bool
+	switch cmd {
+	case "subscribe", "psubscribe", "monitor":
+		// blocking commands stay open for the life of the connection
+	default:
+		slower := s.config.slowlogSlower()
+		slow = slower >= 0 && took.Microseconds() >= slower
+	}
+	if slow {
+		cmdSlow.With(prometheus.Labels{"cmd": cmd}).Inc()
+		client.mu.Lock()
+		name := client.name
+		client.mu.Unlock()
+		s.slowlog.add(slowlogEntry{
+			time:     time.Now(),
+			duration: took,
+			args:     slowlogArgs(args),
+			addr:     client.remoteAddr,
+			name:     name,
+		}, s.config.slowlogMaxLen())
+	}
+	s.cmdstats.record(cmd, took, failed, slow, key, client.remoteAddr)
+}
+
+func (s *Server) cmdSlowlog(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	if len(msg.Args) == 1 {
+		return NOMessage, errInvalidNumberOfArguments
+	}
+	switch strings.ToLower(msg.Args[1]) {
+	default:
+		return NOMessage, clientErrorf(
+			"Syntax error, try SLOWLOG (GET [count] | LEN | RESET)",
+		)
+	case "get":
+		n := slowlogDefaultN
+		switch len(msg.Args) {
+		default:
+			return NOMessage, errInvalidNumberOfArguments
+		case 2:
+		case 3:
+			v, err := strconv.ParseInt(msg.Args[2], 10, 64)
+			if err != nil || v < -1 {
+				return NOMessage, errInvalidArgument(msg.Args[2])
+			}
+			n = int(v)
+		}
+		entries := s.slowlog.get(n)
+		switch msg.OutputType {
+		case JSON:
+			list := make([]map[string]interface{}, 0, len(entries))
+			for _, e := range entries {
+				list = append(list, map[string]interface{}{
+					"id":       e.id,
+					"time":     e.time.Unix(),
+					"duration": e.duration.Microseconds(),
+					"args":     e.args,
+					"addr":     e.addr,
+					"name":     e.name,
+				})
+			}
+			data, err := json.Marshal(list)
+			if err != nil {
+				return NOMessage, err
+			}
+			return resp.StringValue(`{"ok":true,"slowlog":` + string(data) +
+				`,"elapsed":"` + time.Since(start).String() + "\"}"), nil
+		case RESP:
+			vals := make([]resp.Value, 0, len(entries))
+			for _, e := range entries {
+				args := make([]resp.Value, len(e.args))
+				for i, arg := range e.args {
+					args[i] = resp.StringValue(arg)
+				}
+				vals = append(vals, resp.ArrayValue([]resp.Value{
+					resp.IntegerValue(int(e.id)),
+					resp.IntegerValue(int(e.time.Unix())),
+					resp.IntegerValue(int(e.duration.Microseconds())),
+					resp.ArrayValue(args),
+					resp.StringValue(e.addr),
+					resp.StringValue(e.name),
+				}))
+			}
+			return resp.ArrayValue(vals), nil
+		}
+	case "len":
+		if len(msg.Args) != 2 {
+			return NOMessage, errInvalidNumberOfArguments
+		}
+		n := s.slowlog.len()
+		switch msg.OutputType {
+		case JSON:
+			return resp.StringValue(`{"ok":true,"len":` + strconv.Itoa(n) +
+				`,"elapsed":"` + time.Since(start).String() + "\"}"), nil
+		case RESP:
+			return resp.IntegerValue(n), nil
+		}
+	case "reset":
+		if len(msg.Args) != 2 {
+			return NOMessage, errInvalidNumberOfArguments
+		}
+		s.slowlog.reset()
+		return OKMessage(msg, start), nil
+	}
+	return NOMessage, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowlog(t *testing.T) {
+	sl := newSlowlog()
+	for i := 0; i < 5; i++ {
+		sl.add(slowlogEntry{args: []string{"get", strconv.Itoa(i)}}, 3)
+	}
+	if n := sl.len(); n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+	entries := sl.get(-1)
+	for i, e := range entries {
+		if e.id != int64(4-i) || e.args[1] != strconv.Itoa(4-i) {
+			t.Fatalf("entry %d: expected id %d, got %d %v", i, 4-i, e.id, e.args)
+		}
+	}
+	if entries := sl.get(2); len(entries) != 2 || entries[0].id != 4 {
+		t.Fatalf("expected the two newest entries, got %v", entries)
+	}
+	sl.reset()
+	if n := sl.len(); n != 0 {
+		t.Fatalf("expected 0 entries after reset, got %d", n)
+	}
+	sl.add(slowlogEntry{}, 3)
+	if entries := sl.get(-1); entries[0].id != 5 {
+		t.Fatalf("expected ids to continue after reset, got %d", entries[0].id)
+	}
+}
+
+func TestSlowlogArgs(t *testing.T) {
+	args := make([]string, 40)
+	args[0] = strings.Repeat("x", 200)
+	trimmed := slowlogArgs(args)
+	if len(trimmed) != slowlogMaxArgs {
+		t.Fatalf("expected %d args, got %d", slowlogMaxArgs, len(trimmed))
+	}
+	if exp := strings.Repeat("x", 128) + "... (72 more bytes)"; trimmed[0] != exp {
+		t.Fatalf("expected %q, got %q", exp, trimmed[0])
+	}
+	if exp := "... (9 more arguments)"; trimmed[len(trimmed)-1] != exp {
+		t.Fatalf("expected %q, got %q", exp, trimmed[len(trimmed)-1])
+	}
+	if trimmed := slowlogArgs([]string{"ping"}); len(trimmed) != 1 {
+		t.Fatalf("expected 1 arg, got %v", trimmed)
+	}
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"AUTH", "secret"}, "AUTH (redacted)"},
+		{[]string{"config", "SET", "RequirePass", "secret"},
+			"config SET RequirePass (redacted)"},
+		{[]string{"CONFIG", "set", "leaderauth", "secret"},
+			"CONFIG set leaderauth (redacted)"},
+		{[]string{"CONFIG", "CONFIG SET", "requirepass", "secret"},
+			"CONFIG CONFIG SET requirepass (redacted)"},
+		{[]string{"CONFIG"}, "CONFIG"},
+		{[]string{"CONFIG", "SET", "maxmemory", "1gb"},
+			"CONFIG SET maxmemory 1gb"},
+		{[]string{"CONFIG", "GET", "requirepass"}, "CONFIG GET requirepass"},
+	} {
+		if res := strings.Join(slowlogArgs(tc.args), " "); res != tc.exp {
+			t.Fatalf("expected %q, got %q", tc.exp, res)
+		}
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	for cmd, exp := range map[string]string{
+		"get":     "get",
+		"info":    "info",
+		"auth":    "auth",
+		"config":  "config",
+		"nosuch":  unknownCommand,
+		"nosuch2": unknownCommand,
+	} {
+		if res := statsCommand(cmd); res != exp {
+			t.Fatalf("%s: expected %q, got %q", cmd, exp, res)
+		}
+	}
+}
+
+func TestCommandStats(t *testing.T) {
+	cs := newCommandStats()
+	for i := 0; i < 98; i++ {
+		cs.record("get", 3*time.Microsecond, false, false, "", "")
+	}
+	cs.record("get", 100*time.Microsecond, true, false, "", "")
+	cs.record("get", 20*time.Millisecond, false, true, "fleet", "10.0.0.1:5000")
+	st := cs.m["get"]
+	if p := st.percentile(50); p != 4 {
+		t.Fatalf("expected p50 of 4, got %d", p)
+	}
+	if p := st.percentile(99); p != 128 {
+		t.Fatalf("expected p99 of 128, got %d", p)
+	}
+	if p := st.percentile(99.9); p != 32768 {
+		t.Fatalf("expected p99.9 of 32768, got %d", p)
+	}
+	var w bytes.Buffer
+	cs.writeInfo(&w)
+	exp := "cmdstat_get:calls=100,usec=20394,usec_per_call=203.94," +
+		"failed_calls=1,slow_calls=1,p50=4,p99=128,p99.9=32768," +
+		"last_slow_key=fleet,last_slow_client=10.0.0.1:5000\r\n"
+	if w.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, w.String())
+	}
+}
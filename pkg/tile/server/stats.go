@@ -86,6 +86,11 @@ func (s *Server) cmdStats(msg *Message) (res resp.Value, err error) {
 			m["in_memory_size"] = col.TotalWeight()
 			m["num_objects"] = col.Count()
 			m["num_strings"] = col.StringCount()
+			s.qcache.stats(key, m)
+			if mm, ok := s.minmoves[key]; ok {
+				m["min_move"] = mm.meters
+				m["min_age"] = mm.age.Seconds()
+			}
 			switch msg.OutputType {
 			case JSON:
 				ms = append(ms, m)
@@ -198,6 +203,7 @@ func (s *Server) basicStats(m map[string]interface{}) {
 	m["num_points"] = points
 	m["num_objects"] = objects
 	m["num_strings"] = strings
+	s.qcache.stats("", m)
 	mem := readMemStats()
 	avgsz := 0
 	if points != 0 {
@@ -496,6 +502,9 @@ func (s *Server) cmdInfo(msg *Message) (res resp.Value, err error) {
 		case "cpu":
 			w.WriteString("# CPU\r\n")
 			s.writeInfoCPU(w)
+		case "commandstats":
+			w.WriteString("# Commandstats\r\n")
+			s.cmdstats.writeInfo(w)
 		case "cluster":
 			w.WriteString("# Cluster\r\n")
 			s.writeInfoCluster(w)
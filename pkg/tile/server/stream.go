@@ -0,0 +1,498 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/space/pkg/tile/log"
+	"github.com/bhojpur/space/pkg/utils/gjson"
+)
+
+// streamHeartbeat is how often an idle stream is sent a heartbeat so that
+// proxies and clients can tell a quiet channel from a dead connection.
+const streamHeartbeat = 15 * time.Second
+
+// maxWebSocketFrame limits the size of frames accepted from stream clients.
+const maxWebSocketFrame = 1 << 20
+
+// streamRequest is a "GET /subscribe/{channels}" request that is delivered
+// as Server-Sent Events, or as JSON frames when upgraded to a WebSocket.
+type streamRequest struct {
+	channels    []string
+	lastEventID string
+	token       string
+	origin      string // Origin header of the request
+}
+
+// parseStreamPath parses the part of a request path that follows
+// "/subscribe/". Channels are separated by commas and the query may carry
+// the auth token and last event id for clients that cannot set headers.
+func parseStreamPath(path string) (*streamRequest, error) {
+	var query string
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path, query = path[:i], path[i+1:]
+	}
+	stream := new(streamRequest)
+	for _, part := range strings.Split(path, ",") {
+		channel, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, err
+		}
+		if channel != "" {
+			stream.channels = append(stream.channels, channel)
+		}
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	stream.token = values.Get("token")
+	stream.lastEventID = values.Get("last_event_id")
+	if stream.lastEventID == "" {
+		stream.lastEventID = values.Get("lastEventId")
+	}
+	return stream, nil
+}
+
+// parseLastEventID returns the first message id to replay after the last
+// event id of a stream, which may also be a time like the FROM argument of
+// SUBSCRIBE.
+func parseLastEventID(lastEventID string) (int64, error) {
+	from, err := parseChanHistoryFrom(lastEventID)
+	if err != nil {
+		return 0, errInvalidEventID
+	}
+	return from, nil
+}
+
+// isChannelPattern returns true when a channel name should be subscribed
+// as a pattern.
+func isChannelPattern(channel string) bool {
+	return strings.ContainsAny(channel, "*?[")
+}
+
+// streamFrame is a JSON frame sent by a WebSocket stream client.
+type streamFrame struct {
+	Type        string   `json:"type"`
+	Channels    []string `json:"channels"`
+	LastEventID string   `json:"last_event_id"`
+}
+
+func (s *Server) liveStream(
+	conn net.Conn,
+	rd *PipelineReader,
+	msg *Message,
+	websocket bool,
+) error {
+	defer conn.Close() // close connection when we are done
+
+	stream := msg.stream
+	if stream.lastEventID != "" {
+		if _, err := parseLastEventID(stream.lastEventID); err != nil {
+			if websocket {
+				return WriteWebSocketMessage(conn, []byte(
+					`{"type":"error","err":`+jsonString(err.Error())+`}`))
+			}
+			body := `{"ok":false,"err":` + jsonString(err.Error()) + "}"
+			_, err := io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n"+
+				"Connection: close\r\n"+
+				"Content-Length: "+strconv.Itoa(len(body))+"\r\n"+
+				"Content-Type: application/json; charset=utf-8\r\n"+
+				"\r\n"+body)
+			return err
+		}
+	}
+
+	var writeLock sync.Mutex
+	write := func(data []byte) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		if websocket {
+			return WriteWebSocketMessage(conn, data)
+		}
+		_, err := conn.Write(data)
+		return err
+	}
+	if !websocket {
+		head := "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: text/event-stream\r\n" +
+			"Cache-Control: no-cache\r\n" +
+			"Connection: keep-alive\r\n"
+		if origin := s.config.streamOrigin(stream.origin); origin != "" {
+			head += "Access-Control-Allow-Origin: " + origin + "\r\n" +
+				"Vary: Origin\r\n"
+		}
+		if err := write([]byte(head + "\r\n")); err != nil {
+			return err
+		}
+	}
+	writeEvent := func(msg submsg) error {
+		id := strconv.FormatInt(msg.id, 10)
+		var b []byte
+		if websocket {
+			b = append(b, `{"type":"message","id":`...)
+			b = appendJSONString(b, id)
+			b = append(b, `,"channel":`...)
+			b = appendJSONString(b, msg.channel)
+			if msg.kind == pubsubPattern {
+				b = append(b, `,"pattern":`...)
+				b = appendJSONString(b, msg.pattern)
+			}
+			b = append(b, `,"message":`...)
+			if gjson.Valid(msg.message) {
+				b = append(b, msg.message...)
+			} else {
+				b = appendJSONString(b, msg.message)
+			}
+			b = append(b, '}')
+		} else {
+			b = append(b, "id: "...)
+			b = append(b, id...)
+			b = append(b, '\n')
+			for _, line := range strings.Split(msg.message, "\n") {
+				b = append(b, "data: "...)
+				b = append(b, line...)
+				b = append(b, '\n')
+			}
+			b = append(b, '\n')
+		}
+		s.statsTotalMsgsSent.add(1)
+		return write(b)
+	}
+
+	m := [2]map[string]bool{
+		make(map[string]bool), // pubsubChannel
+		make(map[string]bool), // pubsubPattern
+	}
+	// floors holds, per subscription, the newest message id that was
+	// covered by a replay. Live copies of those messages are dropped.
+	floors := [2]map[string]int64{
+		make(map[string]int64),
+		make(map[string]int64),
+	}
+
+	target := newSubtarget()
+
+	defer func() {
+		for i := 0; i < 2; i++ {
+			for channel := range m[i] {
+				s.pubsub.unregister(i, channel, target)
+				s.pubsub.replay.unwatch(i, channel)
+			}
+		}
+		target.cond.L.Lock()
+		target.closed = true
+		target.cond.Broadcast()
+		target.cond.L.Unlock()
+	}()
+
+	// resume registers a subscription and queues the messages that were
+	// published after the last event id, from the channel HISTORY when the
+	// channel has one, or else from the replay buffer.
+	resume := func(kind int, channel, lastEventID string) error {
+		if lastEventID == "" {
+			s.pubsub.register(kind, channel, target)
+			return nil
+		}
+		from, err := parseLastEventID(lastEventID)
+		if err != nil {
+			return err
+		}
+		s.mu.RLock()
+		history := kind == pubsubChannel && s.hasChanHistory(channel)
+		s.mu.RUnlock()
+		if history {
+			return s.subscribeFrom(channel, from, target)
+		}
+		s.pubsub.register(kind, channel, target)
+		if s.config.streamReplaySize() == 0 {
+			return nil
+		}
+		msgs, floor := s.pubsub.replay.since(kind, channel, from)
+		target.cond.L.Lock()
+		floors[kind][channel] = floor
+		target.msgs = append(target.msgs, msgs...)
+		target.cond.Broadcast()
+		target.cond.L.Unlock()
+		return nil
+	}
+
+	subscribe := func(channels []string, lastEventID string, un bool) error {
+		for _, channel := range channels {
+			kind := pubsubChannel
+			if isChannelPattern(channel) {
+				kind = pubsubPattern
+			}
+			if un {
+				if m[kind][channel] {
+					s.pubsub.replay.unwatch(kind, channel)
+				}
+				delete(m[kind], channel)
+				s.pubsub.unregister(kind, channel, target)
+				target.cond.L.Lock()
+				delete(floors[kind], channel)
+				target.cond.L.Unlock()
+			} else {
+				if !m[kind][channel] {
+					s.pubsub.replay.watch(kind, channel)
+				}
+				m[kind][channel] = true
+				if err := resume(kind, channel, lastEventID); err != nil {
+					return err
+				}
+			}
+			if websocket {
+				command := "subscribe"
+				if un {
+					command = "unsubscribe"
+				}
+				field := `,"channel":`
+				if kind == pubsubPattern {
+					command = "p" + command
+					field = `,"pattern":`
+				}
+				if err := write([]byte(`{"type":` + jsonString(command) +
+					field + jsonString(channel) +
+					`,"num":` + strconv.Itoa(len(m[0])+len(m[1])) +
+					`}`)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	go func() {
+		log.Debugf("stream open")
+		defer log.Debugf("stream closed")
+		for {
+			var msgs []submsg
+			target.cond.L.Lock()
+			for _, msg := range target.msgs {
+				name := msg.channel
+				if msg.kind == pubsubPattern {
+					name = msg.pattern
+				}
+				if !msg.replayed && msg.id <= floors[msg.kind][name] {
+					continue
+				}
+				msgs = append(msgs, msg)
+			}
+			target.msgs = nil
+			target.cond.L.Unlock()
+			for _, msg := range msgs {
+				if err := writeEvent(msg); err != nil {
+					conn.Close()
+					return
+				}
+			}
+			target.cond.L.Lock()
+			if target.closed {
+				target.cond.L.Unlock()
+				return
+			}
+			target.cond.Wait()
+			target.cond.L.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				var err error
+				if websocket {
+					err = write([]byte(`{"type":"heartbeat","time":` +
+						jsonString(now.Format(time.RFC3339Nano)) + `}`))
+				} else {
+					err = write([]byte(": heartbeat\n\n"))
+				}
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := subscribe(stream.channels, stream.lastEventID, false); err != nil {
+		return err
+	}
+
+	// the request has been consumed, anything else on the connection belongs
+	// to the client side of the stream.
+	br := bufio.NewReader(io.MultiReader(bytes.NewReader(rd.buf), rd.rd))
+	if !websocket {
+		// Server-Sent Events are one way. Read until the client goes away.
+		io.Copy(io.Discard, br)
+		return nil
+	}
+	for {
+		opcode, payload, err := readWebSocketMessage(br, conn, &writeLock)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if opcode == wsOpClose {
+			writeLock.Lock()
+			writeWebSocketFrame(conn, wsOpClose, nil)
+			writeLock.Unlock()
+			return nil
+		}
+		var frame streamFrame
+		if err := json.Unmarshal(payload, &frame); err != nil {
+			frame.Type = ""
+		}
+		switch frame.Type {
+		case "subscribe", "unsubscribe":
+			err = subscribe(frame.Channels, frame.LastEventID,
+				frame.Type == "unsubscribe")
+		case "ping":
+			err = write([]byte(`{"type":"pong"}`))
+		default:
+			err = errors.New("invalid frame")
+		}
+		if err != nil {
+			if err := write([]byte(`{"type":"error","err":` +
+				jsonString(err.Error()) + `}`)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WebSocket opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+var errWebSocketFrameTooLarge = errors.New("websocket frame too large")
+
+// readWebSocketFrame reads a single, possibly masked, frame.
+func readWebSocketFrame(rd *bufio.Reader) (
+	fin bool, opcode byte, payload []byte, err error,
+) {
+	var head [2]byte
+	if _, err = io.ReadFull(rd, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(rd, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(rd, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxWebSocketFrame {
+		err = errWebSocketFrameTooLarge
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(rd, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(rd, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// readWebSocketMessage reads the next data message, joining fragments and
+// answering pings along the way. A close frame is returned as is.
+func readWebSocketMessage(rd *bufio.Reader, w io.Writer, mu *sync.Mutex) (
+	opcode byte, payload []byte, err error,
+) {
+	for {
+		fin, op, data, err := readWebSocketFrame(rd)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsOpClose:
+			return op, data, nil
+		case wsOpPing:
+			mu.Lock()
+			err = writeWebSocketFrame(w, wsOpPong, data)
+			mu.Unlock()
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpText, wsOpBinary:
+			opcode = op
+			payload = data
+		case wsOpContinuation:
+			payload = append(payload, data...)
+		}
+		if len(payload) > maxWebSocketFrame {
+			return 0, nil, errWebSocketFrameTooLarge
+		}
+		if fin {
+			return opcode, payload, nil
+		}
+	}
+}
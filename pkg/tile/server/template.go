@@ -0,0 +1,112 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bhojpur/space/pkg/utils/gjson"
+)
+
+// hookTemplate reshapes the outgoing message of a hook or channel. The
+// source is either a Go text/template, when it contains "{{", or a gjson
+// multipath mapping such as `{"event":detect,"vehicle":id}`.
+//
+// Templates are evaluated against the decoded fence message, which
+// exposes command, group, detect, hook, key, id, time, object, fields,
+// meta, for roaming fences, nearby and faraway and, for route fences, route.
+type hookTemplate struct {
+	src  string
+	tmpl *template.Template // nil for gjson mappings
+}
+
+var hookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"unix": func(v interface{}) (int64, error) {
+		t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v))
+		return t.Unix(), err
+	},
+	"unixms": func(v interface{}) (int64, error) {
+		t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v))
+		return t.UnixNano() / int64(time.Millisecond), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// hookTemplateSample is used to check that a template can be rendered
+// before it's assigned to a hook.
+const hookTemplateSample = `{"command":"set","group":"5c5b1e7e32c0a3c2b8f2f9a1",` +
+	`"detect":"enter","hook":"sample","key":"fleet",` +
+	`"time":"2018-01-01T00:00:00Z","id":"truck1",` +
+	`"object":{"type":"Point","coordinates":[-112.2693,33.5123]},` +
+	`"fields":{"speed":0},"meta":{"sample":"1"}}`
+
+// parseHookTemplate compiles and validates a template source.
+func parseHookTemplate(src string) (*hookTemplate, error) {
+	t := &hookTemplate{src: src}
+	if strings.Contains(src, "{{") {
+		tmpl, err := template.New("hook").Funcs(hookTemplateFuncs).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v", err)
+		}
+		t.tmpl = tmpl
+	} else {
+		src = strings.TrimSpace(src)
+		if src == "" || (src[0] != '{' && src[0] != '[') {
+			return nil, errors.New("invalid template: expected a mapping")
+		}
+	}
+	if _, err := t.render(hookTemplateSample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// render applies the template to a fence message.
+func (t *hookTemplate) render(msg string) (string, error) {
+	if t.tmpl == nil {
+		res := gjson.Get(msg, t.src)
+		if !res.Exists() || !gjson.Valid(res.Raw) {
+			return "", errors.New("invalid template: mapping did not " +
+				"produce valid json")
+		}
+		return res.Raw, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &data); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid template: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,51 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "testing"
+
+func TestHookTemplate(t *testing.T) {
+	test := func(src, expect string) {
+		t.Helper()
+		tmpl, err := parseHookTemplate(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := tmpl.render(hookTemplateSample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != expect {
+			t.Fatalf("expected '%s', got '%s'", expect, res)
+		}
+	}
+	test(`{"event":detect,"vehicle":id,"pos":object.coordinates}`,
+		`{"event":"enter","vehicle":"truck1","pos":[-112.2693,33.5123]}`)
+	test(`{{.id}} {{upper .detect}} {{.meta.sample}} {{unix .time}}`,
+		`truck1 ENTER 1 1514764800`)
+	test(`{"geo":{{json .object}}}`,
+		`{"geo":{"coordinates":[-112.2693,33.5123],"type":"Point"}}`)
+	for _, src := range []string{"detect", "{{.id", "{{nofunc .id}}"} {
+		if _, err := parseHookTemplate(src); err == nil {
+			t.Fatalf("expected an error for '%s'", src)
+		}
+	}
+}
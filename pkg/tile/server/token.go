@@ -27,6 +27,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/bhojpur/space/pkg/tile/filter"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -36,6 +37,8 @@ var errInvalidNumberOfArguments = errors.New("invalid number of arguments")
 var errKeyNotFound = errors.New("key not found")
 var errIDNotFound = errors.New("id not found")
 var errIDAlreadyExists = errors.New("id already exists")
+var errVersionMismatch = errors.New("version mismatch")
+var errConditionNotMet = errors.New("condition not met")
 var errPathNotFound = errors.New("path not found")
 var errKeyHasHooksSet = errors.New("key has hooks set")
 var errNotRectangle = errors.New("not a rectangle")
@@ -137,6 +140,41 @@ func (where whereT) match(value float64) bool {
 	return true
 }
 
+// whenT is a WHEN condition of a DETECT fieldchange fence. It is met when
+// the condition is false for the old field value and true for the new one.
+type whenT struct {
+	field string
+	op    string // "<", "<=", ">", ">=", "==", "!=" or "changed"
+	value float64
+}
+
+func (when whenT) test(value float64) bool {
+	switch when.op {
+	case "<":
+		return value < when.value
+	case "<=":
+		return value <= when.value
+	case ">":
+		return value > when.value
+	case ">=":
+		return value >= when.value
+	case "==":
+		return value == when.value
+	case "!=":
+		return value != when.value
+	}
+	return false
+}
+
+// met returns true if the condition was met by a change of the field value.
+// The old value is not set for new objects.
+func (when whenT) met(old float64, hasOld bool, value float64) bool {
+	if when.op == "changed" {
+		return hasOld && old != value
+	}
+	return (!hasOld || !when.test(old)) && when.test(value)
+}
+
 type whereinT struct {
 	field  string
 	index  int
@@ -224,7 +262,12 @@ type searchScanBaseTokens struct {
 	wheres     []whereT
 	whereins   []whereinT
 	whereevals []whereevalT
+	filter     *filter.Expr
+	orderBy    []orderByT
+	fields     []string
 	nofields   bool
+	nogeometry bool
+	profile    bool
 	ulimit     bool
 	limit      uint64
 	usparse    bool
@@ -233,6 +276,11 @@ type searchScanBaseTokens struct {
 	clip       bool
 	buffer     float64
 	hasbuffer  bool
+	mincount   uint64
+	hasmin     bool
+	maxcount   uint64
+	hasmax     bool
+	whens      []whenT
 }
 
 func (s *Server) parseSearchScanBaseTokens(
@@ -272,6 +320,53 @@ func (s *Server) parseSearchScanBaseTokens(
 				t.buffer = buf
 				t.hasbuffer = true
 				continue
+			case "when":
+				vs = nvs
+				var when whenT
+				if vs, when.field, ok = tokenval(vs); !ok || when.field == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, when.op, ok = tokenval(vs); !ok || when.op == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				switch when.op = strings.ToLower(when.op); when.op {
+				default:
+					err = errInvalidArgument(when.op)
+					return
+				case "changed":
+				case "<", "<=", ">", ">=", "==", "!=":
+					var svalue string
+					if vs, svalue, ok = tokenval(vs); !ok || svalue == "" {
+						err = errInvalidNumberOfArguments
+						return
+					}
+					if when.value, err = strconv.ParseFloat(svalue, 64); err != nil {
+						err = errInvalidArgument(svalue)
+						return
+					}
+				}
+				t.whens = append(t.whens, when)
+				continue
+			case "min", "max":
+				vs = nvs
+				var scount string
+				if vs, scount, ok = tokenval(vs); !ok || scount == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var count uint64
+				if count, err = strconv.ParseUint(scount, 10, 64); err != nil {
+					err = errInvalidArgument(scount)
+					return
+				}
+				if strings.ToLower(wtok) == "min" {
+					t.mincount, t.hasmin = count, true
+				} else {
+					t.maxcount, t.hasmax = count, true
+				}
+				continue
 			case "cursor":
 				vs = nvs
 				if scursor != "" {
@@ -431,6 +526,37 @@ func (s *Server) parseSearchScanBaseTokens(
 				}
 				t.whereevals = append(t.whereevals, whereevalT{s, luaState, fn})
 				continue
+			case "filter":
+				vs = nvs
+				if t.filter != nil {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var src string
+				if vs, src, ok = tokenval(vs); !ok || src == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if t.filter, err = filter.Compile(src); err != nil {
+					err = fmt.Errorf("invalid FILTER: %v", err)
+					return
+				}
+				continue
+			case "order":
+				vs = nvs
+				if t.orderBy != nil {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var by string
+				if vs, by, ok = tokenval(vs); !ok || strings.ToLower(by) != "by" {
+					err = errors.New("missing BY after ORDER")
+					return
+				}
+				if vs, t.orderBy, err = parseOrderBy(vs); err != nil {
+					return
+				}
+				continue
 			case "nofields":
 				vs = nvs
 				if t.nofields {
@@ -439,6 +565,32 @@ func (s *Server) parseSearchScanBaseTokens(
 				}
 				t.nofields = true
 				continue
+			case "fields":
+				vs = nvs
+				if t.fields != nil {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.fields, err = parseFieldList(vs); err != nil {
+					return
+				}
+				continue
+			case "nogeometry":
+				vs = nvs
+				if t.nogeometry {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.nogeometry = true
+				continue
+			case "profile":
+				vs = nvs
+				if t.profile {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.profile = true
+				continue
 			case "limit":
 				vs = nvs
 				if slimit != "" {
@@ -519,7 +671,8 @@ func (s *Server) parseSearchScanBaseTokens(
 					default:
 						err = errInvalidArgument(peek)
 						return
-					case "inside", "outside", "enter", "exit", "cross":
+					case "inside", "outside", "enter", "exit", "cross",
+						"deviate", "return", "density", "fieldchange":
 					}
 					if t.detect[part] {
 						err = errDuplicateArgument(s)
@@ -617,10 +770,56 @@ func (s *Server) parseSearchScanBaseTokens(
 		err = errors.New("CURSOR is not allowed when FENCE is specified")
 		return
 	}
+	if t.orderBy != nil && ssparse != "" {
+		err = errors.New("ORDER is not allowed when SPARSE is specified")
+		return
+	}
+	if t.orderBy != nil && t.fence {
+		err = errors.New("ORDER is not allowed when FENCE is specified")
+		return
+	}
+	if t.fields != nil && t.nofields {
+		err = errors.New("FIELDS is not allowed when NOFIELDS is specified")
+		return
+	}
+	if t.fields != nil && t.fence {
+		err = errors.New("FIELDS is not allowed when FENCE is specified")
+		return
+	}
+	if t.nogeometry && t.fence {
+		err = errors.New("NOGEOMETRY is not allowed when FENCE is specified")
+		return
+	}
+	if t.profile && t.fence {
+		err = errors.New("PROFILE is not allowed when FENCE is specified")
+		return
+	}
 	if t.detect != nil && !t.fence {
 		err = errors.New("DETECT is not allowed when FENCE is not specified")
 		return
 	}
+	if t.detect["density"] {
+		if !t.hasmin && !t.hasmax {
+			err = errors.New("missing MIN or MAX argument")
+			return
+		}
+		if t.hasmin && t.hasmax && t.mincount > t.maxcount {
+			err = errors.New("MIN is greater than MAX")
+			return
+		}
+	} else if t.hasmin || t.hasmax {
+		err = errors.New("MIN and MAX are only allowed with DETECT density")
+		return
+	}
+	if t.detect["fieldchange"] {
+		if len(t.whens) == 0 {
+			err = errors.New("missing WHEN argument")
+			return
+		}
+	} else if len(t.whens) > 0 {
+		err = errors.New("WHEN is only allowed with DETECT fieldchange")
+		return
+	}
 
 	t.output = defaultSearchOutput
 	var nvs []string
@@ -49,6 +49,23 @@ func TestLowerCompare(t *testing.T) {
 	}
 }
 
+func TestWhenMet(t *testing.T) {
+	below := whenT{field: "battery", op: "<", value: 15}
+	if !below.met(20, true, 14) || below.met(14, true, 10) ||
+		below.met(10, true, 20) || !below.met(0, false, 5) {
+		t.Fatal("failed")
+	}
+	changed := whenT{field: "status", op: "changed"}
+	if !changed.met(1, true, 2) || changed.met(2, true, 2) ||
+		changed.met(0, false, 2) {
+		t.Fatal("failed")
+	}
+	equal := whenT{field: "status", op: "==", value: 2}
+	if !equal.met(1, true, 2) || equal.met(2, true, 2) {
+		t.Fatal("failed")
+	}
+}
+
 // func testParseFloat(t testing.TB, s string, f float64, invalid bool) {
 // 	n, err := parseFloat(s)
 // 	if err != nil {
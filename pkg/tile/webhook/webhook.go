@@ -0,0 +1,201 @@
+// Package webhook verifies the signatures of webhook messages. The server
+// signs the body of every HTTP request for hooks that have a SIGN secret,
+// and consumers use a Verifier to check the signature before trusting the
+// message.
+//
+// The signature header looks like:
+//
+//	X-Space-Signature: t=1514764800,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where t is the Unix time that the message was signed and v1 is the hex
+// encoded HMAC-SHA256 of the timestamp, a dot, and the request body.
+package webhook
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader is the HTTP header that carries the signature
+const SignatureHeader = "X-Space-Signature"
+
+// DefaultTolerance is the default maximum age of a signed message
+const DefaultTolerance = time.Minute * 5
+
+var (
+	// ErrNoSignature is returned when the signature header is missing or
+	// malformed
+	ErrNoSignature = errors.New("webhook: missing signature")
+	// ErrInvalidSignature is returned when the signature does not match
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrExpired is returned when the timestamp is outside of the tolerance
+	ErrExpired = errors.New("webhook: timestamp outside of tolerance")
+	// ErrReplayed is returned when a message has already been verified
+	ErrReplayed = errors.New("webhook: message replayed")
+)
+
+// Sign returns the signature header value for a body signed at time t
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// parse returns the timestamp and signatures of a header value. There may
+// be more than one v1 signature while a secret is being rotated.
+func parse(header string) (ts string, sigs [][]byte) {
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			if sig, err := hex.DecodeString(kv[1]); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return ts, sigs
+}
+
+// Verify checks that the header is a valid signature of the body, and that
+// it was signed no more than tolerance from now.
+func Verify(secret, header string, body []byte, tolerance time.Duration,
+	now time.Time,
+) error {
+	_, err := verify(secret, header, body, tolerance, now)
+	return err
+}
+
+// verify is Verify that also returns the signature that matched, which is
+// the same for every encoding of the header.
+func verify(secret, header string, body []byte, tolerance time.Duration,
+	now time.Time,
+) ([]byte, error) {
+	ts, sigs := parse(header)
+	if ts == "" || len(sigs) == 0 {
+		return nil, ErrNoSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrNoSignature
+	}
+	expected := mac(secret, ts, body)
+	var ok bool
+	for _, sig := range sigs {
+		if hmac.Equal(sig, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return nil, ErrExpired
+		}
+	}
+	return expected, nil
+}
+
+// Verifier verifies signed messages and rejects replays. A message is a
+// replay when the same signature has already been verified within the
+// tolerance, however its header is written. Messages older than the tolerance are rejected by their
+// timestamp, so only that window needs to be remembered.
+type Verifier struct {
+	// Secret is the value passed to SIGN
+	Secret string
+	// Tolerance is the maximum age of a message. DefaultTolerance is used
+	// when zero.
+	Tolerance time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]bool
+	queue []seenSig // seen signatures, oldest first
+}
+
+type seenSig struct {
+	sig string // hex of the signature that matched
+	at  time.Time
+}
+
+// Verify checks the signature header of a message body
+func (v *Verifier) Verify(header string, body []byte) error {
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	expected, err := verify(v.Secret, header, body, tolerance, time.Now())
+	if err != nil {
+		return err
+	}
+	sig := hex.EncodeToString(expected)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[string]bool)
+	}
+	// signatures are queued in the order they were seen, so the expired
+	// ones are always at the front
+	now := time.Now()
+	for len(v.queue) > 0 && now.Sub(v.queue[0].at) > tolerance*2 {
+		delete(v.seen, v.queue[0].sig)
+		v.queue[0] = seenSig{}
+		v.queue = v.queue[1:]
+	}
+	if v.seen[sig] {
+		return ErrReplayed
+	}
+	v.seen[sig] = true
+	v.queue = append(v.queue, seenSig{sig, now})
+	return nil
+}
+
+// VerifyRequest reads the body of a webhook request and verifies it
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return body, v.Verify(r.Header.Get(SignatureHeader), body)
+}
@@ -0,0 +1,87 @@
+package webhook
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"detect":"enter"}`)
+	now := time.Now()
+	header := Sign("secret", now, body)
+	if err := Verify("secret", header, body, time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify("other", header, body, time.Minute, now); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+	if err := Verify("secret", header, []byte(`{}`), time.Minute, now); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+	err := Verify("secret", header, body, time.Minute, now.Add(time.Hour))
+	if err != ErrExpired {
+		t.Fatalf("expected %v, got %v", ErrExpired, err)
+	}
+	if err := Verify("secret", "v1=00", body, time.Minute, now); err != ErrNoSignature {
+		t.Fatalf("expected %v, got %v", ErrNoSignature, err)
+	}
+	// a rotated secret is accepted when either signature matches
+	old := Sign("old", now, body)
+	rotated := header + old[strings.Index(old, ","):]
+	if err := Verify("secret", rotated, body, time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifierReplay(t *testing.T) {
+	v := &Verifier{Secret: "secret"}
+	body := []byte(`{"detect":"exit"}`)
+	header := Sign("secret", time.Now(), body)
+	if err := v.Verify(header, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(header, body); err != ErrReplayed {
+		t.Fatalf("expected %v, got %v", ErrReplayed, err)
+	}
+	// a header that is written differently is still a replay
+	old := Sign("old", time.Now(), body)
+	for _, replay := range []string{
+		header + ",x=1",
+		" " + strings.Replace(header, ",", ", ", 1),
+		header + old[strings.Index(old, ","):],
+	} {
+		if err := v.Verify(replay, body); err != ErrReplayed {
+			t.Fatalf("%q: expected %v, got %v", replay, ErrReplayed, err)
+		}
+	}
+	// signatures seen more than twice the tolerance ago are forgotten
+	v.queue[0].at = time.Now().Add(-DefaultTolerance * 3)
+	other := Sign("secret", time.Now(), []byte(`{}`))
+	if err := v.Verify(other, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.queue) != 1 || len(v.seen) != 1 {
+		t.Fatalf("expected only the newest signature, got %v", v.queue)
+	}
+}